@@ -0,0 +1,192 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"selfupdate.blockthrough.com/pkg/archive"
+)
+
+var (
+	ErrArchiveBinaryNotFound  = errors.New("archive binary not found")
+	ErrArchiveAmbiguousBinary = errors.New("archive contains more than one executable")
+)
+
+type archivePatcher struct {
+	patcher      Patcher
+	pattern      string
+	companionDir string
+	maxSize      int64
+}
+
+type archiveOptFn func(a *archivePatcher)
+
+// WithArchiveBinaryPattern selects the binary inside the archive by matching
+// the base name of each entry against pattern. The syntax is the same as path.Match.
+func WithArchiveBinaryPattern(pattern string) archiveOptFn {
+	return func(a *archivePatcher) {
+		a.pattern = pattern
+	}
+}
+
+// WithArchiveCompanions installs every other file of the archive, such as
+// LICENSE or shell completions, into dir while keeping their relative paths.
+func WithArchiveCompanions(dir string) archiveOptFn {
+	return func(a *archivePatcher) {
+		a.companionDir = dir
+	}
+}
+
+// WithArchiveMaxSize bounds the size of the archive and of the files extracted
+// from it, archive.DefaultMaxSize by default
+func WithArchiveMaxSize(size int64) archiveOptFn {
+	return func(a *archivePatcher) {
+		a.maxSize = size
+	}
+}
+
+// NewArchivePatcher extracts tar, tar.gz or zip archives and passes the binary
+// found inside to the given patcher. Without a pattern, the archive must contain
+// exactly one executable entry.
+func NewArchivePatcher(patcher Patcher, optFns ...archiveOptFn) Patcher {
+	a := &archivePatcher{
+		patcher: patcher,
+		maxSize: archive.DefaultMaxSize,
+	}
+
+	for _, optFn := range optFns {
+		optFn(a)
+	}
+
+	return PatcherFunc(func(ctx context.Context, patch io.Reader) error {
+		if rc, ok := patch.(io.ReadCloser); ok {
+			defer rc.Close()
+		}
+
+		files, err := archive.Extract(patch, archive.WithMaxSize(a.maxSize))
+		if err != nil {
+			return err
+		}
+
+		binary, err := a.findBinary(files)
+		if err != nil {
+			return err
+		}
+
+		// the companions are only installed once the binary is, so a failed
+		// update never leaves new companions next to the old binary
+		var companions []stagedFile
+		defer func() {
+			for _, companion := range companions {
+				os.Remove(companion.tmp)
+			}
+		}()
+
+		if a.companionDir != "" {
+			for i := range files {
+				if &files[i] == binary {
+					continue
+				}
+
+				companion, err := stageCompanion(a.companionDir, &files[i])
+				if err != nil {
+					return err
+				}
+
+				companions = append(companions, companion)
+			}
+		}
+
+		if err := a.patcher.Patch(ctx, bytes.NewReader(binary.Data)); err != nil {
+			return err
+		}
+
+		for _, companion := range companions {
+			if err := os.Rename(companion.tmp, companion.target); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// IsArchiveName reports whether the name of an asset looks like an archive
+// supported by NewArchivePatcher
+func IsArchiveName(name string) bool {
+	for _, ext := range []string{".tar", ".tar.gz", ".tgz", ".zip"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *archivePatcher) findBinary(files []archive.File) (*archive.File, error) {
+	var found *archive.File
+
+	for i := range files {
+		file := &files[i]
+
+		if a.pattern != "" {
+			ok, err := path.Match(a.pattern, path.Base(file.Name))
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		} else if !file.IsExecutable() && !strings.HasSuffix(file.Name, ".exe") {
+			continue
+		}
+
+		if found != nil {
+			return nil, ErrArchiveAmbiguousBinary
+		}
+
+		found = file
+	}
+
+	if found == nil {
+		return nil, ErrArchiveBinaryNotFound
+	}
+
+	return found, nil
+}
+
+// stagedFile is written to tmp, next to target, until it's renamed into place
+type stagedFile struct {
+	tmp    string
+	target string
+}
+
+func stageCompanion(dir string, file *archive.File) (stagedFile, error) {
+	target, err := archive.SafeJoin(dir, file.Name)
+	if err != nil {
+		return stagedFile{}, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return stagedFile{}, err
+	}
+
+	mode := file.Mode
+	if mode == 0 {
+		mode = 0644
+	}
+
+	tmp := target + ".staged"
+	if err := os.WriteFile(tmp, file.Data, mode); err != nil {
+		return stagedFile{}, err
+	}
+
+	// WriteFile keeps the mode of an existing file
+	return stagedFile{tmp: tmp, target: target}, os.Chmod(tmp, mode)
+}
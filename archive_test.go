@@ -0,0 +1,114 @@
+package selfupdate_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"selfupdate.blockthrough.com"
+)
+
+func TestArchivePatcher(t *testing.T) {
+	dir := t.TempDir()
+
+	var buffer bytes.Buffer
+	tw := tar.NewWriter(&buffer)
+	for _, file := range []struct {
+		name    string
+		mode    int64
+		content string
+	}{
+		{"app", 0755, "binary"},
+		{"LICENSE", 0644, "license"},
+		{"completions/app.bash", 0644, "complete"},
+	} {
+		tw.WriteHeader(&tar.Header{Name: file.name, Mode: file.mode, Size: int64(len(file.content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(file.content))
+	}
+	tw.Close()
+
+	patcher := selfupdate.NewArchivePatcher(
+		selfupdate.NewPatcher(filepath.Join(dir, "app-downloaded")),
+		selfupdate.WithArchiveBinaryPattern("app"),
+		selfupdate.WithArchiveCompanions(dir),
+	)
+
+	err := patcher.Patch(context.Background(), &buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range map[string]string{
+		"app-downloaded":       "binary",
+		"LICENSE":              "license",
+		"completions/app.bash": "complete",
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != content {
+			t.Fatalf("content of %s is not matched", name)
+		}
+	}
+}
+
+func TestArchivePatcherFailure(t *testing.T) {
+	dir := t.TempDir()
+
+	var buffer bytes.Buffer
+	tw := tar.NewWriter(&buffer)
+	for _, file := range []struct {
+		name    string
+		mode    int64
+		content string
+	}{
+		{"app", 0755, "binary"},
+		{"LICENSE", 0644, "new license"},
+	} {
+		tw.WriteHeader(&tar.Header{Name: file.name, Mode: file.mode, Size: int64(len(file.content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(file.content))
+	}
+	tw.Close()
+
+	if err := os.WriteFile(filepath.Join(dir, "LICENSE"), []byte("old license"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	errPatch := errors.New("disk full")
+	patcher := selfupdate.NewArchivePatcher(
+		selfupdate.PatcherFunc(func(ctx context.Context, patch io.Reader) error {
+			return errPatch
+		}),
+		selfupdate.WithArchiveBinaryPattern("app"),
+		selfupdate.WithArchiveCompanions(dir),
+	)
+
+	if err := patcher.Patch(context.Background(), &buffer); !errors.Is(err, errPatch) {
+		t.Fatalf("expected the patch error, got %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "LICENSE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "old license" {
+		t.Fatalf("expected the old companion to be kept, got %q", data)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Fatalf("expected no staged files to be left, got %d entries", len(entries))
+	}
+}
@@ -0,0 +1,211 @@
+package selfupdate
+
+import (
+	"errors"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const (
+	// DefaultAssetTemplate is the naming scheme used by the upload CLI and Auto
+	// when no other template is given
+	DefaultAssetTemplate = "{{.Name}}-{{.OS}}-{{.Arch}}.sign"
+)
+
+var (
+	ErrAssetTemplateEmpty = errors.New("asset template renders an empty name")
+)
+
+// Platform describes the target of a release asset. ArmVersion and Amd64Version
+// are either empty or in the form of "v7" and "v3", Libc is either empty, "gnu"
+// or "musl".
+type Platform struct {
+	OS           string
+	Arch         string
+	ArmVersion   string
+	Amd64Version string
+	Libc         string
+}
+
+// CurrentPlatform returns the platform of the running binary. The arm and amd64
+// versions are read from the build info and libc is detected at runtime on linux.
+func CurrentPlatform() Platform {
+	p := Platform{
+		OS:   runtime.GOOS,
+		Arch: runtime.GOARCH,
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "GOARM" && p.Arch == "arm":
+				// GOARM may carry a float mode suffix, e.g. "7,softfloat"
+				p.ArmVersion = "v" + strings.Split(setting.Value, ",")[0]
+			case setting.Key == "GOAMD64" && p.Arch == "amd64":
+				p.Amd64Version = setting.Value
+			}
+		}
+	}
+
+	if p.OS == "linux" {
+		p.Libc = detectLibc()
+	}
+
+	return p
+}
+
+// Fallbacks returns the platform itself followed by every platform whose assets
+// can run on it, from the most to the least specific:
+//
+//   - armv7 falls back to armv6 and armv5
+//   - amd64v3 falls back to amd64v2, amd64v1 and plain amd64
+//   - musl and glibc builds fall back to builds without a libc variant
+//   - darwin falls back to universal binaries
+func (p Platform) Fallbacks() []Platform {
+	var archs []Platform
+
+	switch {
+	case p.ArmVersion != "":
+		level, err := strconv.Atoi(strings.TrimPrefix(p.ArmVersion, "v"))
+		if err != nil {
+			archs = append(archs, p)
+			break
+		}
+
+		for ; level >= 5; level-- {
+			arch := p
+			arch.ArmVersion = "v" + strconv.Itoa(level)
+			archs = append(archs, arch)
+		}
+	case p.Amd64Version != "":
+		level, err := strconv.Atoi(strings.TrimPrefix(p.Amd64Version, "v"))
+		if err != nil {
+			archs = append(archs, p)
+			break
+		}
+
+		for ; level >= 1; level-- {
+			arch := p
+			arch.Amd64Version = "v" + strconv.Itoa(level)
+			archs = append(archs, arch)
+		}
+
+		arch := p
+		arch.Amd64Version = ""
+		archs = append(archs, arch)
+	default:
+		archs = append(archs, p)
+	}
+
+	var result []Platform
+	for _, arch := range archs {
+		result = append(result, arch)
+
+		if arch.Libc != "" {
+			arch.Libc = ""
+			result = append(result, arch)
+		}
+	}
+
+	if p.OS == "darwin" && p.Arch != "universal" {
+		result = append(result, Platform{OS: p.OS, Arch: "universal"})
+	}
+
+	return result
+}
+
+// AssetTemplate renders release asset names. The template has access to the
+// following fields: .Name, .Version, .OS, .Arch, .ArmVersion, .Amd64Version and .Libc
+// for example:
+//
+//	{{.Name}}_{{.Version}}_{{.OS}}_{{.Arch}}{{.ArmVersion}}.tar.gz
+type AssetTemplate struct {
+	name string
+	tmpl *template.Template
+}
+
+type assetTemplateData struct {
+	Platform
+	Name    string
+	Version string
+}
+
+func NewAssetTemplate(name string, text string) (*AssetTemplate, error) {
+	tmpl, err := template.New("asset").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AssetTemplate{
+		name: name,
+		tmpl: tmpl,
+	}, nil
+}
+
+// Name renders the asset name for the given version and platform
+func (a *AssetTemplate) Name(version string, platform Platform) (string, error) {
+	var sb strings.Builder
+
+	err := a.tmpl.Execute(&sb, assetTemplateData{
+		Platform: platform,
+		Name:     a.name,
+		Version:  version,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if sb.Len() == 0 {
+		return "", ErrAssetTemplateEmpty
+	}
+
+	return sb.String(), nil
+}
+
+// Candidates renders the asset names of the platform and all its fallbacks, in
+// order and without duplicates
+func (a *AssetTemplate) Candidates(version string, platform Platform) ([]string, error) {
+	var names []string
+	seen := make(map[string]bool)
+
+	for _, p := range platform.Fallbacks() {
+		name, err := a.Name(version, p)
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[name] {
+			continue
+		}
+
+		seen[name] = true
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+func detectLibc() string {
+	matches, _ := filepath.Glob("/lib/ld-musl-*.so.1")
+	if len(matches) > 0 {
+		return "musl"
+	}
+
+	return "gnu"
+}
+
+// platformOf returns the platform, out of the fallbacks of platform, whose
+// asset is name
+func (a *AssetTemplate) platformOf(name string, version string, platform Platform) (Platform, bool) {
+	for _, p := range platform.Fallbacks() {
+		if candidate, err := a.Name(version, p); err == nil && candidate == name {
+			return p, true
+		}
+	}
+
+	return Platform{}, false
+}
@@ -0,0 +1,58 @@
+package selfupdate_test
+
+import (
+	"reflect"
+	"testing"
+
+	"selfupdate.blockthrough.com"
+)
+
+func TestAssetTemplateCandidates(t *testing.T) {
+	tests := []struct {
+		template string
+		platform selfupdate.Platform
+		want     []string
+	}{
+		{
+			selfupdate.DefaultAssetTemplate,
+			selfupdate.Platform{OS: "linux", Arch: "amd64", Amd64Version: "v3", Libc: "gnu"},
+			[]string{"app-linux-amd64.sign"},
+		},
+		{
+			"{{.Name}}_{{.Version}}_{{.OS}}_{{.Arch}}{{.ArmVersion}}.tar.gz",
+			selfupdate.Platform{OS: "linux", Arch: "arm", ArmVersion: "v7"},
+			[]string{"app_v1.0.0_linux_armv7.tar.gz", "app_v1.0.0_linux_armv6.tar.gz", "app_v1.0.0_linux_armv5.tar.gz"},
+		},
+		{
+			"{{.Name}}_{{.OS}}_{{.Arch}}",
+			selfupdate.Platform{OS: "darwin", Arch: "arm64"},
+			[]string{"app_darwin_arm64", "app_darwin_universal"},
+		},
+		{
+			"{{.Name}}_{{.Arch}}{{.Amd64Version}}{{if .Libc}}_{{.Libc}}{{end}}",
+			selfupdate.Platform{OS: "linux", Arch: "amd64", Amd64Version: "v3", Libc: "musl"},
+			[]string{
+				"app_amd64v3_musl", "app_amd64v3",
+				"app_amd64v2_musl", "app_amd64v2",
+				"app_amd64v1_musl", "app_amd64v1",
+				"app_amd64_musl", "app_amd64",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		assetTemplate, err := selfupdate.NewAssetTemplate("app", tt.template)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := assetTemplate.Candidates("v1.0.0", tt.platform)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v; want %v", tt.template, got, tt.want)
+		}
+	}
+}
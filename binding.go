@@ -0,0 +1,122 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"selfupdate.blockthrough.com/pkg/crypto"
+)
+
+var (
+	ErrBindingMismatch  = errors.New("signature is bound to another release")
+	ErrBindingMissing   = errors.New("signature is not bound to a release")
+	ErrSignatureExpired = errors.New("signature is expired")
+	ErrBindingTooLarge  = errors.New("signature binding is too large")
+	ErrBindingPlatform  = errors.New("asset is not built for any platform to bind to")
+)
+
+// Binding is what a signature is bound to, besides the hash of the content. It
+// stops a validly signed asset from being served as another version, for
+// another platform or for another app. Empty fields are not bound.
+type Binding struct {
+	App     string
+	Version string
+	OS      string
+	Arch    string
+}
+
+// WithSignerBinding binds the signature to the app, version and platform of the
+// release. The signature always carries the key id, and it can only be verified
+// by clients with binding support.
+func WithSignerBinding(binding Binding) signerOptFn {
+	return func(opts *signerOptions) {
+		opts.binding = &binding
+	}
+}
+
+// WithSignerExpiry makes the signature expire after the given duration, so a
+// leaked old release can't be installed forever. It implies WithSignerBinding,
+// with an empty binding if none is set.
+func WithSignerExpiry(expiry time.Duration) signerOptFn {
+	return func(opts *signerOptions) {
+		opts.expiry = expiry
+		if opts.binding == nil {
+			opts.binding = &Binding{}
+		}
+	}
+}
+
+// NewBindingVerifier is like NewKeyringVerifier, but it only accepts signatures
+// bound by WithSignerBinding, and every non-empty field of binding must match
+// the bound one. Expired signatures are refused.
+func NewBindingVerifier(keyring *crypto.Keyring, binding Binding, optFns ...verifierOptFn) Verifier {
+	return newBoundVerifier(keyring, &binding, newVerifierOptions(optFns))
+}
+
+// newBoundVerifier verifies every signature format if binding is nil, otherwise
+// only the bound one. The expiry of bound signatures and the digest algorithm
+// are checked either way.
+func newBoundVerifier(keyring *crypto.Keyring, binding *Binding, opts *verifierOptions) Verifier {
+	return VerifierFunc(func(ctx context.Context, r io.Reader) io.Reader {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return newErrorReader(err)
+		}
+
+		sigs, contents := decodeSignatures(data)
+		if len(sigs) == 0 {
+			return newErrorReader(io.ErrUnexpectedEOF)
+		}
+
+		err = ErrVerificationFailed
+
+		for i := range sigs {
+			if !sigs[i].verify(keyring, contents[i]) {
+				continue
+			}
+
+			if algorithm, _ := sigs[i].hashAlgorithm(); !opts.allows(algorithm) {
+				err = ErrHashNotAllowed
+				continue
+			}
+
+			if sigs[i].version != signatureVersion2 {
+				if binding != nil {
+					err = ErrBindingMissing
+					continue
+				}
+
+				return bytes.NewReader(contents[i])
+			}
+
+			payload, payloadErr := sigs[i].decodePayload()
+			if payloadErr != nil {
+				continue
+			}
+
+			if payload.Expires != 0 && !opts.now().Before(time.Unix(payload.Expires, 0)) {
+				err = ErrSignatureExpired
+				continue
+			}
+
+			if binding != nil && !binding.matches(payload) {
+				err = ErrBindingMismatch
+				continue
+			}
+
+			return bytes.NewReader(contents[i])
+		}
+
+		return newErrorReader(err)
+	})
+}
+
+func (b *Binding) matches(payload *signedPayload) bool {
+	return (b.App == "" || b.App == payload.App) &&
+		(b.Version == "" || b.Version == payload.Version) &&
+		(b.OS == "" || b.OS == payload.OS) &&
+		(b.Arch == "" || b.Arch == payload.Arch)
+}
@@ -0,0 +1,92 @@
+package selfupdate_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"selfupdate.blockthrough.com"
+	"selfupdate.blockthrough.com/pkg/crypto"
+)
+
+func TestBindingVerifier(t *testing.T) {
+	publicKey, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := crypto.NewKeyring(publicKey)
+
+	binding := selfupdate.Binding{App: "app", Version: "v1.0.0", OS: "linux", Arch: "amd64"}
+	later := func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+	tests := []struct {
+		name     string
+		signer   selfupdate.Signer
+		expected selfupdate.Binding
+		now      func() time.Time
+		err      error
+	}{
+		{"matching", selfupdate.NewHashSigner(privateKey, selfupdate.WithSignerBinding(binding)), binding, time.Now, nil},
+		{"partial", selfupdate.NewHashSigner(privateKey, selfupdate.WithSignerBinding(binding)), selfupdate.Binding{App: "app"}, time.Now, nil},
+		{"other version", selfupdate.NewHashSigner(privateKey, selfupdate.WithSignerBinding(binding)), selfupdate.Binding{App: "app", Version: "v2.0.0"}, time.Now, selfupdate.ErrBindingMismatch},
+		{"other arch", selfupdate.NewHashSigner(privateKey, selfupdate.WithSignerBinding(binding)), selfupdate.Binding{Arch: "arm64"}, time.Now, selfupdate.ErrBindingMismatch},
+		{"legacy", selfupdate.NewHashSigner(privateKey), binding, time.Now, selfupdate.ErrBindingMissing},
+		{"key id", selfupdate.NewHashSigner(privateKey, selfupdate.WithSignerKeyID()), binding, time.Now, selfupdate.ErrBindingMissing},
+		{"not expired", selfupdate.NewHashSigner(privateKey, selfupdate.WithSignerBinding(binding), selfupdate.WithSignerExpiry(time.Hour)), binding, time.Now, nil},
+		{"expired", selfupdate.NewHashSigner(privateKey, selfupdate.WithSignerBinding(binding), selfupdate.WithSignerExpiry(time.Hour)), binding, later, selfupdate.ErrSignatureExpired},
+	}
+
+	for _, tt := range tests {
+		verifier := selfupdate.NewBindingVerifier(keyring, tt.expected, selfupdate.WithVerifierClock(tt.now))
+
+		signed := tt.signer.Sign(context.Background(), strings.NewReader("hello, world"))
+		content, err := io.ReadAll(verifier.Verify(context.Background(), signed))
+
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v but got %v", tt.name, tt.err, err)
+		} else if err == nil && string(content) != "hello, world" {
+			t.Errorf("%s: content is not matched", tt.name)
+		}
+	}
+}
+
+func TestBindingKeyringVerifier(t *testing.T) {
+	publicKey, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer := selfupdate.NewHashSigner(
+		privateKey,
+		selfupdate.WithSignerBinding(selfupdate.Binding{App: "app", Version: "v1.0.0"}),
+		selfupdate.WithSignerDetached(),
+	)
+
+	signature, err := io.ReadAll(signer.Sign(context.Background(), strings.NewReader("hello, world")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := selfupdate.NewDetachedVerifier(selfupdate.NewHashVerifier(publicKey), bytes.NewReader(signature))
+
+	content, err := io.ReadAll(verifier.Verify(context.Background(), strings.NewReader("hello, world")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "hello, world" {
+		t.Fatal("content is not matched")
+	}
+
+	verifier = selfupdate.NewDetachedVerifier(selfupdate.NewHashVerifier(publicKey), bytes.NewReader(signature))
+
+	_, err = io.ReadAll(verifier.Verify(context.Background(), strings.NewReader("hello, mallory")))
+	if !errors.Is(err, selfupdate.ErrVerificationFailed) {
+		t.Fatalf("expected ErrVerificationFailed but got %v", err)
+	}
+}
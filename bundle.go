@@ -0,0 +1,517 @@
+package selfupdate
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"selfupdate.blockthrough.com/pkg/archive"
+	"selfupdate.blockthrough.com/pkg/hash"
+	"selfupdate.blockthrough.com/pkg/version"
+)
+
+const (
+	// BundleManifestName is the name of the signed manifest inside a bundle archive
+	BundleManifestName = "selfupdate.manifest"
+
+	bundleVersionsDir = "versions"
+	bundleCurrentLink = "current"
+)
+
+var (
+	ErrBundleManifestNotFound  = errors.New("bundle manifest not found")
+	ErrBundleFileMismatch      = errors.New("bundle file does not match manifest")
+	ErrBundleInvalidVersion    = errors.New("bundle version is invalid")
+	ErrBundleNoPreviousVersion = errors.New("bundle has no previous version")
+	ErrBundleDowngrade         = errors.New("bundle version is not newer than the current one")
+)
+
+// BundleManifest lists the files of a bundle with their hashes, Alg names the
+// digest algorithm of the hashes if it's not SHA-256
+type BundleManifest struct {
+	Version string               `json:"version"`
+	Alg     string               `json:"alg,omitempty"`
+	Files   []BundleManifestFile `json:"files"`
+}
+
+type BundleManifestFile struct {
+	Path string      `json:"path"`
+	Hash string      `json:"hash"`
+	Mode fs.FileMode `json:"mode"`
+}
+
+// Bundle installs multi-file applications into versioned directories under
+// root and points root/current to the active version:
+//
+//	root/
+//	  current -> versions/v1.2.3
+//	  versions/
+//	    v1.2.2/
+//	    v1.2.3/
+type Bundle struct {
+	root      string
+	verifier  Verifier
+	keep      int
+	maxSize   int64
+	downgrade bool
+	opts      *verifierOptions
+}
+
+var _ Patcher = (*Bundle)(nil)
+
+type bundleOptFn func(b *Bundle)
+
+// WithBundleKeep sets how many versions are kept after an install, the
+// current version is never pruned. Zero keeps every version.
+func WithBundleKeep(n int) bundleOptFn {
+	return func(b *Bundle) {
+		b.keep = n
+	}
+}
+
+// WithBundleDowngrade installs bundles which aren't newer than the current
+// version, e.g. to repair the current version. Otherwise, a replayed old
+// bundle, which is still validly signed, fails with ErrBundleDowngrade.
+func WithBundleDowngrade() bundleOptFn {
+	return func(b *Bundle) {
+		b.downgrade = true
+	}
+}
+
+// WithBundleMaxSize bounds the size of the bundle archive and of the files
+// extracted from it, archive.DefaultMaxSize by default
+func WithBundleMaxSize(size int64) bundleOptFn {
+	return func(b *Bundle) {
+		b.maxSize = size
+	}
+}
+
+// WithBundleVerifierOptions sets the options the hashes of the manifest are
+// checked with, e.g. WithVerifierHashes, like those of the verifier
+func WithBundleVerifierOptions(optFns ...verifierOptFn) bundleOptFn {
+	return func(b *Bundle) {
+		b.opts = newVerifierOptions(optFns)
+	}
+}
+
+func NewBundle(root string, verifier Verifier, optFns ...bundleOptFn) *Bundle {
+	b := &Bundle{
+		root:     root,
+		verifier: verifier,
+		keep:     3,
+		maxSize:  archive.DefaultMaxSize,
+		opts:     newVerifierOptions(nil),
+	}
+
+	for _, optFn := range optFns {
+		optFn(b)
+	}
+
+	return b
+}
+
+// Patch installs a bundle archive created by CreateBundle. Every file is checked
+// against the signed manifest before the current version is switched. Only a
+// version newer than the current one is installed, please refer to
+// WithBundleDowngrade.
+func (b *Bundle) Patch(ctx context.Context, patch io.Reader) error {
+	if rc, ok := patch.(io.ReadCloser); ok {
+		defer rc.Close()
+	}
+
+	files, err := archive.Extract(patch, archive.WithMaxSize(b.maxSize))
+	if err != nil {
+		return err
+	}
+
+	filesByName := make(map[string]*archive.File, len(files))
+	for i := range files {
+		filesByName[files[i].Name] = &files[i]
+	}
+
+	signedManifest, ok := filesByName[BundleManifestName]
+	if !ok {
+		return ErrBundleManifestNotFound
+	}
+
+	manifest, err := b.verifyManifest(ctx, signedManifest.Data)
+	if err != nil {
+		return err
+	}
+
+	versionDir, err := b.versionDir(manifest.Version)
+	if err != nil {
+		return err
+	}
+
+	// the first install has no current version yet
+	current, err := b.Current()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	} else if err == nil && !b.downgrade && !version.Compare(manifest.Version, current) {
+		return fmt.Errorf("%w: %s, current %s", ErrBundleDowngrade, manifest.Version, current)
+	}
+
+	algorithm := hash.SHA256
+	if manifest.Alg != "" {
+		algorithm, err = hash.Lookup(manifest.Alg)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !b.opts.allows(algorithm) {
+		return ErrHashNotAllowed
+	}
+
+	// the archive must contain exactly what the manifest says, nothing more
+	if len(files) != len(manifest.Files)+1 {
+		return ErrBundleFileMismatch
+	}
+
+	stagingDir := filepath.Join(b.root, bundleVersionsDir, "."+manifest.Version+".tmp")
+	if err := os.RemoveAll(stagingDir); err != nil {
+		return err
+	}
+	defer os.RemoveAll(stagingDir)
+
+	for _, manifestFile := range manifest.Files {
+		file, ok := filesByName[manifestFile.Path]
+		if !ok {
+			return ErrBundleFileMismatch
+		}
+
+		contentHash, err := algorithm.FromReader(bytes.NewReader(file.Data))
+		if err != nil {
+			return err
+		}
+
+		if hex.EncodeToString(contentHash) != manifestFile.Hash {
+			return ErrBundleFileMismatch
+		}
+
+		target, err := archive.SafeJoin(stagingDir, manifestFile.Path)
+		if err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(target, file.Data, manifestFile.Mode.Perm()); err != nil {
+			return err
+		}
+
+		// WriteFile is subject to umask, the manifest is the source of truth
+		if err := os.Chmod(target, manifestFile.Mode.Perm()); err != nil {
+			return err
+		}
+	}
+
+	// keep the signed manifest around, so the installed version can be audited later
+	err = os.WriteFile(filepath.Join(stagingDir, BundleManifestName), signedManifest.Data, 0644)
+	if err != nil {
+		return err
+	}
+
+	// a reinstalled version, which may be the current one, is only moved aside
+	// and removed once the new copy is switched to, so a failure restores it
+	oldDir := filepath.Join(b.root, bundleVersionsDir, "."+manifest.Version+".old")
+	if err := os.RemoveAll(oldDir); err != nil {
+		return err
+	}
+
+	reinstall := false
+	if _, err := os.Stat(versionDir); err == nil {
+		if err := os.Rename(versionDir, oldDir); err != nil {
+			return err
+		}
+		reinstall = true
+	}
+
+	restore := func() {
+		if reinstall {
+			os.RemoveAll(versionDir)
+			os.Rename(oldDir, versionDir)
+		}
+	}
+
+	if err := os.Rename(stagingDir, versionDir); err != nil {
+		restore()
+		return err
+	}
+
+	if err := b.Switch(manifest.Version); err != nil {
+		restore()
+		return err
+	}
+
+	if err := os.RemoveAll(oldDir); err != nil {
+		return err
+	}
+
+	return b.Prune()
+}
+
+// Current returns the version the current link points to
+func (b *Bundle) Current() (string, error) {
+	target, err := os.Readlink(filepath.Join(b.root, bundleCurrentLink))
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Base(target), nil
+}
+
+// Versions returns all installed versions, newest first
+func (b *Bundle) Versions() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(b.root, bundleVersionsDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		versions = append(versions, entry.Name())
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return version.Compare(versions[i], versions[j])
+	})
+
+	return versions, nil
+}
+
+// Switch atomically points the current link to an already installed version
+func (b *Bundle) Switch(ver string) error {
+	versionDir, err := b.versionDir(ver)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(versionDir); err != nil {
+		return err
+	}
+
+	// symlink to a temporary name first and rename it over the current link,
+	// rename is atomic so there is never a moment without a current version
+	tmpLink := filepath.Join(b.root, "."+bundleCurrentLink+".tmp")
+	os.Remove(tmpLink)
+
+	err = os.Symlink(filepath.Join(bundleVersionsDir, ver), tmpLink)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpLink, filepath.Join(b.root, bundleCurrentLink))
+}
+
+// Rollback switches the current link to the newest installed version which is
+// older than the current one
+func (b *Bundle) Rollback() error {
+	current, err := b.Current()
+	if err != nil {
+		return err
+	}
+
+	versions, err := b.Versions()
+	if err != nil {
+		return err
+	}
+
+	for _, ver := range versions {
+		if version.Compare(current, ver) {
+			return b.Switch(ver)
+		}
+	}
+
+	return ErrBundleNoPreviousVersion
+}
+
+// Prune removes the oldest versions, only the newest ones and the current
+// version are kept
+func (b *Bundle) Prune() error {
+	if b.keep <= 0 {
+		return nil
+	}
+
+	current, err := b.Current()
+	if err != nil {
+		return err
+	}
+
+	versions, err := b.Versions()
+	if err != nil {
+		return err
+	}
+
+	kept := 0
+	for _, ver := range versions {
+		if ver == current || kept < b.keep {
+			kept++
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(b.root, bundleVersionsDir, ver)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Bundle) verifyManifest(ctx context.Context, signed []byte) (*BundleManifest, error) {
+	data, err := io.ReadAll(b.verifier.Verify(ctx, bytes.NewReader(signed)))
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest BundleManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+
+	return &manifest, nil
+}
+
+func (b *Bundle) versionDir(ver string) (string, error) {
+	if ver == "" || strings.HasPrefix(ver, ".") || strings.ContainsAny(ver, `/\`) {
+		return "", ErrBundleInvalidVersion
+	}
+
+	return filepath.Join(b.root, bundleVersionsDir, ver), nil
+}
+
+// CreateBundle walks dir and writes a tar.gz bundle into w. The bundle contains
+// every regular file of dir and a manifest, signed by signer, with their hashes
+// and modes. WithSignerHash sets the digest algorithm of the hashes.
+func CreateBundle(ctx context.Context, signer Signer, ver string, dir string, w io.Writer, optFns ...signerOptFn) error {
+	opts := &signerOptions{
+		hash: hash.SHA256,
+	}
+
+	for _, optFn := range optFns {
+		optFn(opts)
+	}
+
+	manifest := BundleManifest{
+		Version: ver,
+	}
+
+	if opts.hash != hash.SHA256 {
+		manifest.Alg = opts.hash.String()
+	}
+
+	var contents [][]byte
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		if filepath.ToSlash(rel) == BundleManifestName {
+			return ErrBundleFileMismatch
+		}
+
+		// the archived content is the hashed one, even if the file changes meanwhile
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		contentHash, err := opts.hash.FromReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+
+		contents = append(contents, data)
+		manifest.Files = append(manifest.Files, BundleManifestFile{
+			Path: filepath.ToSlash(rel),
+			Hash: hex.EncodeToString(contentHash),
+			Mode: info.Mode().Perm(),
+		})
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	manifestData, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	signedManifest, err := io.ReadAll(signer.Sign(ctx, bytes.NewReader(manifestData)))
+	if err != nil {
+		return err
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	err = writeTarEntry(tw, BundleManifestName, 0644, signedManifest)
+	if err != nil {
+		return err
+	}
+
+	for i, manifestFile := range manifest.Files {
+		err = writeTarEntry(tw, manifestFile.Path, manifestFile.Mode, contents[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gw.Close()
+}
+
+func writeTarEntry(tw *tar.Writer, name string, mode fs.FileMode, data []byte) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     int64(mode.Perm()),
+		Size:     int64(len(data)),
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tw.Write(data)
+	return err
+}
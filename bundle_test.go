@@ -0,0 +1,240 @@
+package selfupdate_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"selfupdate.blockthrough.com"
+	"selfupdate.blockthrough.com/pkg/crypto"
+	"selfupdate.blockthrough.com/pkg/hash"
+)
+
+func TestBundleInstallRollback(t *testing.T) {
+	publicKey, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	bundle := selfupdate.NewBundle(root, selfupdate.NewHashVerifier(publicKey), selfupdate.WithBundleKeep(2))
+
+	for _, ver := range []string{"v1.0.0", "v1.1.0", "v1.2.0"} {
+		src := t.TempDir()
+		os.MkdirAll(filepath.Join(src, "plugins"), 0755)
+		os.WriteFile(filepath.Join(src, "app"), []byte("binary "+ver), 0755)
+		os.WriteFile(filepath.Join(src, "plugins", "extra.so"), []byte("plugin "+ver), 0644)
+
+		var buffer bytes.Buffer
+		err := selfupdate.CreateBundle(context.Background(), selfupdate.NewHashSigner(privateKey), ver, src, &buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := bundle.Patch(context.Background(), &buffer); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(filepath.Join(root, "current", "plugins", "extra.so"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != "plugin "+ver {
+			t.Fatalf("current does not point to %s", ver)
+		}
+	}
+
+	versions, err := bundle.Versions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(versions) != 2 || versions[0] != "v1.2.0" || versions[1] != "v1.1.0" {
+		t.Fatalf("unexpected versions after prune: %v", versions)
+	}
+
+	if err := bundle.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := bundle.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if current != "v1.1.0" {
+		t.Fatalf("expected v1.1.0 after rollback, got %s", current)
+	}
+}
+
+func TestBundleRejectsTampering(t *testing.T) {
+	publicKey, _, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, otherPrivateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := t.TempDir()
+	os.WriteFile(filepath.Join(src, "app"), []byte("binary"), 0755)
+
+	var buffer bytes.Buffer
+	err = selfupdate.CreateBundle(context.Background(), selfupdate.NewHashSigner(otherPrivateKey), "v1.0.0", src, &buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := selfupdate.NewBundle(t.TempDir(), selfupdate.NewHashVerifier(publicKey))
+	if err := bundle.Patch(context.Background(), &buffer); err == nil {
+		t.Fatal("expected bundle signed by another key to be rejected")
+	}
+}
+
+func TestBundleReinstallCurrent(t *testing.T) {
+	publicKey, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	bundle := selfupdate.NewBundle(root, selfupdate.NewHashVerifier(publicKey), selfupdate.WithBundleDowngrade())
+
+	for _, content := range []string{"broken install", "repaired install"} {
+		src := t.TempDir()
+		os.WriteFile(filepath.Join(src, "app"), []byte(content), 0755)
+
+		var buffer bytes.Buffer
+		err := selfupdate.CreateBundle(context.Background(), selfupdate.NewHashSigner(privateKey), "v1.0.0", src, &buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := bundle.Patch(context.Background(), &buffer); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "current", "app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "repaired install" {
+		t.Fatalf("expected the reinstalled version to be current, got %q", data)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(root, "versions"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Fatalf("expected the previous copy to be removed, got %d entries", len(entries))
+	}
+}
+
+func TestBundleRefusesDowngrade(t *testing.T) {
+	publicKey, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bundles := map[string][]byte{}
+	for _, ver := range []string{"v1.0.0", "v1.1.0"} {
+		src := t.TempDir()
+		os.WriteFile(filepath.Join(src, "app"), []byte("binary "+ver), 0755)
+
+		var buffer bytes.Buffer
+		err := selfupdate.CreateBundle(context.Background(), selfupdate.NewHashSigner(privateKey), ver, src, &buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bundles[ver] = buffer.Bytes()
+	}
+
+	tests := []struct {
+		name      string
+		installed string
+		ver       string
+		downgrade bool
+		err       error
+	}{
+		{"upgrade", "v1.0.0", "v1.1.0", false, nil},
+		{"replayed old version", "v1.1.0", "v1.0.0", false, selfupdate.ErrBundleDowngrade},
+		{"same version", "v1.1.0", "v1.1.0", false, selfupdate.ErrBundleDowngrade},
+		{"allowed downgrade", "v1.1.0", "v1.0.0", true, nil},
+	}
+
+	for _, tt := range tests {
+		root := t.TempDir()
+		if err := selfupdate.NewBundle(root, selfupdate.NewHashVerifier(publicKey)).Patch(context.Background(), bytes.NewReader(bundles[tt.installed])); err != nil {
+			t.Fatal(err)
+		}
+
+		var optFns []selfupdate.BundleOptFn
+		if tt.downgrade {
+			optFns = append(optFns, selfupdate.WithBundleDowngrade())
+		}
+
+		bundle := selfupdate.NewBundle(root, selfupdate.NewHashVerifier(publicKey), optFns...)
+
+		err := bundle.Patch(context.Background(), bytes.NewReader(bundles[tt.ver]))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v but got %v", tt.name, tt.err, err)
+		}
+
+		want := tt.ver
+		if tt.err != nil {
+			want = tt.installed
+		}
+
+		if current, err := bundle.Current(); err != nil || current != want {
+			t.Errorf("%s: expected current %s but got %s, %v", tt.name, want, current, err)
+		}
+	}
+}
+
+func TestBundleHashes(t *testing.T) {
+	publicKey, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := t.TempDir()
+	os.WriteFile(filepath.Join(src, "app"), []byte("binary v1.0.0"), 0755)
+
+	var buffer bytes.Buffer
+	err = selfupdate.CreateBundle(context.Background(), selfupdate.NewHashSigner(privateKey), "v1.0.0", src, &buffer, selfupdate.WithSignerHash(hash.BLAKE3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := buffer.Bytes()
+
+	bundle := selfupdate.NewBundle(t.TempDir(), selfupdate.NewHashVerifier(publicKey),
+		selfupdate.WithBundleVerifierOptions(selfupdate.WithVerifierHashes(hash.SHA256)))
+
+	err = bundle.Patch(context.Background(), bytes.NewReader(signed))
+	if !errors.Is(err, selfupdate.ErrHashNotAllowed) {
+		t.Fatalf("expected ErrHashNotAllowed but got %v", err)
+	}
+
+	root := t.TempDir()
+	bundle = selfupdate.NewBundle(root, selfupdate.NewHashVerifier(publicKey))
+
+	if err := bundle.Patch(context.Background(), bytes.NewReader(signed)); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "current", "app"))
+	if err != nil || string(data) != "binary v1.0.0" {
+		t.Fatalf("expected the blake3 bundle to be installed, got %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"selfupdate.blockthrough.com"
+	"selfupdate.blockthrough.com/pkg/cli"
+	"selfupdate.blockthrough.com/pkg/crypto"
+)
+
+func bundleCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "bundle",
+		Usage: "create, install and rollback multi-file application bundles",
+		Subcommands: []*cli.Command{
+			bundleCreateCmd(),
+			bundleInstallCmd(),
+			bundleRollbackCmd(),
+		},
+	}
+}
+
+func bundleCreateCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "create",
+		Usage: "create a signed bundle from a directory and write it to stdout",
+		Flags: cli.MergeFlags(privateKeyFlags, signerFlags, []cli.Flag{
+			&cli.StringFlag{
+				Name:     "dir",
+				Usage:    "directory which contains the files of the bundle",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "version",
+				Usage:    "version of the bundle",
+				Required: true,
+			},
+			hashFlag,
+		}),
+		Action: func(ctx *cli.Context) error {
+			digestSigner, _, err := getDigestSigner(ctx)
+			if err != nil {
+				return err
+			}
+
+			algorithm, err := getHashAlgorithm(ctx)
+			if err != nil {
+				return err
+			}
+
+			return selfupdate.CreateBundle(
+				ctx.Context,
+				selfupdate.NewDigestSigner(digestSigner),
+				ctx.String("version"),
+				ctx.String("dir"),
+				os.Stdout,
+				selfupdate.WithSignerHash(algorithm),
+			)
+		},
+	}
+}
+
+func bundleInstallCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "install",
+		Usage: "verify and install a bundle read from stdin",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "root",
+				Usage:    "root directory of the installed application",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "key",
+				Usage:    "content of the public key",
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:  "allow-downgrade",
+				Usage: "install a version which isn't newer than the current one",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			publicKey, err := crypto.ParsePublicKey(ctx.String("key"))
+			if err != nil {
+				return err
+			}
+
+			optFns := appendIf(nil, ctx.Bool("allow-downgrade"), selfupdate.WithBundleDowngrade())
+			bundle := selfupdate.NewBundle(ctx.String("root"), selfupdate.NewHashVerifier(publicKey), optFns...)
+			return bundle.Patch(ctx.Context, os.Stdin)
+		},
+	}
+}
+
+func bundleRollbackCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "rollback",
+		Usage: "switch the current version back to the previous installed version",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "root",
+				Usage:    "root directory of the installed application",
+				Required: true,
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			bundle := selfupdate.NewBundle(ctx.String("root"), nil)
+
+			err := bundle.Rollback()
+			if err != nil {
+				return err
+			}
+
+			current, err := bundle.Current()
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(os.Stdout, "current version: %s\n", current)
+
+			return nil
+		},
+	}
+}
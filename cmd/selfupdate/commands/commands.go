@@ -14,6 +14,10 @@ func Execute(version string) error {
 		Commands: []*cli.Command{
 			cryptoCmd(),
 			githubCmd(),
+			bundleCmd(),
+			tufCmd(),
+			logCmd(),
+			revokeCmd(),
 		},
 	}
 
@@ -1,13 +1,30 @@
 package commands
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
 	"selfupdate.blockthrough.com"
 	"selfupdate.blockthrough.com/pkg/cli"
 	"selfupdate.blockthrough.com/pkg/crypto"
+	"selfupdate.blockthrough.com/pkg/fileutil"
+	"selfupdate.blockthrough.com/pkg/hash"
+	"selfupdate.blockthrough.com/pkg/sigstore"
+)
+
+const (
+	formatHex      = crypto.FormatHex
+	formatMinisign = crypto.FormatMinisign
+	formatSigstore = "sigstore"
 )
 
 func cryptoCmd() *cli.Command {
@@ -17,7 +34,12 @@ func cryptoCmd() *cli.Command {
 		Subcommands: []*cli.Command{
 			cryptoGenerateKeys(),
 			cryptoSign(),
+			cryptoCosign(),
 			cryptoVerify(),
+			cryptoConvert(),
+			cryptoRotate(),
+			cryptoRevokeKey(),
+			cryptoAttest(),
 		},
 	}
 }
@@ -26,17 +48,91 @@ func cryptoGenerateKeys() *cli.Command {
 	return &cli.Command{
 		Name:  "keys",
 		Usage: "genereating a pair of public/private keys for signing and verifying",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "name",
+				Usage: "name of the key, the keys are written to NAME.pub and NAME.key",
+				Value: "selfupdate",
+			},
+			&cli.StringFlag{
+				Name:  "key-dir",
+				Usage: "directory to write the keys to",
+				Value: ".",
+			},
+			&cli.StringFlag{
+				Name:  "format",
+				Usage: "format of the keys, one of hex, pem, openssh or minisign",
+				Value: formatHex,
+			},
+			&cli.BoolFlag{
+				Name:  "encrypt",
+				Usage: "encrypt the private key with a passphrase",
+			},
+			&cli.StringFlag{
+				Name:  "kdf",
+				Usage: "key derivation function of encrypted private keys, either argon2id or scrypt. openssh and minisign keys use their own",
+				Value: crypto.KDFArgon2id,
+			},
+			&cli.StringFlag{
+				Name:  "passphrase-env",
+				Usage: "name of the environment variable which holds the passphrase, if it's not set the passphrase is prompted",
+				Value: defaultPassphraseEnv,
+			},
+		},
 		Action: func(ctx *cli.Context) error {
 			publicKey, privateKey, err := crypto.GenerateKeys()
 			if err != nil {
 				return err
 			}
 
-			if err := createAndWrite("./selfupdate.pub", []byte(publicKey.String())); err != nil {
+			name := filepath.Join(ctx.String("key-dir"), ctx.String("name"))
+
+			var passphrase string
+			if ctx.Bool("encrypt") {
+				passphrase, err = getPassphrase(ctx, true)
+				if err != nil {
+					return err
+				}
+			}
+
+			var publicKeyText, privateKeyText string
+
+			switch ctx.String("format") {
+			case formatMinisign:
+				minisignPublicKey, minisignPrivateKey, err := crypto.NewMinisignKeys(privateKey)
+				if err != nil {
+					return err
+				}
+
+				publicKeyText = minisignPublicKey.String()
+				privateKeyText, err = minisignPrivateKey.Encode(passphrase)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "key id: %s\n", minisignPublicKey.KeyID)
+			default:
+				publicKeyText, err = crypto.EncodePublicKey(publicKey, ctx.String("format"))
+				if err != nil {
+					return err
+				}
+
+				if passphrase != "" {
+					privateKeyText, err = crypto.EncodePrivateKeyWithPassphrase(privateKey, ctx.String("format"), passphrase, ctx.String("kdf"))
+				} else {
+					privateKeyText, err = crypto.EncodePrivateKey(privateKey, ctx.String("format"))
+				}
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "key id: %s\n", publicKey.ID())
+			}
+
+			if err := fileutil.WriteAtomic(name+".pub", []byte(publicKeyText), 0644); err != nil {
 				return err
 			}
 
-			if err := createAndWrite("./selfupdate.key", []byte(privateKey.String())); err != nil {
+			// the private key must only be readable by its owner
+			if err := fileutil.WriteAtomic(name+".key", []byte(privateKeyText), 0600); err != nil {
 				return err
 			}
 
@@ -49,23 +145,85 @@ func cryptoSign() *cli.Command {
 	return &cli.Command{
 		Name:  "sign",
 		Usage: "sign a binary using private key",
-		Flags: []cli.Flag{
+		Flags: cli.MergeFlags(privateKeyFlags, signerFlags, []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "key-id",
+				Usage: "add a header with the key id to the signature, required for verifying with several trusted keys. It's implied by --key-name",
+			},
+			&cli.BoolFlag{
+				Name:  "detached",
+				Usage: "only write the signature, so it can be stored next to the unmodified binary",
+			},
 			&cli.StringFlag{
-				Name:     "key",
-				Usage:    "content of the private key",
-				Required: true,
+				Name:  "format",
+				Usage: "format of the signature, either hex or minisign. minisign signatures are always detached",
+				Value: formatHex,
+			},
+			&cli.StringFlag{
+				Name:  "trusted-comment",
+				Usage: "trusted comment of minisign signatures, defaults to the current timestamp",
+			},
+			hashFlag,
+		}, bindingFlags, []cli.Flag{
+			&cli.DurationFlag{
+				Name:  "expires",
+				Usage: "the signature expires after this duration, it implies a bound signature",
 			},
+		}),
+		Action: func(ctx *cli.Context) error {
+			var signer selfupdate.Signer
+
+			switch ctx.String("format") {
+			case formatHex:
+				digestSigner, keyID, err := getDigestSigner(ctx)
+				if err != nil {
+					return err
+				}
+
+				algorithm, err := getHashAlgorithm(ctx)
+				if err != nil {
+					return err
+				}
+
+				signer = newHashSigner(digestSigner, keyID, ctx.Bool("detached"), getBinding(ctx), ctx.Duration("expires"), algorithm)
+			case formatMinisign:
+				privateKey, err := getMinisignPrivateKey(ctx)
+				if err != nil {
+					return err
+				}
+
+				signer = selfupdate.NewMinisignSigner(privateKey, ctx.String("trusted-comment"))
+			default:
+				return cli.Exit("unknown signature format: "+ctx.String("format"), 1)
+			}
+
+			_, err := io.Copy(os.Stdout, signer.Sign(context.Background(), os.Stdin))
+			if err != nil {
+				return err
+			}
+
+			return nil
 		},
+	}
+}
+
+func cryptoCosign() *cli.Command {
+	return &cli.Command{
+		Name:  "cosign",
+		Usage: "add a signature to a multi-signature envelope, the envelope is created if the content is not signed yet",
+		Flags: cli.MergeFlags(privateKeyFlags, signerFlags, []cli.Flag{hashFlag}),
 		Action: func(ctx *cli.Context) error {
-			key := ctx.String("key")
+			digestSigner, _, err := getDigestSigner(ctx)
+			if err != nil {
+				return err
+			}
 
-			privateKey, err := crypto.ParsePrivateKey(key)
+			algorithm, err := getHashAlgorithm(ctx)
 			if err != nil {
 				return err
 			}
 
-			signer := selfupdate.NewHashSigner(privateKey)
-			_, err = io.Copy(os.Stdout, signer.Sign(context.Background(), os.Stdin))
+			_, err = io.Copy(os.Stdout, selfupdate.NewCosigner(digestSigner, selfupdate.WithSignerHash(algorithm)).Sign(ctx.Context, os.Stdin))
 			if err != nil {
 				return err
 			}
@@ -79,43 +237,408 @@ func cryptoVerify() *cli.Command {
 	return &cli.Command{
 		Name:  "verify",
 		Usage: "verify a binary using public key",
+		Flags: cli.MergeFlags([]cli.Flag{
+			&cli.StringFlag{
+				Name:  "key",
+				Usage: "content of the public key, multiple keys can be separated by commas. It's required unless the format is sigstore",
+			},
+			&cli.StringFlag{
+				Name:  "signature",
+				Usage: "path to a detached signature or sigstore bundle, if not provided the signature is expected to be prepended to the content",
+			},
+			&cli.StringFlag{
+				Name:  "format",
+				Usage: "format of the signature, either hex, minisign or sigstore",
+				Value: formatHex,
+			},
+			&cli.IntFlag{
+				Name:  "threshold",
+				Usage: "expect a multi-signature envelope created by 'crypto cosign' with valid signatures of at least this many of the keys",
+			},
+		}, bindingFlags, sigstoreFlags),
+		Action: func(ctx *cli.Context) error {
+			var verifier selfupdate.Verifier
+			var err error
+
+			if ctx.String("format") == formatSigstore {
+				verifier, err = getSigstoreVerifier(ctx)
+			} else if ctx.String("key") == "" {
+				return cli.Exit("--key is required", 1)
+			} else {
+				verifier, err = getVerifier(ctx.String("format"), ctx.String("key"), ctx.Int("threshold"), getBinding(ctx))
+			}
+			if err != nil {
+				return err
+			}
+
+			if path := ctx.String("signature"); path != "" {
+				signature, err := os.Open(path)
+				if err != nil {
+					return err
+				}
+				defer signature.Close()
+
+				verifier = selfupdate.NewDetachedVerifier(verifier, signature)
+			}
+			_, err = io.Copy(os.Stdout, verifier.Verify(context.Background(), os.Stdin))
+			if err != nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+}
+
+func cryptoConvert() *cli.Command {
+	return &cli.Command{
+		Name:  "convert",
+		Usage: "convert a public or private key to another format, the input format is detected automatically and encrypted private keys are decrypted",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
-				Name:     "key",
-				Usage:    "content of the public key",
+				Name:  "in",
+				Usage: "path to the key, if not provided the key is read from stdin",
+			},
+			&cli.StringFlag{
+				Name:     "format",
+				Usage:    "output format, one of hex, pem or openssh",
 				Required: true,
 			},
+			&cli.StringFlag{
+				Name:  "passphrase-env",
+				Usage: "name of the environment variable which holds the passphrase of an encrypted private key, if it's not set the passphrase is prompted",
+				Value: defaultPassphraseEnv,
+			},
 		},
 		Action: func(ctx *cli.Context) error {
-			key := ctx.String("key")
+			var data []byte
+			var err error
 
-			publicKey, err := crypto.ParsePublicKey(key)
+			if path := ctx.String("in"); path != "" {
+				data, err = os.ReadFile(path)
+			} else {
+				data, err = io.ReadAll(os.Stdin)
+			}
 			if err != nil {
 				return err
 			}
 
-			verifier := selfupdate.NewHashVerifier(publicKey)
-			_, err = io.Copy(os.Stdout, verifier.Verify(context.Background(), os.Stdin))
-			if err != nil {
+			format := ctx.String("format")
+
+			key := string(data)
+
+			var out string
+			if privateKey, err := parsePrivateKey(ctx, key); err == nil {
+				out, err = crypto.EncodePrivateKey(privateKey, format)
+				if err != nil {
+					return err
+				}
+			} else if crypto.IsEncrypted(key) {
 				return err
+			} else {
+				publicKey, err := crypto.ParsePublicKey(key)
+				if err != nil {
+					return err
+				}
+
+				out, err = crypto.EncodePublicKey(publicKey, format)
+				if err != nil {
+					return err
+				}
 			}
 
+			fmt.Fprint(os.Stdout, strings.TrimSuffix(out, "\n")+"\n")
+
 			return nil
 		},
 	}
 }
 
-func createAndWrite(filename string, data []byte) error {
-	file, err := os.Create(filename)
+func cryptoRotate() *cli.Command {
+	return &cli.Command{
+		Name:  "rotate",
+		Usage: "append a trust chain statement, signed by a trusted key, which trusts a new key",
+		Flags: cli.MergeFlags(privateKeyFlags, chainFlags, []cli.Flag{
+			&cli.StringFlag{
+				Name:     "new-key",
+				Usage:    "content of the public key to trust",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "from-version",
+				Usage: "the new key is only trusted for this version and the newer ones",
+			},
+		}),
+		Action: func(ctx *cli.Context) error {
+			privateKey, _, err := getPrivateKey(ctx)
+			if err != nil {
+				return err
+			}
+
+			newKey, err := crypto.ParsePublicKey(ctx.String("new-key"))
+			if err != nil {
+				return err
+			}
+
+			return appendKeyStatement(ctx.String("chain"), privateKey, selfupdate.KeyStatement{
+				Type:    selfupdate.KeyStatementRotate,
+				Key:     newKey.String(),
+				Version: ctx.String("from-version"),
+			})
+		},
+	}
+}
+
+func cryptoRevokeKey() *cli.Command {
+	return &cli.Command{
+		Name:  "revoke-key",
+		Usage: "append a trust chain statement, signed by a trusted key, which revokes a key",
+		Flags: cli.MergeFlags(privateKeyFlags, chainFlags, []cli.Flag{
+			&cli.StringFlag{
+				Name:     "revoke",
+				Usage:    "key id of the key to revoke",
+				Required: true,
+			},
+		}),
+		Action: func(ctx *cli.Context) error {
+			privateKey, _, err := getPrivateKey(ctx)
+			if err != nil {
+				return err
+			}
+
+			id, err := crypto.ParseKeyID(ctx.String("revoke"))
+			if err != nil {
+				return err
+			}
+
+			return appendKeyStatement(ctx.String("chain"), privateKey, selfupdate.KeyStatement{
+				Type:  selfupdate.KeyStatementRevoke,
+				KeyID: id.String(),
+			})
+		},
+	}
+}
+
+var chainFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:     "chain",
+		Usage:    "path to the chain file the statement is appended to, it's created if needed",
+		Required: true,
+	},
+}
+
+// appendKeyStatement signs the statement as the next one of the chain file and
+// appends it to the file
+func appendKeyStatement(path string, privateKey crypto.PrivateKey, statement selfupdate.KeyStatement) error {
+	chain, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	statement.Seq, statement.Prev, err = selfupdate.ChainHead(bytes.NewReader(chain))
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	_, err = file.Write(data)
+	line, err := selfupdate.SignKeyStatement(privateKey, statement)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if len(chain) > 0 && !bytes.HasSuffix(chain, []byte("\n")) {
+		line = "\n" + line
+	}
+
+	_, err = fmt.Fprintln(f, line)
+	return err
+}
+
+// bindingFlags are what a signature is bound to, please refer to selfupdate.Binding
+var bindingFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "app",
+		Usage: "name of the app the signature is bound to",
+	},
+	&cli.StringFlag{
+		Name:  "version",
+		Usage: "version the signature is bound to",
+	},
+	&cli.StringFlag{
+		Name:  "os",
+		Usage: "operating system the signature is bound to",
+	},
+	&cli.StringFlag{
+		Name:  "arch",
+		Usage: "architecture the signature is bound to",
+	},
+}
+
+// getBinding returns the binding of the binding flags, or nil if none is set
+func getBinding(ctx *cli.Context) *selfupdate.Binding {
+	binding := selfupdate.Binding{
+		App:     ctx.String("app"),
+		Version: ctx.String("version"),
+		OS:      ctx.String("os"),
+		Arch:    ctx.String("arch"),
+	}
+
+	if binding == (selfupdate.Binding{}) {
+		return nil
+	}
+
+	return &binding
+}
+
+// sigstoreFlags are what a sigstore bundle is verified against, the names are
+// the same as the ones of 'cosign verify-blob'
+var sigstoreFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "certificate-identity",
+		Usage: "expected subject of the sigstore signing certificate, e.g. https://github.com/owner/repo/.github/workflows/release.yml@refs/tags/v1.0.0",
+	},
+	&cli.StringFlag{
+		Name:  "certificate-identity-regexp",
+		Usage: "regular expression the subject of the sigstore signing certificate has to match",
+	},
+	&cli.StringFlag{
+		Name:  "certificate-oidc-issuer",
+		Usage: "expected OIDC issuer of the sigstore signing certificate",
+		Value: sigstore.GitHubActionsIssuer,
+	},
+	&cli.StringFlag{
+		Name:  "trusted-root",
+		Usage: "path to the trusted_root.json of the sigstore instance, defaults to the public instance",
+	},
+}
+
+// hasSigstoreIdentity reports whether any of the identity flags is provided
+func hasSigstoreIdentity(ctx *cli.Context) bool {
+	return ctx.String("certificate-identity") != "" || ctx.String("certificate-identity-regexp") != ""
+}
+
+func getSigstoreVerifier(ctx *cli.Context) (selfupdate.Verifier, error) {
+	root, identity, err := getSigstoreIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return selfupdate.NewSigstoreVerifier(root, identity), nil
+}
+
+// getSigstoreIdentity returns the trusted root and the identity of the sigstore flags
+func getSigstoreIdentity(ctx *cli.Context) (*sigstore.TrustedRoot, sigstore.Identity, error) {
+	if !hasSigstoreIdentity(ctx) {
+		return nil, sigstore.Identity{}, cli.Exit("either --certificate-identity or --certificate-identity-regexp is required", 1)
+	}
+
+	identity := sigstore.Identity{
+		Issuer:  ctx.String("certificate-oidc-issuer"),
+		Subject: ctx.String("certificate-identity"),
+	}
+
+	if expr := ctx.String("certificate-identity-regexp"); expr != "" {
+		subjectRegexp, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, sigstore.Identity{}, err
+		}
+
+		identity.SubjectRegexp = subjectRegexp
+	}
+
+	root := sigstore.PublicGoodTrustedRoot()
+	if path := ctx.String("trusted-root"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, sigstore.Identity{}, err
+		}
+
+		root, err = sigstore.ParseTrustedRoot(data)
+		if err != nil {
+			return nil, sigstore.Identity{}, err
+		}
+	}
+
+	return root, identity, nil
+}
+
+// hashFlag is the digest algorithm of the signed content
+var hashFlag = &cli.StringFlag{
+	Name:  "hash",
+	Usage: "digest algorithm of the content, one of sha256, sha512, blake2b-256 or blake3. Clients older than the hash algorithm support only verify sha256",
+	Value: hash.SHA256.String(),
+}
+
+func getHashAlgorithm(ctx *cli.Context) (hash.Algorithm, error) {
+	algorithm, err := hash.Lookup(ctx.String("hash"))
+	if err != nil {
+		return 0, cli.Exit("unknown hash algorithm: "+ctx.String("hash"), 1)
+	}
+
+	return algorithm, nil
+}
+
+// getVerifier returns a verifier for the public keys, separated by commas, in the
+// given format. A threshold above zero requires a multi-signature envelope, and
+// a binding requires a bound signature.
+func getVerifier(format string, keys string, threshold int, binding *selfupdate.Binding) (selfupdate.Verifier, error) {
+	switch format {
+	case formatHex:
+		keyring, err := crypto.ParseKeyring(keys)
+		if err != nil {
+			return nil, err
+		}
+
+		if threshold > 0 && binding != nil {
+			return nil, cli.Exit("--threshold can't be used with a binding", 1)
+		} else if threshold > 0 {
+			return selfupdate.NewThresholdVerifier(keyring, threshold), nil
+		} else if binding != nil {
+			return selfupdate.NewBindingVerifier(keyring, *binding), nil
+		}
+
+		return selfupdate.NewKeyringVerifier(keyring), nil
+	case formatMinisign:
+		var publicKeys []crypto.MinisignPublicKey
+		for _, key := range strings.Split(keys, ",") {
+			publicKey, err := crypto.ParseMinisignPublicKey(key)
+			if err != nil {
+				return nil, err
+			}
+
+			publicKeys = append(publicKeys, publicKey)
+		}
+
+		return selfupdate.NewMinisignVerifier(publicKeys...), nil
+	}
+
+	return nil, cli.Exit("unknown signature format: "+format, 1)
+}
+
+func newHashSigner(digestSigner crypto.DigestSigner, keyID bool, detached bool, binding *selfupdate.Binding, expiry time.Duration, algorithm hash.Algorithm) selfupdate.Signer {
+	optFns := appendIf(nil, keyID, selfupdate.WithSignerKeyID())
+	optFns = append(optFns, selfupdate.WithSignerHash(algorithm))
+	optFns = appendIf(optFns, detached, selfupdate.WithSignerDetached())
+	optFns = appendIf(optFns, expiry > 0, selfupdate.WithSignerExpiry(expiry))
+
+	if binding != nil {
+		optFns = append(optFns, selfupdate.WithSignerBinding(*binding))
+	}
+
+	return selfupdate.NewDigestSigner(digestSigner, optFns...)
+}
+
+// appendIf appends item to list only if cond is true. It's mostly useful for
+// collecting option functions whose types are not exported.
+func appendIf[T any](list []T, cond bool, item T) []T {
+	if cond {
+		return append(list, item)
+	}
+
+	return list
 }
@@ -1,6 +1,8 @@
 package commands
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -34,6 +36,42 @@ var sharedGithubFlags = []cli.Flag{
 	},
 }
 
+var assetGithubFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "filename",
+		Usage: "filename of the asset, if not provided it will be rendered from --template",
+	},
+	&cli.StringFlag{
+		Name:  "name",
+		Usage: "name of the application, used as {{.Name}} in --template",
+	},
+	&cli.StringFlag{
+		Name:  "template",
+		Usage: "template of the asset filename, e.g. {{.Name}}_{{.Version}}_{{.OS}}_{{.Arch}}{{.ArmVersion}}.tar.gz",
+		Value: selfupdate.DefaultAssetTemplate,
+	},
+	&cli.StringFlag{
+		Name:  "os",
+		Usage: "target operating system used in --template, defaults to the current one",
+	},
+	&cli.StringFlag{
+		Name:  "arch",
+		Usage: "target architecture used in --template, defaults to the current one",
+	},
+	&cli.StringFlag{
+		Name:  "arm",
+		Usage: "target arm version used in --template, e.g. v7",
+	},
+	&cli.StringFlag{
+		Name:  "amd64",
+		Usage: "target amd64 microarchitecture level used in --template, e.g. v3",
+	},
+	&cli.StringFlag{
+		Name:  "libc",
+		Usage: "target libc used in --template, either gnu or musl",
+	},
+}
+
 func githubCmd() *cli.Command {
 	return &cli.Command{
 		Name:  "github",
@@ -48,18 +86,10 @@ func githubCmd() *cli.Command {
 }
 
 func githubCheckCmd() *cli.Command {
-	var githubCheckFlags = []cli.Flag{
-		&cli.StringFlag{
-			Name:     "filename",
-			Usage:    "filename of the binary",
-			Required: true,
-		},
-	}
-
 	return &cli.Command{
 		Name:  "check",
 		Usage: "check if there is a new version",
-		Flags: cli.MergeFlags(sharedGithubFlags, githubCheckFlags),
+		Flags: cli.MergeFlags(sharedGithubFlags, assetGithubFlags),
 		Action: func(ctx *cli.Context) error {
 			owner := ctx.String("owner")
 			repo := ctx.String("repo")
@@ -72,12 +102,24 @@ func githubCheckCmd() *cli.Command {
 				return err
 			}
 
-			newVersion, desc, err := ghClient.Check(ctx.Context, filename, version)
+			newVersion, assetName, desc, err := ghClient.CheckAsset(ctx.Context, version, func(newVersion string) ([]string, error) {
+				if filename != "" {
+					return []string{filename}, nil
+				}
+
+				assetTemplate, err := getAssetTemplate(ctx)
+				if err != nil {
+					return nil, err
+				}
+
+				return assetTemplate.Candidates(newVersion, getAssetPlatform(ctx))
+			})
 			if err != nil {
 				return err
 			}
 
 			fmt.Fprintf(os.Stdout, "new version: %s\n", newVersion)
+			fmt.Fprintf(os.Stdout, "asset: %s\n", assetName)
 			fmt.Fprintf(os.Stdout, "description: %s\n", desc)
 
 			return nil
@@ -140,29 +182,43 @@ func githubReleaseCmd() *cli.Command {
 
 func githubUploadCmd() *cli.Command {
 	var githubUploadFlags = []cli.Flag{
-		&cli.StringFlag{
-			Name:     "filename",
-			Usage:    "filename of the binary",
-			Required: true,
+		&cli.BoolFlag{
+			Name:  "key-id",
+			Usage: "add a header with the key id to the signature, required for verifying with several trusted keys",
+		},
+		&cli.BoolFlag{
+			Name:  "detached",
+			Usage: "upload the content unmodified and its signature as a separate asset with .sig suffix",
+		},
+		&cli.BoolFlag{
+			Name:  "bind",
+			Usage: "bind the signature to --name, --version, --os and --arch, so the asset can't be served as another release",
+		},
+		&cli.DurationFlag{
+			Name:  "expires",
+			Usage: "the signature expires after this duration, it implies a bound signature",
 		},
+		hashFlag,
 		&cli.StringFlag{
-			Name:  "key",
-			Usage: "if provided, it will be used to sign the content before uploading",
+			Name:  "provenance",
+			Usage: "path to the provenance attestations of the content, e.g. written by crypto attest, uploaded as a separate asset with .intoto.jsonl suffix",
 		},
 	}
 
 	return &cli.Command{
 		Name:  "upload",
 		Usage: "upload a new asset to an already created github release",
-		Flags: cli.MergeFlags(sharedGithubFlags, githubUploadFlags),
+		Flags: cli.MergeFlags(sharedGithubFlags, assetGithubFlags, privateKeyFlags, signerFlags, githubUploadFlags),
 		Action: func(ctx *cli.Context) error {
 			owner := ctx.String("owner")
 			repo := ctx.String("repo")
-			filename := ctx.String("filename")
 			version := ctx.String("version")
 			ghToken := ctx.String("token")
 
-			key := ctx.String("key")
+			filename, err := getAssetFilename(ctx, version)
+			if err != nil {
+				return err
+			}
 
 			ghClient, err := getGithubClient(owner, repo, ghToken)
 			if err != nil {
@@ -170,13 +226,35 @@ func githubUploadCmd() *cli.Command {
 			}
 
 			var r io.Reader = os.Stdin
-			if key != "" {
-				privateKey, err := crypto.ParsePrivateKey(key)
+			if hasSigner(ctx) {
+				digestSigner, keyID, err := getDigestSigner(ctx)
 				if err != nil {
 					return err
 				}
 
-				r = selfupdate.NewHashSigner(privateKey).Sign(ctx.Context, r)
+				algorithm, err := getHashAlgorithm(ctx)
+				if err != nil {
+					return err
+				}
+
+				binding := getGithubBinding(ctx, filename, version)
+
+				if ctx.Bool("detached") {
+					content, err := io.ReadAll(r)
+					if err != nil {
+						return err
+					}
+
+					signer := newHashSigner(digestSigner, keyID, true, binding, ctx.Duration("expires"), algorithm)
+					err = ghClient.Upload(ctx.Context, filename+selfupdate.DefaultDetachedSuffix, version, signer.Sign(ctx.Context, bytes.NewReader(content)))
+					if err != nil {
+						return err
+					}
+
+					r = bytes.NewReader(content)
+				} else {
+					r = newHashSigner(digestSigner, keyID, false, binding, ctx.Duration("expires"), algorithm).Sign(ctx.Context, r)
+				}
 			}
 
 			err = ghClient.Upload(ctx.Context, filename, version, r)
@@ -184,6 +262,19 @@ func githubUploadCmd() *cli.Command {
 				return err
 			}
 
+			if path := ctx.String("provenance"); path != "" {
+				attestations, err := os.Open(path)
+				if err != nil {
+					return err
+				}
+				defer attestations.Close()
+
+				err = ghClient.Upload(ctx.Context, filename+selfupdate.DefaultProvenanceSuffix, version, attestations)
+				if err != nil {
+					return err
+				}
+			}
+
 			return nil
 		},
 	}
@@ -191,53 +282,85 @@ func githubUploadCmd() *cli.Command {
 
 func githubDownloadCmd() *cli.Command {
 	var githubDownloadFlags = []cli.Flag{
-		&cli.StringFlag{
-			Name:     "filename",
-			Usage:    "filename of the binary",
-			Required: true,
-		},
 		&cli.StringFlag{
 			Name:  "key",
-			Usage: "if provided it will be used to verify the content after downloading",
+			Usage: "if provided it will be used to verify the content after downloading, multiple keys can be separated by commas",
+		},
+		&cli.BoolFlag{
+			Name:  "detached",
+			Usage: "download the detached signature from the asset with .sig suffix and verify the content with it",
+		},
+		&cli.BoolFlag{
+			Name:  "bind",
+			Usage: "require the signature to be bound to --name, --version, --os and --arch",
 		},
 	}
 
 	return &cli.Command{
 		Name:  "download",
 		Usage: "download a file from github release's asset",
-		Flags: cli.MergeFlags(sharedGithubFlags, githubDownloadFlags),
+		Flags: cli.MergeFlags(sharedGithubFlags, assetGithubFlags, githubDownloadFlags, sigstoreFlags, provenanceFlags),
 		Action: func(ctx *cli.Context) error {
 			owner := ctx.String("owner")
 			repo := ctx.String("repo")
-			filename := ctx.String("filename")
 			version := ctx.String("version")
 			ghToken := ctx.String("token")
 
 			key := ctx.String("key")
 
+			filename, err := getAssetFilename(ctx, version)
+			if err != nil {
+				return err
+			}
+
 			ghClient, err := getGithubClient(owner, repo, ghToken)
 			if err != nil {
 				return err
 			}
 
-			rc := ghClient.Download(ctx.Context, filename, version)
+			var downloader selfupdate.Downloader = ghClient
+			if hasSigstoreIdentity(ctx) {
+				downloader = selfupdate.NewDetachedDownloader(ghClient, selfupdate.DefaultSigstoreSuffix)
+			} else if key != "" && ctx.Bool("detached") {
+				downloader = selfupdate.NewDetachedDownloader(ghClient, selfupdate.DefaultDetachedSuffix)
+			}
+
+			rc := downloader.Download(ctx.Context, filename, version)
 			defer rc.Close()
 
-			var r io.Reader = rc
+			var verifier selfupdate.Verifier = selfupdate.VerifierFunc(func(ctx context.Context, r io.Reader) io.Reader {
+				return r
+			})
 
-			if key != "" {
-				publicKey, err := crypto.ParsePublicKey(key)
+			if hasSigstoreIdentity(ctx) {
+				verifier, err = getSigstoreVerifier(ctx)
+				if err != nil {
+					return err
+				}
+			} else if key != "" {
+				keyring, err := crypto.ParseKeyring(key)
 				if err != nil {
 					return err
 				}
 
-				r = selfupdate.NewHashVerifier(publicKey).Verify(ctx.Context, r)
+				if binding := getGithubBinding(ctx, filename, version); binding != nil {
+					verifier = selfupdate.NewBindingVerifier(keyring, *binding)
+				} else {
+					verifier = selfupdate.NewKeyringVerifier(keyring)
+				}
+			}
+
+			if hasProvenancePolicy(ctx) {
+				attestations := ghClient.Download(ctx.Context, filename+selfupdate.DefaultProvenanceSuffix, version)
+				defer attestations.Close()
+
+				verifier, err = getProvenanceVerifier(ctx, verifier, attestations)
 				if err != nil {
 					return err
 				}
 			}
 
-			_, err = io.Copy(os.Stdout, r)
+			_, err = io.Copy(os.Stdout, verifier.Verify(ctx.Context, rc))
 			if err != nil {
 				return err
 			}
@@ -254,3 +377,74 @@ func getGithubClient(owner string, repo string, token string) (*selfupdate.Githu
 
 	return selfupdate.NewGithub(token, owner, repo), nil
 }
+
+func getAssetTemplate(ctx *cli.Context) (*selfupdate.AssetTemplate, error) {
+	name := ctx.String("name")
+	if name == "" {
+		return nil, cli.Exit("either --filename or --name must be provided", 1)
+	}
+
+	return selfupdate.NewAssetTemplate(name, ctx.String("template"))
+}
+
+func getAssetPlatform(ctx *cli.Context) selfupdate.Platform {
+	platform := selfupdate.CurrentPlatform()
+
+	if ctx.IsSet("os") {
+		platform.OS = ctx.String("os")
+	}
+	if ctx.IsSet("arch") {
+		platform.Arch = ctx.String("arch")
+		// the detected variants belong to the current architecture only
+		platform.ArmVersion = ""
+		platform.Amd64Version = ""
+	}
+	if ctx.IsSet("arm") {
+		platform.ArmVersion = ctx.String("arm")
+	}
+	if ctx.IsSet("amd64") {
+		platform.Amd64Version = ctx.String("amd64")
+	}
+	if ctx.IsSet("libc") {
+		platform.Libc = ctx.String("libc")
+	} else if platform.OS != "linux" {
+		platform.Libc = ""
+	}
+
+	return platform
+}
+
+func getAssetFilename(ctx *cli.Context, version string) (string, error) {
+	if filename := ctx.String("filename"); filename != "" {
+		return filename, nil
+	}
+
+	assetTemplate, err := getAssetTemplate(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return assetTemplate.Name(version, getAssetPlatform(ctx))
+}
+
+// getGithubBinding returns the binding of the asset if --bind is set. The app
+// is --name, or the filename if there is no name.
+func getGithubBinding(ctx *cli.Context, filename string, version string) *selfupdate.Binding {
+	if !ctx.Bool("bind") {
+		return nil
+	}
+
+	app := ctx.String("name")
+	if app == "" {
+		app = filename
+	}
+
+	platform := getAssetPlatform(ctx)
+
+	return &selfupdate.Binding{
+		App:     app,
+		Version: version,
+		OS:      platform.OS,
+		Arch:    platform.Arch,
+	}
+}
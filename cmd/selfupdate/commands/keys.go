@@ -0,0 +1,219 @@
+package commands
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"selfupdate.blockthrough.com/pkg/cli"
+	"selfupdate.blockthrough.com/pkg/crypto"
+	"selfupdate.blockthrough.com/pkg/terminal"
+)
+
+const (
+	// defaultPassphraseEnv is used to encrypt and decrypt private keys, if it's
+	// not set, the passphrase is prompted on the terminal
+	defaultPassphraseEnv = "SELFUPDATE_PASSPHRASE"
+)
+
+// privateKeyFlags are shared by every command which needs a private key. Passing
+// the content of the key with --key is supported, but it ends up in shell
+// history and ps output, so --key-file and --key-env should be preferred.
+var privateKeyFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "key",
+		Usage: "content of the private key, prefer --key-file or --key-env since arguments are visible to other processes",
+	},
+	&cli.StringFlag{
+		Name:  "key-file",
+		Usage: "path to the private key file",
+	},
+	&cli.StringFlag{
+		Name:  "key-env",
+		Usage: "name of the environment variable which holds the content of the private key",
+	},
+	&cli.StringFlag{
+		Name:  "key-name",
+		Usage: "name of a key generated by 'crypto keys --name', read from KEY-DIR/KEY-NAME.key",
+	},
+	&cli.StringFlag{
+		Name:  "key-dir",
+		Usage: "directory to read named keys from",
+		Value: ".",
+	},
+	&cli.StringFlag{
+		Name:  "passphrase-env",
+		Usage: "name of the environment variable which holds the passphrase of an encrypted private key, if it's not set the passphrase is prompted",
+		Value: defaultPassphraseEnv,
+	},
+}
+
+// signerFlags let commands which sign content use an external signer instead
+// of a private key, please refer to getDigestSigner
+var signerFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "signer",
+		Usage: "external signer, either a uri of a registered provider, e.g. pkcs11:..., or a command which reads the digest from stdin and writes the signature to stdout",
+	},
+	&cli.StringFlag{
+		Name:  "signer-public-key",
+		Usage: "public key of the external signer command, required with a --signer command",
+	},
+	&cli.StringFlag{
+		Name:  "signer-encoding",
+		Usage: "encoding of the digest and the signature of the --signer command, one of hex, base64 or raw",
+		Value: crypto.EncodingHex,
+	},
+}
+
+// hasPrivateKey reports whether any of the private key flags is provided
+func hasPrivateKey(ctx *cli.Context) bool {
+	return ctx.String("key") != "" || ctx.String("key-file") != "" || ctx.String("key-env") != "" || ctx.String("key-name") != ""
+}
+
+// hasSigner reports whether either a private key or an external signer is provided
+func hasSigner(ctx *cli.Context) bool {
+	return ctx.String("signer") != "" || hasPrivateKey(ctx)
+}
+
+// getDigestSigner returns the external signer provided by --signer, or the
+// private key returned by getPrivateKey. The returned bool reports whether the
+// signature should carry a key id.
+func getDigestSigner(ctx *cli.Context) (crypto.DigestSigner, bool, error) {
+	signer := ctx.String("signer")
+	if signer == "" {
+		return getPrivateKey(ctx)
+	}
+
+	if crypto.HasSignerProvider(signer) {
+		digestSigner, err := crypto.OpenSigner(ctx.Context, signer)
+		return digestSigner, ctx.Bool("key-id"), err
+	}
+
+	args := strings.Fields(signer)
+
+	if ctx.String("signer-public-key") == "" {
+		return nil, false, cli.Exit("--signer-public-key is required with a --signer command", 1)
+	}
+
+	publicKey, err := crypto.ParsePublicKey(ctx.String("signer-public-key"))
+	if err != nil {
+		return nil, false, err
+	}
+
+	digestSigner := crypto.NewCommandSigner(
+		publicKey,
+		args[0],
+		args[1:],
+		crypto.WithCommandSignerEncoding(ctx.String("signer-encoding")),
+	)
+
+	return digestSigner, ctx.Bool("key-id"), nil
+}
+
+// readPrivateKey reads the content of the private key from one of the private
+// key flags. The returned bool reports whether it's a named key.
+func readPrivateKey(ctx *cli.Context) (string, bool, error) {
+	switch {
+	case ctx.String("key-file") != "":
+		data, err := os.ReadFile(ctx.String("key-file"))
+		return strings.TrimSpace(string(data)), false, err
+	case ctx.String("key-env") != "":
+		key, ok := os.LookupEnv(ctx.String("key-env"))
+		if !ok || key == "" {
+			return "", false, cli.Exit("environment variable "+ctx.String("key-env")+" is not set", 1)
+		}
+		return strings.TrimSpace(key), false, nil
+	case ctx.String("key-name") != "":
+		data, err := os.ReadFile(filepath.Join(ctx.String("key-dir"), ctx.String("key-name")+".key"))
+		return strings.TrimSpace(string(data)), true, err
+	case ctx.String("key") != "":
+		return ctx.String("key"), false, nil
+	}
+
+	return "", false, cli.Exit("one of --key-file, --key-env, --key-name or --key must be provided", 1)
+}
+
+// getPrivateKey parses the private key returned by readPrivateKey, and asks for
+// the passphrase if it's encrypted. The returned bool reports whether the
+// signature should carry a key id.
+func getPrivateKey(ctx *cli.Context) (crypto.PrivateKey, bool, error) {
+	key, named, err := readPrivateKey(ctx)
+	if err != nil {
+		return crypto.PrivateKey{}, false, err
+	}
+
+	privateKey, err := parsePrivateKey(ctx, key)
+	return privateKey, named || ctx.Bool("key-id"), err
+}
+
+// parsePrivateKey parses the private key, and asks for the passphrase if it's
+// encrypted
+func parsePrivateKey(ctx *cli.Context, key string) (crypto.PrivateKey, error) {
+	privateKey, err := crypto.ParsePrivateKeyWithPassphrase(key, "")
+	if !errors.Is(err, crypto.ErrPassphraseRequired) {
+		return privateKey, err
+	}
+
+	passphrase, err := getPassphrase(ctx, false)
+	if err != nil {
+		return crypto.PrivateKey{}, err
+	}
+
+	return crypto.ParsePrivateKeyWithPassphrase(key, passphrase)
+}
+
+func getMinisignPrivateKey(ctx *cli.Context) (crypto.MinisignPrivateKey, error) {
+	key, _, err := readPrivateKey(ctx)
+	if err != nil {
+		return crypto.MinisignPrivateKey{}, err
+	}
+
+	privateKey, err := crypto.ParseMinisignPrivateKey(key, "")
+	if errors.Is(err, crypto.ErrMinisignPassphraseNeeded) {
+		passphrase, err := getPassphrase(ctx, false)
+		if err != nil {
+			return crypto.MinisignPrivateKey{}, err
+		}
+
+		return crypto.ParseMinisignPrivateKey(key, passphrase)
+	}
+
+	return privateKey, err
+}
+
+// getPassphrase reads the passphrase from the environment variable named by
+// --passphrase-env, or prompts for it. New passphrases are prompted twice.
+func getPassphrase(ctx *cli.Context, confirm bool) (string, error) {
+	name := ctx.String("passphrase-env")
+	if name == "" {
+		name = defaultPassphraseEnv
+	}
+
+	if passphrase, ok := os.LookupEnv(name); ok && passphrase != "" {
+		return passphrase, nil
+	}
+
+	passphrase, err := terminal.ReadPassword("Enter passphrase: ")
+	if errors.Is(err, terminal.ErrNotTerminal) {
+		return "", cli.Exit("passphrase is required, set "+name+" or run in a terminal", 1)
+	} else if err != nil {
+		return "", err
+	}
+
+	if !confirm {
+		return passphrase, nil
+	}
+
+	again, err := terminal.ReadPassword("Enter passphrase again: ")
+	if err != nil {
+		return "", err
+	}
+
+	if passphrase != again {
+		return "", cli.Exit("passphrases do not match", 1)
+	}
+
+	return passphrase, nil
+}
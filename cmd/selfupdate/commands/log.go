@@ -0,0 +1,142 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"selfupdate.blockthrough.com/pkg/auditlog"
+	"selfupdate.blockthrough.com/pkg/cli"
+)
+
+var logFileFlag = &cli.StringFlag{
+	Name:     "file",
+	Usage:    "path to the update log, the one passed to selfupdate.WithAutoLog",
+	Required: true,
+}
+
+func logCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "log",
+		Usage: "inspect the hash-chained update log written by the client",
+		Subcommands: []*cli.Command{
+			logVerifyCmd(),
+			logShowCmd(),
+		},
+	}
+}
+
+func logVerifyCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "verify",
+		Usage: "check the chain of the update log and print the hash of the last entry, keep it elsewhere to detect removed entries",
+		Flags: []cli.Flag{
+			logFileFlag,
+			&cli.StringFlag{
+				Name:  "head",
+				Usage: "hash of an entry printed by a previous verify, which must still be in the log",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			entries, err := readLog(ctx.String("file"))
+			if err != nil {
+				return err
+			}
+
+			if err := auditlog.Verify(entries); err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+
+			if head := ctx.String("head"); head != "" && !containsHash(entries, head) {
+				return cli.Exit(fmt.Sprintf("%s: entry %s is missing", auditlog.ErrChainBroken, head), 1)
+			}
+
+			if len(entries) == 0 {
+				fmt.Fprintln(os.Stdout, "log is empty")
+				return nil
+			}
+
+			fmt.Fprintf(os.Stdout, "entries: %d\n", len(entries))
+			fmt.Fprintf(os.Stdout, "head: %s\n", entries[len(entries)-1].Hash)
+			return nil
+		},
+	}
+}
+
+func logShowCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "show",
+		Usage: "print the entries of the update log",
+		Flags: []cli.Flag{
+			logFileFlag,
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the entries as they are in the log, one JSON entry per line",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			if ctx.Bool("json") {
+				data, err := os.ReadFile(ctx.String("file"))
+				if err != nil {
+					return err
+				}
+
+				_, err = os.Stdout.Write(data)
+				return err
+			}
+
+			entries, err := readLog(ctx.String("file"))
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "SEQ\tTIME\tEVENT\tCURRENT\tNEW\tASSET\tDIGEST\tKEYS\tERROR")
+			for _, entry := range entries {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					entry.Seq,
+					entry.Time.Format(time.RFC3339),
+					entry.Event,
+					orDash(entry.CurrentVersion),
+					orDash(entry.NewVersion),
+					orDash(entry.Asset),
+					orDash(entry.Digest),
+					orDash(strings.Join(entry.KeyIDs, ",")),
+					orDash(entry.Error),
+				)
+			}
+
+			return w.Flush()
+		},
+	}
+}
+
+func readLog(path string) ([]auditlog.Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return auditlog.Read(f)
+}
+
+func containsHash(entries []auditlog.Entry, hash string) bool {
+	for _, entry := range entries {
+		if entry.Hash == hash {
+			return true
+		}
+	}
+
+	return false
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
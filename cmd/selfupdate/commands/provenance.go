@@ -0,0 +1,164 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"selfupdate.blockthrough.com"
+	"selfupdate.blockthrough.com/pkg/cli"
+	"selfupdate.blockthrough.com/pkg/crypto"
+	"selfupdate.blockthrough.com/pkg/dsse"
+	"selfupdate.blockthrough.com/pkg/provenance"
+)
+
+func cryptoAttest() *cli.Command {
+	return &cli.Command{
+		Name:  "attest",
+		Usage: "write a SLSA provenance attestation of the content signed with the private key, the defaults are read from the GitHub Actions environment",
+		Flags: cli.MergeFlags(privateKeyFlags, signerFlags, []cli.Flag{
+			&cli.StringFlag{
+				Name:     "name",
+				Usage:    "name of the attested artifact, usually the asset name",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "builder-id",
+				Usage: "id of the builder, defaults to the running workflow, e.g. https://github.com/owner/repo/.github/workflows/release.yml@refs/tags/v1.0.0",
+			},
+			&cli.StringFlag{
+				Name:  "source-repository",
+				Usage: "repository the content is built from, defaults to the repository of the running workflow",
+			},
+			&cli.StringFlag{
+				Name:    "source-ref",
+				Usage:   "git ref the content is built from",
+				EnvVars: []string{"GITHUB_REF"},
+			},
+			&cli.StringFlag{
+				Name:    "source-commit",
+				Usage:   "git commit the content is built from",
+				EnvVars: []string{"GITHUB_SHA"},
+			},
+		}),
+		Action: func(ctx *cli.Context) error {
+			digestSigner, _, err := getDigestSigner(ctx)
+			if err != nil {
+				return err
+			}
+
+			artifact, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+
+			serverURL := os.Getenv("GITHUB_SERVER_URL")
+
+			prov := provenance.Provenance{
+				BuilderID:        ctx.String("builder-id"),
+				SourceRepository: ctx.String("source-repository"),
+				SourceRef:        ctx.String("source-ref"),
+				SourceCommit:     ctx.String("source-commit"),
+			}
+
+			if workflowRef := os.Getenv("GITHUB_WORKFLOW_REF"); prov.BuilderID == "" && serverURL != "" && workflowRef != "" {
+				prov.BuilderID = serverURL + "/" + workflowRef
+			}
+
+			if repository := os.Getenv("GITHUB_REPOSITORY"); prov.SourceRepository == "" && serverURL != "" && repository != "" {
+				prov.SourceRepository = serverURL + "/" + repository
+			}
+
+			if prov.BuilderID == "" || prov.SourceRepository == "" || prov.SourceRef == "" {
+				return cli.Exit("--builder-id, --source-repository and --source-ref are required outside of GitHub Actions", 1)
+			}
+
+			statement, err := provenance.NewStatement(ctx.String("name"), artifact, prov)
+			if err != nil {
+				return err
+			}
+
+			payload, err := json.Marshal(statement)
+			if err != nil {
+				return err
+			}
+
+			envelope, err := dsse.Sign(ctx.Context, dsse.PayloadTypeInToto, payload, digestSigner)
+			if err != nil {
+				return err
+			}
+
+			data, err := json.Marshal(envelope)
+			if err != nil {
+				return err
+			}
+
+			_, err = fmt.Fprintln(os.Stdout, string(data))
+			return err
+		},
+	}
+}
+
+// provenanceFlags are the policy the provenance of a downloaded asset must
+// satisfy, please refer to provenance.Policy
+var provenanceFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "provenance-builder-id",
+		Usage: "require a provenance attestation, uploaded with the .intoto.jsonl suffix, with this builder id",
+	},
+	&cli.StringFlag{
+		Name:  "provenance-source-repository",
+		Usage: "require a provenance attestation of a build of this repository, e.g. https://github.com/owner/repo",
+	},
+	&cli.StringFlag{
+		Name:  "provenance-source-ref",
+		Usage: "require a provenance attestation of a build of a git ref matching this regular expression, e.g. ^refs/tags/",
+	},
+}
+
+// hasProvenancePolicy reports whether any of the provenance flags is provided
+func hasProvenancePolicy(ctx *cli.Context) bool {
+	return ctx.String("provenance-builder-id") != "" || ctx.String("provenance-source-repository") != "" || ctx.String("provenance-source-ref") != ""
+}
+
+// getProvenanceVerifier wraps verifier with the provenance check of the
+// attestations. They are verified with the public keys of --key, or with the
+// sigstore identity if there are none.
+func getProvenanceVerifier(ctx *cli.Context, verifier selfupdate.Verifier, attestations io.Reader) (selfupdate.Verifier, error) {
+	policy := provenance.Policy{
+		BuilderID:        ctx.String("provenance-builder-id"),
+		SourceRepository: ctx.String("provenance-source-repository"),
+	}
+
+	if expr := ctx.String("provenance-source-ref"); expr != "" {
+		sourceRef, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+
+		policy.SourceRef = sourceRef
+	}
+
+	var attestationVerifier provenance.Verifier
+	if key := ctx.String("key"); key != "" {
+		keyring, err := crypto.ParseKeyring(key)
+		if err != nil {
+			return nil, err
+		}
+
+		attestationVerifier = provenance.NewKeyringVerifier(keyring)
+	} else if hasSigstoreIdentity(ctx) {
+		root, identity, err := getSigstoreIdentity(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		attestationVerifier = provenance.NewSigstoreVerifier(root, identity)
+	} else {
+		return nil, cli.Exit("either --key or a sigstore identity is required to verify the provenance", 1)
+	}
+
+	return selfupdate.NewProvenanceVerifier(verifier, attestations, attestationVerifier, policy), nil
+}
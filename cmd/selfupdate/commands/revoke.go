@@ -0,0 +1,183 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"selfupdate.blockthrough.com"
+	"selfupdate.blockthrough.com/pkg/cli"
+	"selfupdate.blockthrough.com/pkg/dsse"
+	"selfupdate.blockthrough.com/pkg/fileutil"
+)
+
+func revokeCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "revoke",
+		Usage: "add a version, an asset or a key to the signed revocation list and publish it to the latest release, without an entry the list is only signed and published again",
+		Flags: cli.MergeFlags(privateKeyFlags, signerFlags, []cli.Flag{
+			&cli.StringFlag{
+				Name:  "list",
+				Usage: "path to the revocation list, the previous entries are read from it and the new list is written to it",
+				Value: selfupdate.DefaultRevocationsAsset,
+			},
+			&cli.StringFlag{
+				Name:  "version",
+				Usage: "version to revoke",
+			},
+			&cli.StringFlag{
+				Name:  "digest",
+				Usage: "digest of the asset content to revoke, e.g. sha256:<hex> as recorded in the update log",
+			},
+			&cli.StringFlag{
+				Name:  "file",
+				Usage: "path to the asset content to revoke, e.g. the unsigned binary, its digest is revoked",
+			},
+			&cli.StringFlag{
+				Name:  "revoke-key-id",
+				Usage: "id of the key to revoke as printed by 'crypto keys', or the uppercase id of a minisign key, releases signed by it are refused",
+			},
+			&cli.StringFlag{
+				Name:  "successor",
+				Usage: "version clients running the revoked --version should move to, if the latest version is revoked too",
+			},
+			&cli.StringFlag{
+				Name:  "reason",
+				Usage: "reason of the revocation, which is shown to clients",
+			},
+			&cli.StringFlag{
+				Name:  "owner",
+				Usage: "owner of the repository, the list is published if it's provided",
+			},
+			&cli.StringFlag{
+				Name:  "repo",
+				Usage: "name of the repository",
+			},
+			&cli.StringFlag{
+				Name:    "token",
+				Usage:   "github repo token, usually provided by github action as GITHUB_TOKEN env",
+				EnvVars: []string{"GITHUB_TOKEN"},
+			},
+		}),
+		Action: func(ctx *cli.Context) error {
+			digestSigner, _, err := getDigestSigner(ctx)
+			if err != nil {
+				return err
+			}
+
+			path := ctx.String("list")
+
+			revocations, err := readRevocations(path)
+			if err != nil {
+				return err
+			}
+
+			// clients refuse a list older than the one they have seen
+			revocations.Serial++
+
+			entry := selfupdate.Revocation{
+				Version:   ctx.String("version"),
+				Digest:    ctx.String("digest"),
+				KeyID:     ctx.String("revoke-key-id"),
+				Successor: ctx.String("successor"),
+				Reason:    ctx.String("reason"),
+				Revoked:   time.Now().UTC().Truncate(time.Second),
+			}
+
+			if file := ctx.String("file"); file != "" {
+				content, err := os.ReadFile(file)
+				if err != nil {
+					return err
+				}
+
+				entry.Digest = selfupdate.RevocationDigest(content)
+			}
+
+			// each entry revokes one thing, so the reason of every one is shown
+			for _, revoked := range []selfupdate.Revocation{
+				{Version: entry.Version, Successor: entry.Successor},
+				{Digest: entry.Digest},
+				{KeyID: entry.KeyID},
+			} {
+				if revoked.Version == "" && revoked.Digest == "" && revoked.KeyID == "" {
+					continue
+				}
+
+				revoked.Reason = entry.Reason
+				revoked.Revoked = entry.Revoked
+				revocations.Entries = append(revocations.Entries, revoked)
+
+				fmt.Fprintf(os.Stderr, "revoked: %s\n", revoked)
+			}
+
+			// clients refuse a list signed only by a key it revokes
+			if revocations.KeyRevoked(digestSigner.Public().ID().String()) {
+				return cli.Exit("the signing key is revoked by the list, sign it with another key", 1)
+			}
+
+			data, err := selfupdate.SignRevocations(ctx.Context, *revocations, digestSigner)
+			if err != nil {
+				return err
+			}
+
+			if err := fileutil.WriteAtomic(path, data, 0644); err != nil {
+				return err
+			}
+
+			owner := ctx.String("owner")
+			if owner == "" {
+				return nil
+			}
+
+			ghClient, err := getGithubClient(owner, ctx.String("repo"), ctx.String("token"))
+			if err != nil {
+				return err
+			}
+
+			latest, err := ghClient.LatestVersion(ctx.Context)
+			if err != nil {
+				return err
+			}
+
+			if err := ghClient.Upload(ctx.Context, selfupdate.DefaultRevocationsAsset, latest, bytes.NewReader(data)); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(os.Stderr, "published %d revocations to %s\n", len(revocations.Entries), latest)
+
+			return nil
+		},
+	}
+}
+
+// readRevocations reads the entries of the previous list without verifying it,
+// since it may be signed by a key which was rotated since
+func readRevocations(path string) (*selfupdate.Revocations, error) {
+	var revocations selfupdate.Revocations
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &revocations, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	envelope, err := dsse.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if envelope.PayloadType != selfupdate.PayloadTypeRevocations {
+		return nil, selfupdate.ErrRevocationsInvalid
+	}
+
+	if err := json.Unmarshal(envelope.Payload, &revocations); err != nil {
+		return nil, err
+	}
+
+	return &revocations, nil
+}
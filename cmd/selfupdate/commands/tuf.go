@@ -0,0 +1,250 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"selfupdate.blockthrough.com/pkg/cli"
+	"selfupdate.blockthrough.com/pkg/crypto"
+	"selfupdate.blockthrough.com/pkg/fileutil"
+	"selfupdate.blockthrough.com/pkg/tuf"
+)
+
+var sharedTUFFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "metadata-dir",
+		Usage: "directory of the metadata, the previous metadata is read from it to bump the versions",
+		Value: ".",
+	},
+	&cli.StringFlag{
+		Name:  "timestamp-key-file",
+		Usage: "path to a separate private key for the timestamp role, which is usually kept online, defaults to the main key",
+	},
+	&cli.DurationFlag{
+		Name:  "timestamp-expires",
+		Usage: "the timestamp metadata must be re-signed with 'tuf timestamp' before it expires, or clients refuse to update",
+		Value: 7 * 24 * time.Hour,
+	},
+}
+
+func tufCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "tuf",
+		Usage: "publish signed TUF metadata, so clients refuse rollbacks to older versions and stale metadata",
+		Subcommands: []*cli.Command{
+			tufPublishCmd(),
+			tufTimestampCmd(),
+		},
+	}
+}
+
+func tufPublishCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "publish",
+		Usage: "write the targets, snapshot and timestamp metadata of a new release, the files should be uploaded to the release",
+		Flags: cli.MergeFlags(privateKeyFlags, signerFlags, sharedTUFFlags, []cli.Flag{
+			&cli.StringFlag{
+				Name:     "dir",
+				Usage:    "directory which contains the release assets, every file becomes a target",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "version",
+				Usage:    "version of the release",
+				Required: true,
+			},
+			&cli.DurationFlag{
+				Name:  "expires",
+				Usage: "expiry of the targets and snapshot metadata",
+				Value: 90 * 24 * time.Hour,
+			},
+		}),
+		Action: func(ctx *cli.Context) error {
+			signer, _, err := getDigestSigner(ctx)
+			if err != nil {
+				return err
+			}
+
+			timestampSigner, err := getTimestampSigner(ctx, signer)
+			if err != nil {
+				return err
+			}
+
+			metadataDir := ctx.String("metadata-dir")
+
+			var previous tuf.Targets
+			if err := readMetadata(metadataDir, tuf.RoleTargets, &previous); err != nil {
+				return err
+			}
+
+			entries, err := os.ReadDir(ctx.String("dir"))
+			if err != nil {
+				return err
+			}
+
+			targets := tuf.Targets{
+				Common: tuf.Common{
+					Type:    tuf.RoleTargets,
+					Version: previous.Version + 1,
+					Expires: time.Now().Add(ctx.Duration("expires")).UTC().Truncate(time.Second),
+				},
+				Targets: map[string]tuf.TargetFile{},
+			}
+
+			for _, entry := range entries {
+				if !entry.Type().IsRegular() {
+					continue
+				}
+
+				data, err := os.ReadFile(filepath.Join(ctx.String("dir"), entry.Name()))
+				if err != nil {
+					return err
+				}
+
+				targets.Targets[entry.Name()] = tuf.NewTargetFile(ctx.String("version"), data)
+			}
+
+			targetsData, err := tuf.Sign(ctx.Context, targets, signer)
+			if err != nil {
+				return err
+			}
+
+			var previousSnapshot tuf.Snapshot
+			if err := readMetadata(metadataDir, tuf.RoleSnapshot, &previousSnapshot); err != nil {
+				return err
+			}
+
+			snapshot := tuf.Snapshot{
+				Common: tuf.Common{
+					Type:    tuf.RoleSnapshot,
+					Version: previousSnapshot.Version + 1,
+					Expires: targets.Expires,
+				},
+				Meta: map[string]tuf.MetaFile{
+					tuf.Filename(tuf.RoleTargets): tuf.NewMetaFile(targets.Version, targetsData),
+				},
+			}
+
+			snapshotData, err := tuf.Sign(ctx.Context, snapshot, signer)
+			if err != nil {
+				return err
+			}
+
+			if err := writeMetadata(metadataDir, tuf.RoleTargets, targetsData); err != nil {
+				return err
+			}
+
+			if err := writeMetadata(metadataDir, tuf.RoleSnapshot, snapshotData); err != nil {
+				return err
+			}
+
+			return signTimestamp(ctx, timestampSigner, snapshot.Version, snapshotData)
+		},
+	}
+}
+
+func tufTimestampCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "timestamp",
+		Usage: "re-sign the timestamp metadata of the current snapshot, it should be run more often than --timestamp-expires",
+		Flags: cli.MergeFlags(privateKeyFlags, signerFlags, sharedTUFFlags),
+		Action: func(ctx *cli.Context) error {
+			var signer crypto.DigestSigner
+			if ctx.String("timestamp-key-file") == "" {
+				var err error
+				signer, _, err = getDigestSigner(ctx)
+				if err != nil {
+					return err
+				}
+			}
+
+			timestampSigner, err := getTimestampSigner(ctx, signer)
+			if err != nil {
+				return err
+			}
+
+			snapshotData, err := os.ReadFile(filepath.Join(ctx.String("metadata-dir"), tuf.Filename(tuf.RoleSnapshot)))
+			if err != nil {
+				return err
+			}
+
+			var snapshot tuf.Snapshot
+			if err := tuf.Decode(snapshotData, &snapshot); err != nil {
+				return err
+			}
+
+			return signTimestamp(ctx, timestampSigner, snapshot.Version, snapshotData)
+		},
+	}
+}
+
+func getTimestampSigner(ctx *cli.Context, signer crypto.DigestSigner) (crypto.DigestSigner, error) {
+	path := ctx.String("timestamp-key-file")
+	if path == "" {
+		return signer, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePrivateKey(ctx, string(data))
+}
+
+func signTimestamp(ctx *cli.Context, signer crypto.DigestSigner, snapshotVersion int64, snapshotData []byte) error {
+	metadataDir := ctx.String("metadata-dir")
+
+	var previous tuf.Timestamp
+	if err := readMetadata(metadataDir, tuf.RoleTimestamp, &previous); err != nil {
+		return err
+	}
+
+	timestamp := tuf.Timestamp{
+		Common: tuf.Common{
+			Type:    tuf.RoleTimestamp,
+			Version: previous.Version + 1,
+			Expires: time.Now().Add(ctx.Duration("timestamp-expires")).UTC().Truncate(time.Second),
+		},
+		Meta: map[string]tuf.MetaFile{
+			tuf.Filename(tuf.RoleSnapshot): tuf.NewMetaFile(snapshotVersion, snapshotData),
+		},
+	}
+
+	timestampData, err := tuf.Sign(ctx.Context, timestamp, signer)
+	if err != nil {
+		return err
+	}
+
+	if err := writeMetadata(metadataDir, tuf.RoleTimestamp, timestampData); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "timestamp version %d expires at %s\n", timestamp.Version, timestamp.Expires.Format(time.RFC3339))
+
+	return nil
+}
+
+// readMetadata decodes the previous metadata of the role, if there is any
+func readMetadata(dir string, role string, payload any) error {
+	data, err := os.ReadFile(filepath.Join(dir, tuf.Filename(role)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return tuf.Decode(data, payload)
+}
+
+func writeMetadata(dir string, role string, data []byte) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	return fileutil.WriteAtomic(filepath.Join(dir, tuf.Filename(role)), data, 0644)
+}
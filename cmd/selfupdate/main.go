@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"selfupdate.blockthrough.com"
 	"selfupdate.blockthrough.com/cmd/selfupdate/commands"
@@ -48,5 +49,7 @@ func runUpdate() {
 		"selfupdate",         // Executable Name,
 		ghToken,              // Github Token
 		PublicKey,            // Public Key
+		// check at most once a day, so most commands start right away
+		selfupdate.WithAutoThrottle(24*time.Hour),
 	)
 }
@@ -0,0 +1,92 @@
+package selfupdate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"selfupdate.blockthrough.com/pkg/state"
+	"selfupdate.blockthrough.com/pkg/terminal"
+)
+
+// the answers to the confirmation of an update, please refer to
+// WithAutoConfirm
+const (
+	ConfirmYes  = "yes"
+	ConfirmNo   = "no"
+	ConfirmSkip = "skip"
+)
+
+var (
+	ErrSkipped         = errors.New("version is skipped")
+	ErrConfirmFallback = errors.New("confirmation fallback is not one of yes, no and skip")
+)
+
+// confirm shows the new version and its release notes and asks whether to
+// update, if stdin and stderr are terminals. Otherwise, the fallback answer
+// is returned. Skipped versions are remembered in the state file.
+func (u *Updater) confirm(update *Update) bool {
+	answer := u.opts.confirmFallback
+	if u.opts.readLine != nil {
+		answer = u.ask(update)
+	}
+
+	if answer == ConfirmSkip {
+		err := u.state.Update(func(s *state.State) {
+			if !slices.Contains(s.Skipped, update.Version) {
+				s.Skipped = append(s.Skipped, update.Version)
+			}
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("failed to save the update state: %s", err.Error()))
+		}
+	}
+
+	return answer == ConfirmYes
+}
+
+func (u *Updater) ask(update *Update) string {
+	fmt.Fprintf(os.Stderr, "a new version of %s is available: %s -> %s\n", u.filename, u.currentVersion, update.Version)
+
+	if notes := terminal.RenderMarkdown(update.Notes, "  "); notes != "" {
+		fmt.Fprintf(os.Stderr, "\n%s\n\n", notes)
+	}
+
+	for {
+		line, err := u.opts.readLine("update now? [Y/n/skip this version] ")
+		if err != nil {
+			return u.opts.confirmFallback
+		}
+
+		if answer, ok := parseAnswer(line); ok {
+			return answer
+		}
+	}
+}
+
+// parseAnswer returns the answer typed at the confirmation, an empty line
+// accepts the update
+func parseAnswer(line string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "", "y", "yes":
+		return ConfirmYes, true
+	case "n", "no":
+		return ConfirmNo, true
+	case "s", "skip", "skip this version":
+		return ConfirmSkip, true
+	}
+
+	return "", false
+}
+
+// skipped reports whether the version was skipped at a confirmation
+func (u *Updater) skipped(version string) bool {
+	if u.state == nil {
+		return false
+	}
+
+	s, err := u.state.Load()
+	return err == nil && slices.Contains(s.Skipped, version)
+}
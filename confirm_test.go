@@ -0,0 +1,155 @@
+package selfupdate_test
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"selfupdate.blockthrough.com"
+	"selfupdate.blockthrough.com/pkg/terminal"
+)
+
+// lineReader reads the answers from input like the terminal would, it counts
+// the prompts
+func lineReader(input string, prompts *int) func(prompt string) (string, error) {
+	r := bufio.NewReader(strings.NewReader(input))
+	return func(prompt string) (string, error) {
+		*prompts++
+
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimSuffix(line, "\n"), nil
+	}
+}
+
+func TestAutoConfirm(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake binaries are shell scripts")
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		fallback string
+		prompts  int
+		update   bool
+		skipped  bool
+	}{
+		{"enter", "\n", selfupdate.ConfirmNo, 1, true, false},
+		{"y", "y\n", selfupdate.ConfirmNo, 1, true, false},
+		{"yes", " YES\r\n", selfupdate.ConfirmNo, 1, true, false},
+		{"n", "n\n", selfupdate.ConfirmYes, 1, false, false},
+		{"no", "No\n", selfupdate.ConfirmYes, 1, false, false},
+		{"s", "s\n", selfupdate.ConfirmNo, 1, false, true},
+		{"skip", "skip\n", selfupdate.ConfirmNo, 1, false, true},
+		{"skip this version", "skip this version\n", selfupdate.ConfirmNo, 1, false, true},
+		{"asked again", "maybe\nyes please\ny\n", selfupdate.ConfirmNo, 3, true, false},
+		{"closed terminal", "", selfupdate.ConfirmSkip, 1, false, true},
+		{"closed after invalid answer", "later\n", selfupdate.ConfirmYes, 2, true, false},
+	}
+
+	for _, tt := range tests {
+		app := newTestApp(t)
+		app.publish(t, "v1.1.0", "")
+
+		prompts := 0
+		update := app.auto(selfupdate.WithAutoConfirm(tt.fallback), selfupdate.WithAutoReadLine(lineReader(tt.input, &prompts)))
+
+		if prompts != tt.prompts {
+			t.Errorf("%s: expected %d prompts but got %d", tt.name, tt.prompts, prompts)
+		}
+
+		if update != tt.update {
+			t.Errorf("%s: expected update %v but got %v", tt.name, tt.update, update)
+		}
+
+		if skipped := slices.Contains(app.state(t).Skipped, "v1.1.0"); skipped != tt.skipped {
+			t.Errorf("%s: expected skipped %v but got %v", tt.name, tt.skipped, skipped)
+		}
+	}
+}
+
+func TestAutoConfirmSkip(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake binaries are shell scripts")
+	}
+
+	app := newTestApp(t)
+	app.publish(t, "v1.1.0", "")
+
+	prompts := 0
+	if app.auto(selfupdate.WithAutoConfirm(selfupdate.ConfirmNo), selfupdate.WithAutoReadLine(lineReader("skip\n", &prompts))) {
+		t.Fatal("expected the skipped version not to be installed")
+	}
+
+	// a skipped version isn't offered again
+	if app.auto(selfupdate.WithAutoConfirm(selfupdate.ConfirmNo), selfupdate.WithAutoReadLine(lineReader("y\n", &prompts))) {
+		t.Fatal("expected the skipped version not to be installed")
+	}
+
+	if prompts != 1 {
+		t.Fatalf("expected the skipped version not to be offered again, got %d prompts", prompts)
+	}
+
+	// but a newer one is
+	app.publish(t, "v1.2.0", "")
+
+	if !app.auto(selfupdate.WithAutoConfirm(selfupdate.ConfirmNo), selfupdate.WithAutoReadLine(lineReader("y\n", &prompts))) {
+		t.Fatal("expected the newer version to be installed")
+	}
+
+	if skipped := app.state(t).Skipped; !slices.Equal(skipped, []string{"v1.1.0"}) {
+		t.Fatalf("expected only v1.1.0 to be skipped but got %v", skipped)
+	}
+}
+
+func TestAutoConfirmFallback(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake binaries are shell scripts")
+	}
+
+	if terminal.IsTerminal(os.Stdin) && terminal.IsTerminal(os.Stderr) {
+		t.Skip("the fallback is only used without a terminal")
+	}
+
+	tests := []struct {
+		fallback string
+		update   bool
+		skipped  bool
+	}{
+		{selfupdate.ConfirmYes, true, false},
+		{selfupdate.ConfirmNo, false, false},
+		{selfupdate.ConfirmSkip, false, true},
+	}
+
+	for _, tt := range tests {
+		app := newTestApp(t)
+		app.publish(t, "v1.1.0", "")
+
+		if update := app.auto(selfupdate.WithAutoConfirm(tt.fallback)); update != tt.update {
+			t.Errorf("%s: expected update %v but got %v", tt.fallback, tt.update, update)
+		}
+
+		if skipped := slices.Contains(app.state(t).Skipped, "v1.1.0"); skipped != tt.skipped {
+			t.Errorf("%s: expected skipped %v but got %v", tt.fallback, tt.skipped, skipped)
+		}
+	}
+}
+
+func TestConfirmFallbackInvalid(t *testing.T) {
+	app := newTestApp(t)
+
+	for _, fallback := range []string{"", "y", "YES", "later"} {
+		_, err := selfupdate.NewUpdater("owner", "repo", "v1.0.0", "app", "", app.publicKey.String(), app.options(selfupdate.WithAutoConfirm(fallback))...)
+		if !errors.Is(err, selfupdate.ErrConfirmFallback) {
+			t.Errorf("%q: expected ErrConfirmFallback but got %v", fallback, err)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// DefaultDetachedSuffix is appended to the asset name to get the name of
+	// its detached signature, e.g. app-linux-amd64 and app-linux-amd64.sig
+	DefaultDetachedSuffix = ".sig"
+)
+
+// NewDetachedVerifier verifies content against a signature which is stored
+// separately. Any verifier which expects the signature prepended to the content
+// can be used, such as NewKeyringVerifier.
+func NewDetachedVerifier(verifier Verifier, signature io.Reader) Verifier {
+	return VerifierFunc(func(ctx context.Context, r io.Reader) io.Reader {
+		return verifier.Verify(ctx, io.MultiReader(signature, r))
+	})
+}
+
+type detachedChecker struct {
+	checker Checker
+	suffix  string
+}
+
+var _ Checker = (*detachedChecker)(nil)
+
+// NewDetachedChecker makes sure both the asset and its detached signature exist
+// in the new version
+func NewDetachedChecker(checker Checker, suffix string) Checker {
+	return &detachedChecker{
+		checker: checker,
+		suffix:  suffix,
+	}
+}
+
+func (c *detachedChecker) Check(ctx context.Context, filename string, currentVersion string) (newVersion string, desc string, err error) {
+	newVersion, desc, err = c.checker.Check(ctx, filename, currentVersion)
+	if err != nil {
+		return "", "", err
+	}
+
+	_, _, err = c.checker.Check(ctx, filename+c.suffix, currentVersion)
+	if err != nil {
+		return "", "", err
+	}
+
+	return newVersion, desc, nil
+}
+
+// AssetChecker finds the asset of the new version out of candidate names
+// which depend on the version, such as Github
+type AssetChecker interface {
+	CheckAsset(ctx context.Context, currentVersion string, candidatesFn func(version string) ([]string, error)) (newVersion string, filename string, desc string, err error)
+	FindAsset(ctx context.Context, version string, candidatesFn func(version string) ([]string, error)) (filename string, desc string, err error)
+}
+
+var _ AssetChecker = (*Github)(nil)
+
+type detachedAssetChecker struct {
+	checker AssetChecker
+	suffix  string
+}
+
+var _ AssetChecker = (*detachedAssetChecker)(nil)
+
+// NewDetachedAssetChecker is like NewDetachedChecker for an AssetChecker. A
+// new version whose asset has no detached signature is skipped, and
+// ErrNoNewVersion is returned, so it's never downloaded.
+func NewDetachedAssetChecker(checker AssetChecker, suffix string) AssetChecker {
+	return &detachedAssetChecker{
+		checker: checker,
+		suffix:  suffix,
+	}
+}
+
+func (c *detachedAssetChecker) CheckAsset(ctx context.Context, currentVersion string, candidatesFn func(version string) ([]string, error)) (newVersion string, filename string, desc string, err error) {
+	newVersion, filename, desc, err = c.checker.CheckAsset(ctx, currentVersion, candidatesFn)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	if err := c.checkSignature(ctx, newVersion, filename); errors.Is(err, ErrGithubAssetNotFound) {
+		return "", "", "", fmt.Errorf("%w: %s has no detached signature", ErrNoNewVersion, newVersion)
+	} else if err != nil {
+		return "", "", "", err
+	}
+
+	return newVersion, filename, desc, nil
+}
+
+func (c *detachedAssetChecker) FindAsset(ctx context.Context, version string, candidatesFn func(version string) ([]string, error)) (filename string, desc string, err error) {
+	filename, desc, err = c.checker.FindAsset(ctx, version, candidatesFn)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := c.checkSignature(ctx, version, filename); err != nil {
+		return "", "", err
+	}
+
+	return filename, desc, nil
+}
+
+func (c *detachedAssetChecker) checkSignature(ctx context.Context, version string, filename string) error {
+	_, _, err := c.checker.FindAsset(ctx, version, func(string) ([]string, error) {
+		return []string{filename + c.suffix}, nil
+	})
+	return err
+}
+
+type detachedDownloader struct {
+	downloader Downloader
+	suffix     string
+}
+
+var _ Downloader = (*detachedDownloader)(nil)
+
+// NewDetachedDownloader downloads both the asset and its detached signature and
+// returns them as one stream, the signature first. This is the same layout
+// the prepended signature format has, so the stream can be passed to the usual
+// verifiers.
+func NewDetachedDownloader(downloader Downloader, suffix string) Downloader {
+	return &detachedDownloader{
+		downloader: downloader,
+		suffix:     suffix,
+	}
+}
+
+func (d *detachedDownloader) Download(ctx context.Context, name string, version string) io.ReadCloser {
+	signature := d.downloader.Download(ctx, name+d.suffix, version)
+	content := d.downloader.Download(ctx, name, version)
+
+	return &multiReadCloser{
+		Reader:  io.MultiReader(signature, content),
+		closers: []io.Closer{signature, content},
+	}
+}
+
+type multiReadCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (m *multiReadCloser) Close() error {
+	var err error
+	for _, closer := range m.closers {
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
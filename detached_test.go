@@ -0,0 +1,143 @@
+package selfupdate_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"selfupdate.blockthrough.com"
+	"selfupdate.blockthrough.com/pkg/crypto"
+)
+
+type memoryDownloader map[string][]byte
+
+func (m memoryDownloader) Download(ctx context.Context, name string, version string) io.ReadCloser {
+	return io.NopCloser(bytes.NewReader(m[version+"/"+name]))
+}
+
+func TestDetachedSignature(t *testing.T) {
+	publicKey, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := "hello, world"
+
+	signer := selfupdate.NewHashSigner(privateKey, selfupdate.WithSignerKeyID(), selfupdate.WithSignerDetached())
+	signature, err := io.ReadAll(signer.Sign(context.Background(), strings.NewReader(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := selfupdate.NewDetachedVerifier(selfupdate.NewHashVerifier(publicKey), bytes.NewReader(signature))
+	verified, err := io.ReadAll(verifier.Verify(context.Background(), strings.NewReader(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(verified) != content {
+		t.Fatal("content is not matched")
+	}
+
+	downloader := selfupdate.NewDetachedDownloader(memoryDownloader{
+		"v1.0.0/app-linux-amd64":     []byte(content),
+		"v1.0.0/app-linux-amd64.sig": signature,
+	}, selfupdate.DefaultDetachedSuffix)
+
+	rc := downloader.Download(context.Background(), "app-linux-amd64", "v1.0.0")
+	defer rc.Close()
+
+	verified, err = io.ReadAll(selfupdate.NewHashVerifier(publicKey).Verify(context.Background(), rc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(verified) != content {
+		t.Fatal("downloaded content is not matched")
+	}
+}
+
+func TestMinisignDetachedSignature(t *testing.T) {
+	_, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey, minisignPrivateKey, err := crypto.NewMinisignKeys(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := "hello, world"
+
+	signature, err := io.ReadAll(selfupdate.NewMinisignSigner(minisignPrivateKey, "").Sign(context.Background(), strings.NewReader(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := selfupdate.NewDetachedVerifier(selfupdate.NewMinisignVerifier(publicKey), bytes.NewReader(signature))
+	verified, err := io.ReadAll(verifier.Verify(context.Background(), strings.NewReader(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(verified) != content {
+		t.Fatal("content is not matched")
+	}
+}
+
+// memoryAssetChecker has one release with the given assets
+type memoryAssetChecker struct {
+	version string
+	assets  []string
+}
+
+func (m memoryAssetChecker) CheckAsset(ctx context.Context, currentVersion string, candidatesFn func(version string) ([]string, error)) (string, string, string, error) {
+	filename, desc, err := m.FindAsset(ctx, m.version, candidatesFn)
+	return m.version, filename, desc, err
+}
+
+func (m memoryAssetChecker) FindAsset(ctx context.Context, version string, candidatesFn func(version string) ([]string, error)) (string, string, error) {
+	candidates, err := candidatesFn(version)
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, candidate := range candidates {
+		if slices.Contains(m.assets, candidate) {
+			return candidate, "notes", nil
+		}
+	}
+
+	return "", "", selfupdate.ErrGithubAssetNotFound
+}
+
+func TestDetachedAssetChecker(t *testing.T) {
+	candidatesFn := func(version string) ([]string, error) {
+		return []string{"app-linux-amd64", "app-linux"}, nil
+	}
+
+	tests := []struct {
+		name   string
+		assets []string
+		asset  string
+		err    error
+	}{
+		{"signed", []string{"app-linux-amd64", "app-linux-amd64.sig"}, "app-linux-amd64", nil},
+		{"unsigned", []string{"app-linux-amd64"}, "", selfupdate.ErrNoNewVersion},
+		{"signature of another asset", []string{"app-linux-amd64", "app-linux.sig"}, "", selfupdate.ErrNoNewVersion},
+	}
+
+	for _, tt := range tests {
+		checker := selfupdate.NewDetachedAssetChecker(memoryAssetChecker{version: "v1.1.0", assets: tt.assets}, selfupdate.DefaultDetachedSuffix)
+
+		_, asset, _, err := checker.CheckAsset(context.Background(), "v1.0.0", candidatesFn)
+		if !errors.Is(err, tt.err) || asset != tt.asset {
+			t.Errorf("%s: expected %q and %v, got %q and %v", tt.name, tt.asset, tt.err, asset, err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package selfupdate
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"selfupdate.blockthrough.com/pkg/crypto"
+)
+
+// WatchSteps runs the schedule of Watch with the given steps instead of the
+// ones of an Updater
+func WatchSteps(ctx context.Context, interval time.Duration, check func(ctx context.Context) (*Update, error), download func(ctx context.Context, update *Update) error, probe func(ctx context.Context, update *Update) error, optFns ...watchOptFn) <-chan WatchEvent {
+	return watch(ctx, interval, watchSteps{check: check, download: download, probe: probe}, optFns...)
+}
+
+// NewGithubWithURL is NewGithub against another API server, e.g. a test one
+func NewGithubWithURL(baseURL string, repoOwner, repoName string) *Github {
+	g := NewGithub("", repoOwner, repoName)
+	g.client.BaseURL, _ = url.Parse(baseURL + "/")
+	return g
+}
+
+type AutoOptFn = autoOptFn
+
+// WithAutoGithub makes the updater check and download from g, e.g. a test
+// server
+func WithAutoGithub(g *Github) autoOptFn {
+	return func(opts *autoOptions) {
+		opts.github = g
+	}
+}
+
+// WithAutoExit calls exit instead of exiting like the relaunched new version
+func WithAutoExit(exit func(err error)) autoOptFn {
+	return func(opts *autoOptions) {
+		opts.exit = exit
+	}
+}
+
+// WithAutoForeground runs the work of WithAutoAsync before Auto returns
+func WithAutoForeground() autoOptFn {
+	return func(opts *autoOptions) {
+		opts.background = func(fn func()) { fn() }
+	}
+}
+
+// WithAutoReadLine reads the answers of WithAutoConfirm with readLine, as if
+// there was a terminal
+func WithAutoReadLine(readLine func(prompt string) (string, error)) autoOptFn {
+	return func(opts *autoOptions) {
+		opts.readLine = readLine
+	}
+}
+
+// WithAutoExecutable makes the updater take path for the current executable,
+// so its files are next to path instead of the test binary
+func WithAutoExecutable(path string) autoOptFn {
+	return func(opts *autoOptions) {
+		opts.executable = path
+	}
+}
+
+type BundleOptFn = bundleOptFn
+
+// LoadRevocations downloads the revocation list like the Updater does, keeping
+// the last accepted list at path
+func LoadRevocations(ctx context.Context, g *Github, assetName string, keyring *crypto.Keyring, path string) (*Revocations, error) {
+	return loadRevocations(ctx, g, assetName, keyring, path)
+}
+
+type BadVersions struct {
+	bad badVersions
+}
+
+func NewBadVersions(path string) *BadVersions {
+	return &BadVersions{badVersions{path: path}}
+}
+
+func (b *BadVersions) Path() string {
+	return b.bad.path
+}
+
+func (b *BadVersions) Add(version string) error {
+	return b.bad.add(version)
+}
+
+func (b *BadVersions) Contains(version string) bool {
+	return b.bad.contains(version)
+}
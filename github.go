@@ -77,6 +77,16 @@ func (g *Github) Release(ctx context.Context, tag string, releaseTitle string, r
 }
 
 func (g *Github) Check(ctx context.Context, filename string, currentVersion string) (newVersion string, desc string, err error) {
+	newVersion, _, desc, err = g.CheckAsset(ctx, currentVersion, func(version string) ([]string, error) {
+		return []string{filename}, nil
+	})
+	return
+}
+
+// CheckAsset is like Check, but the name of the asset may depend on the new version.
+// candidatesFn is called with the latest version and returns the possible asset
+// names in order of preference. The first one found in the release is returned.
+func (g *Github) CheckAsset(ctx context.Context, currentVersion string, candidatesFn func(version string) ([]string, error)) (newVersion string, filename string, desc string, err error) {
 	releases, _, err := g.client.Repositories.ListReleases(ctx, g.owner, g.repo, nil)
 	if err != nil {
 		return
@@ -87,23 +97,86 @@ func (g *Github) Check(ctx context.Context, filename string, currentVersion stri
 	})
 
 	if len(releases) == 0 || releases[0].GetTagName() == currentVersion {
-		return "", "", ErrNoNewVersion
+		return "", "", "", ErrNoNewVersion
 	}
 
 	release := releases[0]
-	var githubAsset *github.ReleaseAsset
-	for _, asset := range release.Assets {
-		if asset.GetName() == filename {
-			githubAsset = asset
-			break
+
+	filename, err = findReleaseAsset(release, candidatesFn)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return release.GetTagName(), filename, release.GetBody(), nil
+}
+
+// FindAsset is like CheckAsset, but for the release of the given version, e.g.
+// the successor of a revoked version
+func (g *Github) FindAsset(ctx context.Context, version string, candidatesFn func(version string) ([]string, error)) (filename string, desc string, err error) {
+	releases, _, err := g.client.Repositories.ListReleases(ctx, g.owner, g.repo, nil)
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, release := range releases {
+		if release.GetTagName() != version {
+			continue
+		}
+
+		filename, err = findReleaseAsset(release, candidatesFn)
+		if err != nil {
+			return "", "", err
 		}
+
+		return filename, release.GetBody(), nil
 	}
 
-	if githubAsset == nil {
-		return "", "", ErrGithubAssetNotFound
+	return "", "", ErrGithubReleaseNotFound
+}
+
+// findReleaseAsset returns the first candidate which is an asset of the release
+func findReleaseAsset(release *github.RepositoryRelease, candidatesFn func(version string) ([]string, error)) (string, error) {
+	candidates, err := candidatesFn(release.GetTagName())
+	if err != nil {
+		return "", err
+	}
+
+	for _, candidate := range candidates {
+		for _, asset := range release.Assets {
+			if asset.GetName() == candidate {
+				return candidate, nil
+			}
+		}
+	}
+
+	return "", ErrGithubAssetNotFound
+}
+
+// LatestVersion returns the tag of the newest release
+func (g *Github) LatestVersion(ctx context.Context) (string, error) {
+	release, err := g.latestRelease(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return release.GetTagName(), nil
+}
+
+func (g *Github) latestRelease(ctx context.Context) (*github.RepositoryRelease, error) {
+	releases, _, err := g.client.Repositories.ListReleases(ctx, g.owner, g.repo, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(releases, func(i, j int) bool {
+		return g.versionCompareFn(releases[i].GetTagName(), releases[j].GetTagName())
+	})
+
+	if len(releases) == 0 {
+		return nil, ErrGithubReleaseNotFound
 	}
 
-	return releases[0].GetTagName(), releases[0].GetBody(), nil
+	return releases[0], nil
 }
 
 func (g *Github) DeleteAsset(ctx context.Context, filename string, version string) (err error) {
@@ -163,6 +236,11 @@ func (g *Github) Download(ctx context.Context, name string, version string) io.R
 		return newErrorReader(ErrGithubReleaseNotFound)
 	}
 
+	return g.downloadAsset(ctx, release, name)
+}
+
+// downloadAsset is like Download, for a release which is already listed
+func (g *Github) downloadAsset(ctx context.Context, release *github.RepositoryRelease, name string) io.ReadCloser {
 	var githubAsset *github.ReleaseAsset
 	for _, asset := range release.Assets {
 		if asset.GetName() == name {
@@ -0,0 +1,282 @@
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// ListenFDsEnv is the number of listeners the new process inherits, they
+	// are the file descriptors starting from 3, please refer to Listeners
+	ListenFDsEnv = "SELF_UPDATE_LISTEN_FDS"
+
+	// ReadyFDEnv is the file descriptor the new process reports its readiness
+	// to, please refer to Ready
+	ReadyFDEnv = "SELF_UPDATE_READY_FD"
+
+	// DefaultDrainTimeout is how long the old process may take to finish its
+	// connections after the new one is ready
+	DefaultDrainTimeout = 30 * time.Second
+)
+
+var (
+	ErrGracefulUnsupported = errors.New("graceful restart is not supported on this platform")
+	ErrDrain               = errors.New("failed to drain the connections")
+)
+
+type gracefulOptions struct {
+	readyTimeout time.Duration
+	drainTimeout time.Duration
+}
+
+type gracefulOptFn func(opts *gracefulOptions)
+
+// WithGracefulReadyTimeout sets how long the new process has to call Ready,
+// the default is DefaultHealthTimeout
+func WithGracefulReadyTimeout(timeout time.Duration) gracefulOptFn {
+	return func(opts *gracefulOptions) {
+		opts.readyTimeout = timeout
+	}
+}
+
+// WithGracefulDrainTimeout sets the deadline of the shutdown func, the default
+// is DefaultDrainTimeout
+func WithGracefulDrainTimeout(timeout time.Duration) gracefulOptFn {
+	return func(opts *gracefulOptions) {
+		opts.drainTimeout = timeout
+	}
+}
+
+// NewGracefulRunner starts the executable with the listeners as inherited file
+// descriptors and waits until it calls Ready, so the sockets are never closed
+// and no connection is refused. Then it calls shutdown, e.g. the Shutdown of an
+// http.Server, to drain the connections of this process, which should exit
+// after Run returns, even if draining fails with ErrDrain. If the new process
+// exits or doesn't get ready in time, it's killed and ErrUnhealthy is
+// returned, and this process keeps serving.
+func NewGracefulRunner(path string, args []string, listeners []net.Listener, shutdown func(ctx context.Context) error, optFns ...gracefulOptFn) Runner {
+	opts := &gracefulOptions{
+		readyTimeout: DefaultHealthTimeout,
+		drainTimeout: DefaultDrainTimeout,
+	}
+
+	for _, optFn := range optFns {
+		optFn(opts)
+	}
+
+	return RunnerFunc(func(ctx context.Context) error {
+		if runtime.GOOS == "windows" {
+			return ErrGracefulUnsupported
+		}
+
+		files := make([]*os.File, 0, len(listeners)+1)
+		defer func() {
+			for _, f := range files {
+				f.Close()
+			}
+		}()
+
+		for _, listener := range listeners {
+			filer, ok := listener.(interface{ File() (*os.File, error) })
+			if !ok {
+				return fmt.Errorf("%w: %T has no file descriptor", ErrGracefulUnsupported, listener)
+			}
+
+			f, err := filer.File()
+			if err != nil {
+				return err
+			}
+
+			files = append(files, f)
+		}
+
+		readyReader, readyWriter, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+		defer readyReader.Close()
+
+		files = append(files, readyWriter)
+
+		cmd := exec.Command(path, args...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.ExtraFiles = files
+		cmd.Env = append(os.Environ(),
+			ListenFDsEnv+"="+strconv.Itoa(len(listeners)),
+			ReadyFDEnv+"="+strconv.Itoa(3+len(listeners)),
+		)
+
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+
+		// only the new process may hold the write end, so a crash is read as EOF
+		readyWriter.Close()
+
+		// the new process outlives this one, so it's only waited for here to
+		// not leave a zombie if it fails
+		exited := make(chan error, 1)
+		go func() {
+			exited <- cmd.Wait()
+		}()
+
+		ready := make(chan error, 1)
+		go func() {
+			_, err := readyReader.Read(make([]byte, 1))
+			ready <- err
+		}()
+
+		timer := time.NewTimer(opts.readyTimeout)
+		defer timer.Stop()
+
+		select {
+		case err := <-ready:
+			if err != nil {
+				cmd.Process.Kill()
+				return fmt.Errorf("%w: exited before it was ready: %v", ErrUnhealthy, <-exited)
+			}
+		case <-timer.C:
+			cmd.Process.Kill()
+			<-exited
+			return fmt.Errorf("%w: not ready within %s", ErrUnhealthy, opts.readyTimeout)
+		}
+
+		// the new process serves the unix sockets now, so closing them here must
+		// not remove their files
+		for _, listener := range listeners {
+			if unixListener, ok := listener.(*net.UnixListener); ok {
+				unixListener.SetUnlinkOnClose(false)
+			}
+		}
+
+		if shutdown == nil {
+			return nil
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, opts.drainTimeout)
+		defer cancel()
+
+		if err := shutdown(ctx); err != nil {
+			return fmt.Errorf("%w: %w", ErrDrain, err)
+		}
+
+		return nil
+	})
+}
+
+var inherited struct {
+	once      sync.Once
+	listeners []net.Listener
+	err       error
+}
+
+// Listeners returns the listeners inherited from the previous version, in the
+// order they were passed to NewGracefulRunner. It returns nil if the process
+// wasn't started by a graceful restart.
+func Listeners() ([]net.Listener, error) {
+	inherited.once.Do(func() {
+		value := os.Getenv(ListenFDsEnv)
+		if value == "" {
+			return
+		}
+
+		// the descriptors are not passed on to the children of this process
+		os.Unsetenv(ListenFDsEnv)
+
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			inherited.err = fmt.Errorf("invalid %s: %w", ListenFDsEnv, err)
+			return
+		}
+
+		for i := 0; i < n; i++ {
+			f := os.NewFile(uintptr(3+i), "listener")
+
+			listener, err := net.FileListener(f)
+			f.Close()
+			if err != nil {
+				inherited.err = err
+				return
+			}
+
+			inherited.listeners = append(inherited.listeners, listener)
+		}
+	})
+
+	return inherited.listeners, inherited.err
+}
+
+// Listen returns the inherited listener of the address, or a new one if there
+// is none, e.g. on the first start. It's a drop-in for net.Listen.
+func Listen(network string, address string) (net.Listener, error) {
+	listeners, err := Listeners()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, listener := range listeners {
+		if sameAddr(listener.Addr(), network, address) {
+			return listener, nil
+		}
+	}
+
+	return net.Listen(network, address)
+}
+
+// Ready tells the previous version that this process serves the inherited
+// listeners, so it can drain its connections and exit. It's a no-op if the
+// process wasn't started by a graceful restart.
+func Ready() error {
+	value := os.Getenv(ReadyFDEnv)
+	if value == "" {
+		return nil
+	}
+	os.Unsetenv(ReadyFDEnv)
+
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", ReadyFDEnv, err)
+	}
+
+	f := os.NewFile(uintptr(fd), "ready")
+	defer f.Close()
+
+	_, err = f.Write([]byte{1})
+	return err
+}
+
+// sameAddr reports whether addr is the address the listener would get from
+// net.Listen(network, address), an unspecified ip matches any unspecified ip
+func sameAddr(addr net.Addr, network string, address string) bool {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		listenerAddr, ok := addr.(*net.TCPAddr)
+		if !ok {
+			return false
+		}
+
+		tcpAddr, err := net.ResolveTCPAddr(network, address)
+		if err != nil || tcpAddr.Port != listenerAddr.Port {
+			return false
+		}
+
+		if tcpAddr.IP == nil || tcpAddr.IP.IsUnspecified() {
+			return listenerAddr.IP.IsUnspecified()
+		}
+
+		return tcpAddr.IP.Equal(listenerAddr.IP)
+	case "unix", "unixpacket":
+		return addr.Network() == network && addr.String() == address
+	}
+
+	return false
+}
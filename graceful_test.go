@@ -0,0 +1,116 @@
+package selfupdate_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"selfupdate.blockthrough.com"
+)
+
+// TestGracefulHelper is the new version started by TestGracefulRunner, it
+// serves one connection on the inherited listener
+func TestGracefulHelper(t *testing.T) {
+	address := os.Getenv("GRACEFUL_HELPER_ADDR")
+	if address == "" {
+		t.Skip("only run by TestGracefulRunner")
+	}
+
+	if os.Getenv("GRACEFUL_HELPER_CRASH") != "" {
+		os.Exit(2)
+	}
+
+	listener, err := selfupdate.Listen(os.Getenv("GRACEFUL_HELPER_NETWORK"), address)
+	if err != nil {
+		os.Exit(3)
+	}
+
+	if err := selfupdate.Ready(); err != nil {
+		os.Exit(4)
+	}
+
+	conn, err := listener.Accept()
+	if err != nil {
+		os.Exit(5)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("new version"))
+}
+
+func TestGracefulRunner(t *testing.T) {
+	testGracefulRunner(t, "tcp", "127.0.0.1:0")
+}
+
+func TestGracefulRunnerUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.sock")
+	testGracefulRunner(t, "unix", path)
+
+	// closing the listener of the old version keeps the socket file
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected the socket file to be kept, got %v", err)
+	}
+}
+
+func testGracefulRunner(t *testing.T, network string, address string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("listeners can't be inherited on windows")
+	}
+
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	address = listener.Addr().String()
+	t.Setenv("GRACEFUL_HELPER_NETWORK", network)
+	t.Setenv("GRACEFUL_HELPER_ADDR", address)
+
+	args := []string{"-test.run=^TestGracefulHelper$"}
+
+	t.Setenv("GRACEFUL_HELPER_CRASH", "1")
+	err = selfupdate.NewGracefulRunner(os.Args[0], args, []net.Listener{listener}, nil).Run(context.Background())
+	if !errors.Is(err, selfupdate.ErrUnhealthy) {
+		t.Fatalf("expected unhealthy new version, got %v", err)
+	}
+
+	t.Setenv("GRACEFUL_HELPER_CRASH", "")
+
+	drained := false
+	shutdown := func(ctx context.Context) error {
+		drained = true
+		return listener.Close()
+	}
+
+	err = selfupdate.NewGracefulRunner(os.Args[0], args, []net.Listener{listener}, shutdown, selfupdate.WithGracefulReadyTimeout(10*time.Second)).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !drained {
+		t.Fatal("old version is not drained")
+	}
+
+	// the socket is still open, and it's served by the new version
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	data, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "new version" {
+		t.Fatalf("expected the new version to serve, got %q", data)
+	}
+}
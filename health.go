@@ -0,0 +1,195 @@
+package selfupdate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+const (
+	// HealthcheckFlag is the only argument of the new binary when it's invoked
+	// by InvocationProbe, Auto of the new binary exits with 0 when it sees it
+	HealthcheckFlag = "--selfupdate-healthcheck"
+
+	// HealthEnv is set for the relaunched binary when a handshake is required,
+	// please refer to ConfirmHealthy
+	HealthEnv = "SELF_UPDATE_HEALTH_FILE"
+
+	// DefaultHealthTimeout is how long the new binary has to prove it's healthy
+	DefaultHealthTimeout = 30 * time.Second
+)
+
+var (
+	ErrUnhealthy = errors.New("new version is unhealthy")
+)
+
+// HealthProbe checks the new binary at path before it replaces the current one
+// and is relaunched, ctx is cancelled at the health timeout
+type HealthProbe func(ctx context.Context, path string) error
+
+// InvocationProbe runs the new binary with HealthcheckFlag and expects it to
+// exit with 0, which proves that it starts and gets as far as calling Auto, or
+// HandleHealthcheck
+func InvocationProbe() HealthProbe {
+	return func(ctx context.Context, path string) error {
+		cmd := exec.CommandContext(ctx, path, HealthcheckFlag)
+		// children of a killed binary may keep its output open
+		cmd.WaitDelay = time.Second
+
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%w: %w: %s", ErrUnhealthy, err, output)
+		}
+
+		return nil
+	}
+}
+
+// HandleHealthcheck exits with 0 if the binary is invoked by InvocationProbe,
+// getting here means it works. Auto calls it, an application using NewUpdater
+// instead calls it itself, early at startup.
+func HandleHealthcheck() {
+	if len(os.Args) == 2 && os.Args[1] == HealthcheckFlag {
+		os.Exit(0)
+	}
+}
+
+// ConfirmHealthy tells the previous version that the relaunched binary works,
+// e.g. once it has loaded its config and is ready to serve. It's a no-op if
+// the binary wasn't relaunched by an update which requires a handshake, please
+// refer to WithAutoHealthHandshake.
+func ConfirmHealthy() error {
+	path := os.Getenv(HealthEnv)
+	if path == "" {
+		return nil
+	}
+
+	return os.WriteFile(path, nil, 0644)
+}
+
+// handshake is a binary started by startWithHandshake, which confirmed it's
+// healthy
+type handshake struct {
+	*process
+	dir string
+}
+
+// wait waits for the binary, its error is the result of the command
+func (h *handshake) wait() error {
+	err := h.process.wait()
+	os.RemoveAll(h.dir)
+
+	return err
+}
+
+// startWithHandshake starts the binary with HealthEnv set and waits until it
+// calls ConfirmHealthy. If it exits before, whatever its exit code, or doesn't
+// confirm within the timeout, it's unhealthy and ErrUnhealthy is returned. A
+// binary which didn't confirm in time is killed with its process group.
+func startWithHandshake(path string, args []string, timeout time.Duration, optFns ...runnerOptFn) (*handshake, error) {
+	dir, err := os.MkdirTemp("", "selfupdate-health")
+	if err != nil {
+		return nil, err
+	}
+
+	healthFile := filepath.Join(dir, "healthy")
+
+	opts := &runnerOptions{}
+	for _, optFn := range append(optFns, WithRunnerEnv(HealthEnv+"="+healthFile)) {
+		optFn(opts)
+	}
+
+	p, err := startProcess(path, args, opts)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			// it may have confirmed right before it exited
+			if fileExists(healthFile) {
+				return &handshake{process: p, dir: dir}, nil
+			}
+
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("%w: exited with %d before confirming", ErrUnhealthy, ExitCode(p.err))
+		case <-deadline.C:
+			if fileExists(healthFile) {
+				return &handshake{process: p, dir: dir}, nil
+			}
+
+			p.kill()
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("%w: not confirmed within %s", ErrUnhealthy, timeout)
+		case <-ticker.C:
+			if fileExists(healthFile) {
+				return &handshake{process: p, dir: dir}, nil
+			}
+		}
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// badVersions are the versions which failed their health check on this host,
+// they are kept in a JSON file so they aren't retried
+type badVersions struct {
+	path string
+}
+
+func (b badVersions) load() ([]string, error) {
+	data, err := os.ReadFile(b.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	if err := json.Unmarshal(data, &versions); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+func (b badVersions) contains(version string) bool {
+	versions, err := b.load()
+	return err == nil && slices.Contains(versions, version)
+}
+
+func (b badVersions) add(version string) error {
+	versions, err := b.load()
+	if err != nil {
+		return err
+	}
+
+	if slices.Contains(versions, version) {
+		return nil
+	}
+
+	data, err := json.Marshal(append(versions, version))
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(b.path, data, 0644)
+}
@@ -0,0 +1,172 @@
+package selfupdate_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"selfupdate.blockthrough.com"
+)
+
+func TestInvocationProbe(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake binaries are shell scripts")
+	}
+
+	dir := t.TempDir()
+
+	tests := []struct {
+		name   string
+		script string
+		err    error
+	}{
+		{"healthy", `[ "$1" = "` + selfupdate.HealthcheckFlag + `" ] && exit 0; exit 2`, nil},
+		{"crash on start", `echo panic >&2; exit 2`, selfupdate.ErrUnhealthy},
+		{"hangs", `sleep 10`, selfupdate.ErrUnhealthy},
+	}
+
+	for i, tt := range tests {
+		path := filepath.Join(dir, string(rune('a'+i)))
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"+tt.script+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		err := selfupdate.InvocationProbe()(ctx, path)
+		cancel()
+
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v but got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestConfirmHealthy(t *testing.T) {
+	t.Setenv(selfupdate.HealthEnv, "")
+	if err := selfupdate.ConfirmHealthy(); err != nil {
+		t.Fatalf("expected no-op without handshake, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "healthy")
+	t.Setenv(selfupdate.HealthEnv, path)
+
+	if err := selfupdate.ConfirmHealthy(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("health is not confirmed: %v", err)
+	}
+}
+
+func TestHealthHandshake(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake binaries are shell scripts")
+	}
+
+	app := newTestApp(t)
+	u := app.updater(t, selfupdate.WithAutoHealthcheck(300*time.Millisecond), selfupdate.WithAutoHealthHandshake())
+	bad := selfupdate.NewBadVersions(app.path(".app-bad-versions.json"))
+
+	tests := []struct {
+		name   string
+		script string
+		ran    bool
+		code   int
+		err    error
+		bad    bool
+	}{
+		{"confirmed", `: > "$` + selfupdate.HealthEnv + `"`, true, 0, nil, false},
+		{"exit code after confirmation", `: > "$` + selfupdate.HealthEnv + `"; exit 2`, true, 2, nil, false},
+		{"crash after confirmation", `: > "$` + selfupdate.HealthEnv + `"; kill -SEGV $$`, true, 128 + 11, nil, false},
+		{"long command after confirmation", `: > "$` + selfupdate.HealthEnv + `"; sleep 0.6`, true, 0, nil, false},
+		{"exit", `exit 0`, false, 1, selfupdate.ErrUnhealthy, true},
+		{"exit code", `exit 2`, false, 1, selfupdate.ErrUnhealthy, true},
+		{"crash", `kill -SEGV $$`, false, 1, selfupdate.ErrUnhealthy, true},
+		{"not confirmed in time", `sleep 5`, false, 1, selfupdate.ErrUnhealthy, true},
+	}
+
+	for i, tt := range tests {
+		if err := os.WriteFile(app.path("app-downloaded"), []byte("#!/bin/sh\n"+tt.script+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		update := &selfupdate.Update{Version: "v1.1." + strconv.Itoa(i)}
+
+		app.exited = false
+		start := time.Now()
+
+		err := u.Apply(context.Background(), update)
+		if time.Since(start) > 2*time.Second {
+			t.Errorf("%s: expected an unconfirmed version to be killed", tt.name)
+		}
+
+		if app.exited != tt.ran {
+			t.Errorf("%s: expected ran %v but got %v", tt.name, tt.ran, app.exited)
+		}
+
+		if tt.err != nil && !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v but got %v", tt.name, tt.err, err)
+		} else if tt.err == nil && (err != nil || selfupdate.ExitCode(app.exitErr) != tt.code) {
+			t.Errorf("%s: expected exit code %d but got %v, %v", tt.name, tt.code, app.exitErr, err)
+		}
+
+		if bad := bad.Contains(update.Version); bad != tt.bad {
+			t.Errorf("%s: expected bad %v but got %v", tt.name, tt.bad, bad)
+		}
+
+		// a rolled back version is removed
+		if _, err := os.Stat(app.path("app-downloaded")); tt.bad != errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s: expected the new version to be removed only on rollback, got %v", tt.name, err)
+		}
+
+		// the backup of the current version is restored, or dropped
+		if data, err := os.ReadFile(app.path("app")); err != nil || string(data) != "#!/bin/sh\n" {
+			t.Errorf("%s: expected the current version to be kept, got %q, %v", tt.name, data, err)
+		}
+
+		if _, err := os.Stat(app.path("app-previous")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s: expected the backup to be removed, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestBadVersions(t *testing.T) {
+	bad := selfupdate.NewBadVersions(filepath.Join(t.TempDir(), "bad-versions.json"))
+
+	if bad.Contains("v1.1.0") {
+		t.Fatal("expected no bad version without a file")
+	}
+
+	for _, version := range []string{"v1.1.0", "v1.2.0", "v1.1.0"} {
+		if err := bad.Add(version); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !bad.Contains("v1.1.0") || !bad.Contains("v1.2.0") || bad.Contains("v1.3.0") {
+		t.Fatal("bad versions are not matched")
+	}
+
+	data, err := os.ReadFile(bad.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != `["v1.1.0","v1.2.0"]` {
+		t.Fatalf("expected every version once, got %s", data)
+	}
+
+	if err := os.WriteFile(bad.Path(), []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bad.Add("v1.3.0"); err == nil {
+		t.Fatal("expected a corrupted file not to be overwritten")
+	}
+}
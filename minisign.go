@@ -0,0 +1,65 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+
+	"selfupdate.blockthrough.com/pkg/crypto"
+)
+
+const (
+	// DefaultMinisignSuffix is the suffix minisign uses for signature files
+	DefaultMinisignSuffix = ".minisig"
+)
+
+// NewMinisignSigner returns the content of a .minisig file for the content, in
+// the prehashed mode. The content itself is not returned, the signature is
+// always detached.
+func NewMinisignSigner(privateKey crypto.MinisignPrivateKey, trustedComment string) Signer {
+	return SignerFunc(func(ctx context.Context, r io.Reader) io.Reader {
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return newErrorReader(err)
+		}
+
+		return strings.NewReader(privateKey.Sign(content, trustedComment, true).String())
+	})
+}
+
+// NewMinisignVerifier expects the content of a .minisig file followed by the
+// content, which is the layout NewDetachedVerifier and NewDetachedDownloader
+// produce. The content is accepted if it's signed by any of the keys.
+func NewMinisignVerifier(publicKeys ...crypto.MinisignPublicKey) Verifier {
+	return VerifierFunc(func(ctx context.Context, r io.Reader) io.Reader {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return newErrorReader(err)
+		}
+
+		// a .minisig file has exactly 4 lines
+		end := 0
+		for i := 0; i < 4; i++ {
+			n := bytes.IndexByte(data[end:], '\n')
+			if n < 0 {
+				return newErrorReader(crypto.ErrMinisignInvalidFormat)
+			}
+			end += n + 1
+		}
+
+		sig, err := crypto.ParseMinisignSignature(string(data[:end]))
+		if err != nil {
+			return newErrorReader(err)
+		}
+
+		content := data[end:]
+		for _, publicKey := range publicKeys {
+			if publicKey.Verify(content, sig) {
+				return bytes.NewReader(content)
+			}
+		}
+
+		return newErrorReader(ErrVerificationFailed)
+	})
+}
@@ -0,0 +1,233 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+
+	"selfupdate.blockthrough.com/pkg/crypto"
+	"selfupdate.blockthrough.com/pkg/hash"
+)
+
+// A multi-signature envelope is prepended to the content and collects the
+// signatures of several keys, one cosigner at a time
+//
+//	| "SUMS" | 0x01 | count (1 byte) | count x ( key id (8 bytes) | signature (64 bytes) ) | content |
+//	| "SUMS" | 0x02 | hash algorithm (1 byte) | count (1 byte) | entries | content |
+//
+// every signature is the ed25519 signature of the digest of the content, the
+// same digest a DigestSigner signs. Version 1 is always SHA-256, version 2
+// names the algorithm, like the signature header.
+const (
+	multiSignatureMagic    = "SUMS"
+	multiSignatureVersion1 = 0x01
+	multiSignatureVersion2 = 0x02
+
+	multiSignatureHeaderSize = len(multiSignatureMagic) + 2
+	multiSignatureEntrySize  = crypto.KeyIDSize + crypto.SignatureSize
+	multiSignatureMaxCount   = 255
+)
+
+var (
+	ErrMultiSignatureInvalid = errors.New("multi-signature envelope is invalid")
+	ErrMultiSignatureTooMany = errors.New("multi-signature envelope is full")
+	ErrThresholdNotMet       = errors.New("not enough valid signatures")
+	ErrThresholdInvalid      = errors.New("threshold must be between 1 and the number of trusted keys")
+)
+
+type multiSignatureEntry struct {
+	keyID     crypto.KeyID
+	signature []byte
+}
+
+type multiSignature struct {
+	algorithm hash.Algorithm
+	entries   []multiSignatureEntry
+}
+
+func (m *multiSignature) Bytes() []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString(multiSignatureMagic)
+	if m.algorithm == hash.SHA256 {
+		buffer.WriteByte(multiSignatureVersion1)
+	} else {
+		buffer.WriteByte(multiSignatureVersion2)
+		buffer.WriteByte(byte(m.algorithm))
+	}
+	buffer.WriteByte(byte(len(m.entries)))
+	for _, entry := range m.entries {
+		buffer.Write(entry.keyID[:])
+		buffer.Write(entry.signature)
+	}
+
+	return buffer.Bytes()
+}
+
+// add appends the signature, or replaces the previous signature of the same key
+func (m *multiSignature) add(entry multiSignatureEntry) error {
+	for i := range m.entries {
+		if m.entries[i].keyID == entry.keyID {
+			m.entries[i] = entry
+			return nil
+		}
+	}
+
+	if len(m.entries) >= multiSignatureMaxCount {
+		return ErrMultiSignatureTooMany
+	}
+
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+// decodeMultiSignature splits data into the envelope and the content. The
+// returned bool is false if data doesn't start with an envelope.
+func decodeMultiSignature(data []byte) (*multiSignature, []byte, bool, error) {
+	if len(data) < multiSignatureHeaderSize || !bytes.HasPrefix(data, []byte(multiSignatureMagic)) {
+		return nil, nil, false, nil
+	}
+
+	sig := &multiSignature{algorithm: hash.SHA256}
+	header := multiSignatureHeaderSize
+
+	switch data[len(multiSignatureMagic)] {
+	case multiSignatureVersion1:
+	case multiSignatureVersion2:
+		if len(data) < header+1 {
+			return nil, nil, true, ErrMultiSignatureInvalid
+		}
+
+		sig.algorithm = hash.Algorithm(data[len(multiSignatureMagic)+1])
+		header++
+	default:
+		return nil, nil, false, nil
+	}
+
+	count := int(data[header-1])
+	end := header + count*multiSignatureEntrySize
+	if len(data) < end {
+		return nil, nil, true, ErrMultiSignatureInvalid
+	}
+
+	for offset := header; offset < end; offset += multiSignatureEntrySize {
+		var entry multiSignatureEntry
+		copy(entry.keyID[:], data[offset:])
+		entry.signature = data[offset+crypto.KeyIDSize : offset+multiSignatureEntrySize]
+
+		sig.entries = append(sig.entries, entry)
+	}
+
+	return sig, data[end:], true, nil
+}
+
+// NewCosigner adds the signature of signer to a multi-signature envelope. If
+// the content is not in an envelope yet, a new one is created, so the first
+// release engineer signs the raw asset and everyone else signs the output of
+// the previous one. Signing twice with the same key replaces the signature.
+// WithSignerHash sets the digest algorithm of a new envelope, the signatures
+// added to an existing one use the algorithm of the envelope.
+func NewCosigner(signer crypto.DigestSigner, optFns ...signerOptFn) Signer {
+	opts := &signerOptions{
+		hash: hash.SHA256,
+	}
+
+	for _, optFn := range optFns {
+		optFn(opts)
+	}
+
+	return SignerFunc(func(ctx context.Context, r io.Reader) io.Reader {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return newErrorReader(err)
+		}
+
+		sig, content, ok, err := decodeMultiSignature(data)
+		if err != nil {
+			return newErrorReader(err)
+		} else if !ok {
+			sig, content = &multiSignature{algorithm: opts.hash}, data
+		}
+
+		contentHash, err := sig.algorithm.FromReader(bytes.NewReader(content))
+		if err != nil {
+			return newErrorReader(err)
+		}
+
+		signed, err := signer.SignDigest(ctx, contentHash)
+		if err != nil {
+			return newErrorReader(err)
+		}
+
+		if len(signed) != crypto.SignatureSize {
+			return newErrorReader(crypto.ErrInvalidSignature)
+		}
+
+		err = sig.add(multiSignatureEntry{
+			keyID:     signer.Public().ID(),
+			signature: signed,
+		})
+		if err != nil {
+			return newErrorReader(err)
+		}
+
+		return io.MultiReader(
+			bytes.NewReader(sig.Bytes()),
+			bytes.NewReader(content),
+		)
+	})
+}
+
+// NewThresholdVerifier accepts content in a multi-signature envelope only if
+// it carries valid signatures of at least threshold distinct keys of the
+// keyring. Signatures of unknown keys are ignored, and so is the whole envelope
+// if its digest algorithm is not allowed by WithVerifierHashes.
+func NewThresholdVerifier(keyring *crypto.Keyring, threshold int, optFns ...verifierOptFn) Verifier {
+	opts := newVerifierOptions(optFns)
+
+	return VerifierFunc(func(ctx context.Context, r io.Reader) io.Reader {
+		if threshold < 1 || threshold > keyring.Len() {
+			return newErrorReader(ErrThresholdInvalid)
+		}
+
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return newErrorReader(err)
+		}
+
+		sig, content, ok, err := decodeMultiSignature(data)
+		if err != nil {
+			return newErrorReader(err)
+		} else if !ok {
+			return newErrorReader(ErrMultiSignatureInvalid)
+		}
+
+		if !opts.allows(sig.algorithm) {
+			return newErrorReader(ErrHashNotAllowed)
+		}
+
+		contentHash, err := sig.algorithm.FromReader(bytes.NewReader(content))
+		if err != nil {
+			return newErrorReader(err)
+		}
+
+		valid := map[crypto.KeyID]bool{}
+		for _, entry := range sig.entries {
+			key, ok := keyring.Get(entry.keyID)
+			if !ok {
+				continue
+			}
+
+			signedHash := append(append([]byte{}, entry.signature...), contentHash...)
+			if key.Verify(signedHash) {
+				valid[entry.keyID] = true
+			}
+		}
+
+		if len(valid) < threshold {
+			return newErrorReader(ErrThresholdNotMet)
+		}
+
+		return bytes.NewReader(content)
+	})
+}
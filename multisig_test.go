@@ -0,0 +1,135 @@
+package selfupdate_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"selfupdate.blockthrough.com"
+	"selfupdate.blockthrough.com/pkg/crypto"
+	"selfupdate.blockthrough.com/pkg/hash"
+)
+
+func cosign(t *testing.T, content io.Reader, privateKeys ...crypto.PrivateKey) io.Reader {
+	t.Helper()
+
+	for _, privateKey := range privateKeys {
+		content = selfupdate.NewCosigner(privateKey).Sign(context.Background(), content)
+	}
+
+	return content
+}
+
+func TestThresholdVerifier(t *testing.T) {
+	var publicKeys []crypto.PublicKey
+	var privateKeys []crypto.PrivateKey
+
+	for i := 0; i < 3; i++ {
+		publicKey, privateKey, err := crypto.GenerateKeys()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		publicKeys = append(publicKeys, publicKey)
+		privateKeys = append(privateKeys, privateKey)
+	}
+
+	_, untrustedPrivateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := selfupdate.NewThresholdVerifier(crypto.NewKeyring(publicKeys...), 2)
+
+	tests := []struct {
+		name    string
+		signers []crypto.PrivateKey
+		err     error
+	}{
+		{"one of three", privateKeys[:1], selfupdate.ErrThresholdNotMet},
+		{"two of three", privateKeys[:2], nil},
+		{"three of three", privateKeys, nil},
+		{"same key twice", []crypto.PrivateKey{privateKeys[0], privateKeys[0]}, selfupdate.ErrThresholdNotMet},
+		{"one and untrusted", []crypto.PrivateKey{privateKeys[0], untrustedPrivateKey}, selfupdate.ErrThresholdNotMet},
+	}
+
+	for _, tt := range tests {
+		signed := cosign(t, strings.NewReader("hello, world"), tt.signers...)
+		content, err := io.ReadAll(verifier.Verify(context.Background(), signed))
+
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v but got %v", tt.name, tt.err, err)
+		} else if err == nil && string(content) != "hello, world" {
+			t.Errorf("%s: content is not matched", tt.name)
+		}
+	}
+}
+
+func TestThresholdVerifierTamperedContent(t *testing.T) {
+	publicKey1, privateKey1, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey2, privateKey2, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := io.ReadAll(cosign(t, strings.NewReader("hello, world"), privateKey1, privateKey2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed[len(signed)-1] ^= 0xff
+
+	verifier := selfupdate.NewThresholdVerifier(crypto.NewKeyring(publicKey1, publicKey2), 2)
+	_, err = io.ReadAll(verifier.Verify(context.Background(), strings.NewReader(string(signed))))
+	if !errors.Is(err, selfupdate.ErrThresholdNotMet) {
+		t.Fatalf("expected ErrThresholdNotMet but got %v", err)
+	}
+
+	verifier = selfupdate.NewThresholdVerifier(crypto.NewKeyring(publicKey1, publicKey2), 3)
+	_, err = io.ReadAll(verifier.Verify(context.Background(), strings.NewReader(string(signed))))
+	if !errors.Is(err, selfupdate.ErrThresholdInvalid) {
+		t.Fatalf("expected ErrThresholdInvalid but got %v", err)
+	}
+}
+
+func TestThresholdVerifierHashes(t *testing.T) {
+	publicKey1, privateKey1, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey2, privateKey2, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the second cosigner follows the algorithm of the envelope
+	content := selfupdate.NewCosigner(privateKey1, selfupdate.WithSignerHash(hash.BLAKE3)).Sign(context.Background(), strings.NewReader("hello, world"))
+	content = selfupdate.NewCosigner(privateKey2).Sign(context.Background(), content)
+
+	signed, err := io.ReadAll(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := crypto.NewKeyring(publicKey1, publicKey2)
+
+	data, err := io.ReadAll(selfupdate.NewThresholdVerifier(keyring, 2).Verify(context.Background(), strings.NewReader(string(signed))))
+	if err != nil {
+		t.Fatal(err)
+	} else if string(data) != "hello, world" {
+		t.Fatal("content is not matched")
+	}
+
+	verifier := selfupdate.NewThresholdVerifier(keyring, 2, selfupdate.WithVerifierHashes(hash.SHA256))
+	_, err = io.ReadAll(verifier.Verify(context.Background(), strings.NewReader(string(signed))))
+	if !errors.Is(err, selfupdate.ErrHashNotAllowed) {
+		t.Fatalf("expected ErrHashNotAllowed but got %v", err)
+	}
+}
@@ -51,3 +51,18 @@ func copyFile(dst, src string) error {
 
 	return writeToFile(dst, in)
 }
+
+// restoreFile replaces dst with a copy of src. The copy is renamed over dst, so
+// it works even if dst is the running executable.
+func restoreFile(dst, src string) error {
+	tmp := dst + ".restore"
+	if err := copyFile(tmp, src); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp, 0755); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, dst)
+}
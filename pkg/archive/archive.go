@@ -0,0 +1,241 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultMaxSize bounds the archive and the files extracted from it, so a
+// corrupt archive or a compression bomb can't exhaust the memory
+const DefaultMaxSize = 1 << 30
+
+var (
+	ErrUnknownFormat = errors.New("unknown archive format")
+	ErrUnsafePath    = errors.New("unsafe path in archive")
+	ErrTooLarge      = errors.New("archive is too large")
+)
+
+type extractOptions struct {
+	maxSize int64
+}
+
+type extractOptFn func(opts *extractOptions)
+
+// WithMaxSize bounds the size of the archive and the total size of the files
+// extracted from it, DefaultMaxSize by default
+func WithMaxSize(size int64) extractOptFn {
+	return func(opts *extractOptions) {
+		opts.maxSize = size
+	}
+}
+
+type Format int
+
+const (
+	Unknown Format = iota
+	Tar
+	TarGzip
+	Zip
+)
+
+// File is a regular file extracted from an archive. Directories, symlinks and
+// other special entries are never returned.
+type File struct {
+	Name string
+	Mode fs.FileMode
+	Data []byte
+}
+
+// IsExecutable reports whether any of the executable bits are set on the file.
+func (f *File) IsExecutable() bool {
+	return f.Mode&0111 != 0
+}
+
+// Detect looks at the magic bytes of data and returns the archive format
+func Detect(data []byte) Format {
+	switch {
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		return TarGzip
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		return Zip
+	case len(data) > 262 && bytes.Equal(data[257:262], []byte("ustar")):
+		return Tar
+	}
+
+	return Unknown
+}
+
+// Extract reads the whole archive from r, detects its format and returns all
+// the regular files inside it. Every file name is cleaned and checked so it
+// can't escape the directory it is going to be extracted to. An archive, or
+// files, larger than the maximum size fail with ErrTooLarge.
+func Extract(r io.Reader, optFns ...extractOptFn) ([]File, error) {
+	opts := &extractOptions{
+		maxSize: DefaultMaxSize,
+	}
+
+	for _, optFn := range optFns {
+		optFn(opts)
+	}
+
+	data, err := readLimited(r, opts.maxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// the files share the limit, so many small ones can't add up either
+	remaining := opts.maxSize
+
+	switch Detect(data) {
+	case Tar:
+		return extractTar(bytes.NewReader(data), &remaining)
+	case TarGzip:
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+
+		return extractTar(gz, &remaining)
+	case Zip:
+		return extractZip(data, &remaining)
+	}
+
+	return nil, ErrUnknownFormat
+}
+
+// readLimited reads r to the end, failing once more than limit bytes are read
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > limit {
+		return nil, ErrTooLarge
+	}
+
+	return data, nil
+}
+
+// readFile reads a file of the archive within the remaining size
+func readFile(r io.Reader, name string, remaining *int64) ([]byte, error) {
+	data, err := readLimited(r, *remaining)
+	if errors.Is(err, ErrTooLarge) {
+		return nil, fmt.Errorf("%w: %s", ErrTooLarge, name)
+	} else if err != nil {
+		return nil, err
+	}
+
+	*remaining -= int64(len(data))
+	return data, nil
+}
+
+// SafeJoin joins name to dir and makes sure the result stays inside dir.
+// Absolute names and names containing ".." which walk out of dir are rejected.
+func SafeJoin(dir string, name string) (string, error) {
+	cleaned, err := cleanName(name)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, filepath.FromSlash(cleaned)), nil
+}
+
+func cleanName(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if name == "" || path.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", ErrUnsafePath
+	}
+
+	cleaned := path.Clean(name)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", ErrUnsafePath
+	}
+
+	return cleaned, nil
+}
+
+func extractTar(r io.Reader, remaining *int64) ([]File, error) {
+	var files []File
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name, err := cleanName(header.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := readFile(tr, name, remaining)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, File{
+			Name: name,
+			Mode: fs.FileMode(header.Mode).Perm(),
+			Data: data,
+		})
+	}
+
+	return files, nil
+}
+
+func extractZip(data []byte, remaining *int64) ([]File, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	var files []File
+
+	for _, zf := range zr.File {
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+
+		name, err := cleanName(zf.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := readFile(rc, name, remaining)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, File{
+			Name: name,
+			Mode: zf.Mode().Perm(),
+			Data: data,
+		})
+	}
+
+	return files, nil
+}
@@ -0,0 +1,136 @@
+package archive_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"selfupdate.blockthrough.com/pkg/archive"
+)
+
+func TestExtractTarGzip(t *testing.T) {
+	var buffer bytes.Buffer
+	gw := gzip.NewWriter(&buffer)
+	tw := tar.NewWriter(gw)
+
+	writeTarFile(t, tw, "app_linux_amd64/app", 0755, "binary")
+	writeTarFile(t, tw, "app_linux_amd64/LICENSE", 0644, "license")
+
+	tw.Close()
+	gw.Close()
+
+	files, err := archive.Extract(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(files))
+	}
+
+	if files[0].Name != "app_linux_amd64/app" || !files[0].IsExecutable() || string(files[0].Data) != "binary" {
+		t.Fatal("binary is not matched")
+	}
+
+	if files[1].IsExecutable() {
+		t.Fatal("license should not be executable")
+	}
+}
+
+func TestExtractZip(t *testing.T) {
+	var buffer bytes.Buffer
+	zw := zip.NewWriter(&buffer)
+
+	header := &zip.FileHeader{Name: "app.exe"}
+	header.SetMode(0755)
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("binary"))
+	zw.Close()
+
+	files, err := archive.Extract(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 || files[0].Name != "app.exe" || string(files[0].Data) != "binary" {
+		t.Fatal("zip content is not matched")
+	}
+}
+
+func TestExtractUnsafePath(t *testing.T) {
+	for _, name := range []string{"../evil", "/etc/passwd", "a/../../evil"} {
+		var buffer bytes.Buffer
+		tw := tar.NewWriter(&buffer)
+		writeTarFile(t, tw, name, 0644, "evil")
+		tw.Close()
+
+		_, err := archive.Extract(&buffer)
+		if !errors.Is(err, archive.ErrUnsafePath) {
+			t.Fatalf("expected unsafe path error for %q, got %v", name, err)
+		}
+	}
+}
+
+func TestExtractMaxSize(t *testing.T) {
+	tarGzip := func(contents ...string) *bytes.Buffer {
+		var buffer bytes.Buffer
+		gw := gzip.NewWriter(&buffer)
+		tw := tar.NewWriter(gw)
+
+		for i, content := range contents {
+			writeTarFile(t, tw, fmt.Sprintf("file%d", i), 0644, content)
+		}
+
+		tw.Close()
+		gw.Close()
+
+		return &buffer
+	}
+
+	bomb := strings.Repeat("0", 1<<20)
+
+	tests := []struct {
+		name    string
+		archive *bytes.Buffer
+		maxSize int64
+		err     error
+	}{
+		{"within", tarGzip("binary", "license"), 1 << 10, nil},
+		{"large archive", tarGzip(bomb), 100, archive.ErrTooLarge},
+		{"large file", tarGzip(bomb), 64 << 10, archive.ErrTooLarge},
+		{"large files", tarGzip(bomb[:40<<10], bomb[:40<<10]), 64 << 10, archive.ErrTooLarge},
+	}
+
+	for _, tt := range tests {
+		_, err := archive.Extract(tt.archive, archive.WithMaxSize(tt.maxSize))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v but got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func writeTarFile(t *testing.T, tw *tar.Writer, name string, mode int64, content string) {
+	t.Helper()
+
+	err := tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     mode,
+		Size:     int64(len(content)),
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tw.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+}
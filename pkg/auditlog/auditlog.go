@@ -0,0 +1,264 @@
+package auditlog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"selfupdate.blockthrough.com/pkg/fileutil"
+)
+
+// the events of an update, in the order they happen
+const (
+	EventCheck    = "check"
+	EventDownload = "download"
+	EventVerify   = "verify"
+	EventInstall  = "install"
+	EventRollback = "rollback"
+)
+
+var (
+	ErrChainBroken = errors.New("update log chain is broken")
+)
+
+// headChunkSize is how much of the end of the file is read at once to find
+// the last entry
+const headChunkSize = 4096
+
+// Entry is one event of the log. Hash covers every other field, including the
+// hash of the previous entry, so changing, removing or reordering any entry
+// breaks the chain of all the following ones.
+type Entry struct {
+	Seq            int64     `json:"seq"`
+	Time           time.Time `json:"time"`
+	Event          string    `json:"event"`
+	CurrentVersion string    `json:"currentVersion,omitempty"`
+	NewVersion     string    `json:"newVersion,omitempty"`
+	Asset          string    `json:"asset,omitempty"`
+	// Digest is the digest of the asset prefixed with the algorithm, e.g. sha256:<hex>
+	Digest string   `json:"digest,omitempty"`
+	KeyIDs []string `json:"keyIds,omitempty"`
+	// Error is empty if the event succeeded
+	Error string `json:"error,omitempty"`
+	Prev  string `json:"prev"`
+	Hash  string `json:"hash"`
+}
+
+// hash returns the hex of the SHA-256 of the entry without its own hash
+func (e Entry) hash() (string, error) {
+	e.Hash = ""
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Log appends entries to a file with one JSON entry per line. The file is
+// only ever appended to, and every write is synced before Append returns.
+// Appends of several processes are serialized by an exclusive lock of the file.
+type Log struct {
+	mu   sync.Mutex
+	path string
+	now  func() time.Time
+}
+
+type logOptFn func(l *Log)
+
+// WithLogClock overrides the clock of the entry times, it's mostly useful for tests
+func WithLogClock(now func() time.Time) logOptFn {
+	return func(l *Log) {
+		l.now = now
+	}
+}
+
+// New returns a log which appends to the file at path, the file and its
+// directory are created on the first append
+func New(path string, optFns ...logOptFn) *Log {
+	l := &Log{
+		path: path,
+		now:  time.Now,
+	}
+
+	for _, optFn := range optFns {
+		optFn(l)
+	}
+
+	return l
+}
+
+// Append chains the entry to the last one of the file and writes it, Seq, Prev
+// and Hash are set by the log and Time if it's zero
+func (l *Log) Append(entry Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// the file may be appended by another process, e.g. the new version, so
+	// the head is read again under the lock on every append
+	if err := fileutil.Lock(f); err != nil {
+		return err
+	}
+	defer fileutil.Unlock(f)
+
+	head, err := readHead(f)
+	if err != nil {
+		return err
+	}
+
+	if head != nil {
+		entry.Seq = head.Seq + 1
+		entry.Prev = head.Hash
+	} else {
+		entry.Seq = 0
+		entry.Prev = ""
+	}
+
+	if entry.Time.IsZero() {
+		entry.Time = l.now()
+	}
+	entry.Time = entry.Time.UTC()
+
+	entry.Hash, err = entry.hash()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// readHead returns the last entry of the file, or nil if there is none. The
+// file is read backwards from its end, so appending doesn't get slower as the
+// log grows.
+func readHead(f *os.File) (*Entry, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var tail []byte
+	for offset := info.Size(); offset > 0; {
+		n := min(offset, headChunkSize)
+		offset -= n
+
+		chunk := make([]byte, n)
+		if _, err := f.ReadAt(chunk, offset); err != nil {
+			return nil, err
+		}
+		tail = append(chunk, tail...)
+
+		// the last line is complete once the newline before it is read
+		lines := bytes.TrimRight(tail, " \t\r\n")
+		i := bytes.LastIndexByte(lines, '\n')
+		if i < 0 && offset > 0 {
+			continue
+		}
+
+		data := bytes.TrimSpace(lines[i+1:])
+		if len(data) == 0 {
+			return nil, nil
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, fmt.Errorf("last entry: %w", err)
+		}
+
+		return &entry, nil
+	}
+
+	return nil, nil
+}
+
+// Read returns the entries of a log without checking the chain
+func Read(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Verify checks that every entry has its own hash and the one of the entry
+// before it, and that the sequence numbers have no gaps. Removing entries from
+// the end can't be detected by the chain, so the hash of the last entry should
+// be kept somewhere else, e.g. printed by 'selfupdate log verify'.
+func Verify(entries []Entry) error {
+	prev := ""
+
+	for i, entry := range entries {
+		if entry.Seq != int64(i) {
+			return fmt.Errorf("%w: entry %d has sequence number %d", ErrChainBroken, i, entry.Seq)
+		}
+
+		if entry.Prev != prev {
+			return fmt.Errorf("%w: entry %d doesn't follow the previous entry", ErrChainBroken, i)
+		}
+
+		hash, err := entry.hash()
+		if err != nil {
+			return err
+		}
+
+		if entry.Hash != hash {
+			return fmt.Errorf("%w: entry %d was modified", ErrChainBroken, i)
+		}
+
+		prev = entry.Hash
+	}
+
+	return nil
+}
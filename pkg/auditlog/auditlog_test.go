@@ -0,0 +1,117 @@
+package auditlog_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"selfupdate.blockthrough.com/pkg/auditlog"
+)
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log", "updates.jsonl")
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	log := auditlog.New(path, auditlog.WithLogClock(func() time.Time { return now }))
+
+	for _, entry := range []auditlog.Entry{
+		{Event: auditlog.EventCheck, CurrentVersion: "v1.0.0", NewVersion: "v1.1.0", Asset: "app-linux-amd64"},
+		{Event: auditlog.EventDownload, NewVersion: "v1.1.0", Asset: "app-linux-amd64", Digest: "sha256:09ca7e4eaa6e8ae9c7d261167129184883644d07dfba7cbfbc4c8a2e08360d5b"},
+		{Event: auditlog.EventVerify, NewVersion: "v1.1.0", KeyIDs: []string{"bb1f5cacb4ca05b4"}},
+		{Event: auditlog.EventInstall, CurrentVersion: "v1.1.0"},
+	} {
+		if err := log.Append(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := auditlog.Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 4 || entries[3].Seq != 3 || entries[3].Prev != entries[2].Hash || !entries[0].Time.Equal(now) {
+		t.Fatalf("entries are not chained: %+v", entries)
+	}
+
+	if err := auditlog.Verify(entries); err != nil {
+		t.Fatal(err)
+	}
+
+	modified := slices.Clone(entries)
+	modified[1].Digest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+
+	reordered := slices.Clone(entries)
+	reordered[1], reordered[2] = reordered[2], reordered[1]
+
+	tests := []struct {
+		name    string
+		entries []auditlog.Entry
+		err     error
+	}{
+		{"valid", entries, nil},
+		{"truncated", entries[:2], nil},
+		{"modified", modified, auditlog.ErrChainBroken},
+		{"removed", slices.Delete(slices.Clone(entries), 1, 2), auditlog.ErrChainBroken},
+		{"reordered", reordered, auditlog.ErrChainBroken},
+		{"first removed", entries[1:], auditlog.ErrChainBroken},
+	}
+
+	for _, tt := range tests {
+		if err := auditlog.Verify(tt.entries); !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v but got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestLogConcurrentAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "updates.jsonl")
+
+	// every log stands for another process appending to the same file, the
+	// assets make the log longer than a chunk of the head lookup
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			log := auditlog.New(path)
+			for j := 0; j < 25; j++ {
+				if err := log.Append(auditlog.Entry{Event: auditlog.EventCheck, Asset: strings.Repeat("a", 100)}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := auditlog.Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 100 {
+		t.Fatalf("expected 100 entries but got %d", len(entries))
+	}
+
+	if err := auditlog.Verify(entries); err != nil {
+		t.Fatal(err)
+	}
+}
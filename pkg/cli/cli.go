@@ -8,6 +8,8 @@ type Context = cli.Context
 type Flag = cli.Flag
 type StringFlag = cli.StringFlag
 type BoolFlag = cli.BoolFlag
+type IntFlag = cli.IntFlag
+type DurationFlag = cli.DurationFlag
 
 var (
 	Exit = cli.Exit
@@ -0,0 +1,149 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	EncodingHex    = "hex"
+	EncodingBase64 = "base64"
+	EncodingRaw    = "raw"
+
+	// CommandSignerKeyIDEnv and CommandSignerAlgorithmEnv are set for the
+	// command, so a single helper can serve several keys
+	CommandSignerKeyIDEnv     = "SELFUPDATE_KEY_ID"
+	CommandSignerAlgorithmEnv = "SELFUPDATE_DIGEST_ALGORITHM"
+)
+
+type commandSignerOptions struct {
+	encoding string
+	env      []string
+}
+
+type commandSignerOptFn func(opts *commandSignerOptions)
+
+// WithCommandSignerEncoding sets the encoding of both the digest written to
+// the command and the signature read from it, one of hex (default), base64 or raw
+func WithCommandSignerEncoding(encoding string) commandSignerOptFn {
+	return func(opts *commandSignerOptions) {
+		opts.encoding = encoding
+	}
+}
+
+// WithCommandSignerEnv adds environment variables, in key=value form, to the
+// environment of the command
+func WithCommandSignerEnv(env ...string) commandSignerOptFn {
+	return func(opts *commandSignerOptions) {
+		opts.env = append(opts.env, env...)
+	}
+}
+
+// CommandSigner is a DigestSigner which delegates to an external command, much
+// like gpg.program in git. The digest is written to the stdin of the command
+// and the signature is read from its stdout. The command is expected to exit
+// with a non-zero code if it fails, and anything it writes to stderr is
+// returned as part of the error.
+type CommandSigner struct {
+	publicKey PublicKey
+	name      string
+	args      []string
+	opts      *commandSignerOptions
+}
+
+var _ DigestSigner = (*CommandSigner)(nil)
+
+// NewCommandSigner returns a signer which runs name with args for every digest.
+// The public key is required, since every returned signature is checked
+// against it before it's used.
+func NewCommandSigner(publicKey PublicKey, name string, args []string, optFns ...commandSignerOptFn) *CommandSigner {
+	opts := &commandSignerOptions{
+		encoding: EncodingHex,
+	}
+
+	for _, optFn := range optFns {
+		optFn(opts)
+	}
+
+	return &CommandSigner{
+		publicKey: publicKey,
+		name:      name,
+		args:      args,
+		opts:      opts,
+	}
+}
+
+func (c *CommandSigner) Public() PublicKey {
+	return c.publicKey
+}
+
+func (c *CommandSigner) SignDigest(ctx context.Context, digest []byte) ([]byte, error) {
+	input, err := encodeDigest(digest, c.opts.encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, c.name, c.args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(),
+		CommandSignerKeyIDEnv+"="+c.publicKey.ID().String(),
+		CommandSignerAlgorithmEnv+"=sha256",
+	)
+	cmd.Env = append(cmd.Env, c.opts.env...)
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("signer command failed: %w: %s", err, msg)
+		}
+		return nil, fmt.Errorf("signer command failed: %w", err)
+	}
+
+	sig, err := decodeSignature(stdout.Bytes(), c.opts.encoding)
+	if err != nil || len(sig) != SignatureSize {
+		return nil, ErrInvalidSignature
+	}
+
+	// a misconfigured helper, e.g. one pointing to the wrong key in a KMS,
+	// should fail here rather than on every client
+	if !c.publicKey.Verify(append(sig, digest...)) {
+		return nil, ErrInvalidSignature
+	}
+
+	return sig, nil
+}
+
+func encodeDigest(digest []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case EncodingHex:
+		return []byte(hex.EncodeToString(digest) + "\n"), nil
+	case EncodingBase64:
+		return []byte(base64.StdEncoding.EncodeToString(digest) + "\n"), nil
+	case EncodingRaw:
+		return digest, nil
+	}
+
+	return nil, ErrUnknownFormat
+}
+
+func decodeSignature(output []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case EncodingHex:
+		return hex.DecodeString(strings.TrimSpace(string(output)))
+	case EncodingBase64:
+		return base64.StdEncoding.DecodeString(strings.TrimSpace(string(output)))
+	case EncodingRaw:
+		return output, nil
+	}
+
+	return nil, ErrUnknownFormat
+}
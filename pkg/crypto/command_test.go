@@ -0,0 +1,200 @@
+package crypto_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"selfupdate.blockthrough.com/pkg/crypto"
+)
+
+// TestHelperSigner is not a real test, it's the fake signer process run by the
+// command signer tests through os.Args[0]
+func TestHelperSigner(t *testing.T) {
+	if os.Getenv("SELFUPDATE_HELPER_SIGNER") != "1" {
+		return
+	}
+
+	os.Exit(runHelperSigner())
+}
+
+func runHelperSigner() int {
+	privateKey, err := crypto.ParsePrivateKey(os.Getenv("SELFUPDATE_HELPER_KEY"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if os.Getenv(crypto.CommandSignerKeyIDEnv) != privateKey.Public().ID().String() {
+		fmt.Fprintln(os.Stderr, "unexpected key id")
+		return 1
+	}
+
+	input, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	encoding := os.Getenv("SELFUPDATE_HELPER_ENCODING")
+
+	var digest []byte
+	switch encoding {
+	case crypto.EncodingHex:
+		digest, err = hex.DecodeString(strings.TrimSpace(string(input)))
+	case crypto.EncodingBase64:
+		digest, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(input)))
+	default:
+		digest = input
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	sig, _ := privateKey.SignDigest(context.Background(), digest)
+
+	switch encoding {
+	case crypto.EncodingHex:
+		fmt.Fprintln(os.Stdout, hex.EncodeToString(sig))
+	case crypto.EncodingBase64:
+		fmt.Fprintln(os.Stdout, base64.StdEncoding.EncodeToString(sig))
+	default:
+		os.Stdout.Write(sig)
+	}
+
+	return 0
+}
+
+func newHelperSigner(publicKey crypto.PublicKey, privateKey crypto.PrivateKey, encoding string) *crypto.CommandSigner {
+	return crypto.NewCommandSigner(
+		publicKey,
+		os.Args[0],
+		[]string{"-test.run=TestHelperSigner"},
+		crypto.WithCommandSignerEncoding(encoding),
+		crypto.WithCommandSignerEnv(
+			"SELFUPDATE_HELPER_SIGNER=1",
+			"SELFUPDATE_HELPER_KEY="+privateKey.String(),
+			"SELFUPDATE_HELPER_ENCODING="+encoding,
+		),
+	)
+}
+
+func TestCommandSigner(t *testing.T) {
+	publicKey, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := make([]byte, 32)
+	copy(digest, "hello, world")
+
+	for _, encoding := range []string{crypto.EncodingHex, crypto.EncodingBase64, crypto.EncodingRaw} {
+		sig, err := newHelperSigner(publicKey, privateKey, encoding).SignDigest(context.Background(), digest)
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+
+		if !publicKey.Verify(append(sig, digest...)) {
+			t.Errorf("%s: signature is not valid", encoding)
+		}
+	}
+}
+
+func TestCommandSignerWrongKey(t *testing.T) {
+	publicKey, _, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, otherPrivateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer := crypto.NewCommandSigner(
+		publicKey,
+		os.Args[0],
+		[]string{"-test.run=TestHelperSigner"},
+		crypto.WithCommandSignerEnv(
+			"SELFUPDATE_HELPER_SIGNER=1",
+			"SELFUPDATE_HELPER_KEY="+otherPrivateKey.String(),
+			"SELFUPDATE_HELPER_ENCODING="+crypto.EncodingHex,
+			// the helper checks the key id, so pretend it's the expected one
+			crypto.CommandSignerKeyIDEnv+"="+otherPrivateKey.Public().ID().String(),
+		),
+	)
+
+	_, err = signer.SignDigest(context.Background(), make([]byte, 32))
+	if !errors.Is(err, crypto.ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature but got %v", err)
+	}
+}
+
+func TestCommandSignerFailure(t *testing.T) {
+	publicKey, _, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer := crypto.NewCommandSigner(
+		publicKey,
+		os.Args[0],
+		[]string{"-test.run=TestHelperSigner"},
+		crypto.WithCommandSignerEnv(
+			"SELFUPDATE_HELPER_SIGNER=1",
+			"SELFUPDATE_HELPER_KEY=not a key",
+		),
+	)
+
+	_, err = signer.SignDigest(context.Background(), make([]byte, 32))
+	if err == nil || !strings.Contains(err.Error(), "invalid") {
+		t.Fatalf("expected the stderr of the command in the error but got %v", err)
+	}
+}
+
+func TestSignerProvider(t *testing.T) {
+	_, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = crypto.RegisterSignerProvider("test", func(ctx context.Context, uri string) (crypto.DigestSigner, error) {
+		if uri != "test:token=release" {
+			return nil, crypto.ErrInvalidKey
+		}
+		return privateKey, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = crypto.RegisterSignerProvider("test", nil)
+	if !errors.Is(err, crypto.ErrSignerProviderExists) {
+		t.Errorf("expected ErrSignerProviderExists but got %v", err)
+	}
+
+	if !crypto.HasSignerProvider("test:token=release") {
+		t.Error("expected the provider to be registered")
+	}
+
+	signer, err := crypto.OpenSigner(context.Background(), "test:token=release")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if signer.Public() != privateKey.Public() {
+		t.Error("public key is not matched")
+	}
+
+	_, err = crypto.OpenSigner(context.Background(), "pkcs11:token=release")
+	if !errors.Is(err, crypto.ErrUnknownSignerProvider) {
+		t.Errorf("expected ErrUnknownSignerProvider but got %v", err)
+	}
+}
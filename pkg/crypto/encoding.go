@@ -0,0 +1,178 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	FormatHex      = "hex"
+	FormatPEM      = "pem"
+	FormatOpenSSH  = "openssh"
+	FormatMinisign = "minisign"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown key format")
+)
+
+const (
+	pemPublicKeyType         = "PUBLIC KEY"
+	pemPrivateKeyType        = "PRIVATE KEY"
+	pemOpenSSHPrivateKeyType = "OPENSSH PRIVATE KEY"
+
+	openSSHKeyComment = "selfupdate"
+)
+
+// DetectFormat guesses the format of an encoded public or private key
+func DetectFormat(key string) string {
+	key = strings.TrimSpace(key)
+
+	switch {
+	case strings.HasPrefix(key, "-----BEGIN "+pemEncryptedPrivateKeyType+"-----"):
+		return FormatEncrypted
+	case strings.HasPrefix(key, "-----BEGIN "+pemOpenSSHPrivateKeyType+"-----"):
+		return FormatOpenSSH
+	case strings.HasPrefix(key, "-----BEGIN "):
+		return FormatPEM
+	case strings.HasPrefix(key, ssh.KeyAlgoED25519+" "):
+		return FormatOpenSSH
+	case strings.HasPrefix(key, "untrusted comment:"), strings.HasPrefix(key, "RW"):
+		// "RW" is how the "Ed" algorithm of minisign keys starts in base64,
+		// it can't be confused with hex
+		return FormatMinisign
+	}
+
+	return FormatHex
+}
+
+// EncodePublicKey encodes the public key in one of the hex, pem or openssh
+// formats. Minisign keys carry their own key id, please refer to MinisignPublicKey.
+func EncodePublicKey(key PublicKey, format string) (string, error) {
+	switch format {
+	case FormatHex:
+		return key.String(), nil
+	case FormatPEM:
+		der, err := x509.MarshalPKIXPublicKey(ed25519.PublicKey(key[:]))
+		if err != nil {
+			return "", err
+		}
+
+		return string(pem.EncodeToMemory(&pem.Block{Type: pemPublicKeyType, Bytes: der})), nil
+	case FormatOpenSSH:
+		sshKey, err := ssh.NewPublicKey(ed25519.PublicKey(key[:]))
+		if err != nil {
+			return "", err
+		}
+
+		line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshKey)))
+		return line + " " + openSSHKeyComment + "\n", nil
+	}
+
+	return "", ErrUnknownFormat
+}
+
+// EncodePrivateKey encodes the private key in one of the hex, pem or openssh
+// formats, pem keys are PKCS#8
+func EncodePrivateKey(key PrivateKey, format string) (string, error) {
+	switch format {
+	case FormatHex:
+		return key.String(), nil
+	case FormatPEM:
+		der, err := x509.MarshalPKCS8PrivateKey(ed25519.PrivateKey(key[:]))
+		if err != nil {
+			return "", err
+		}
+
+		return string(pem.EncodeToMemory(&pem.Block{Type: pemPrivateKeyType, Bytes: der})), nil
+	case FormatOpenSSH:
+		block, err := ssh.MarshalPrivateKey(ed25519.PrivateKey(key[:]), openSSHKeyComment)
+		if err != nil {
+			return "", err
+		}
+
+		return string(pem.EncodeToMemory(block)), nil
+	}
+
+	return "", ErrUnknownFormat
+}
+
+func parsePEMPublicKey(key string) (pub PublicKey, err error) {
+	block, _ := pem.Decode([]byte(key))
+	if block == nil || block.Type != pemPublicKeyType {
+		return pub, ErrInvalidKey
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return
+	}
+
+	return publicKeyFromEd25519(parsed)
+}
+
+func parseOpenSSHPublicKey(key string) (pub PublicKey, err error) {
+	sshKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+	if err != nil {
+		return
+	}
+
+	cryptoKey, ok := sshKey.(ssh.CryptoPublicKey)
+	if !ok {
+		return pub, ErrInvalidKey
+	}
+
+	return publicKeyFromEd25519(cryptoKey.CryptoPublicKey())
+}
+
+func parsePEMPrivateKey(key string) (priv PrivateKey, err error) {
+	block, _ := pem.Decode([]byte(key))
+	if block == nil || block.Type != pemPrivateKeyType {
+		return priv, ErrInvalidKey
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return
+	}
+
+	return privateKeyFromEd25519(parsed)
+}
+
+func parseOpenSSHPrivateKey(key string) (priv PrivateKey, err error) {
+	parsed, err := ssh.ParseRawPrivateKey([]byte(key))
+	if err != nil {
+		return
+	}
+
+	return privateKeyFromEd25519(parsed)
+}
+
+func publicKeyFromEd25519(key any) (pub PublicKey, err error) {
+	ed25519Key, ok := key.(ed25519.PublicKey)
+	if !ok || len(ed25519Key) != PublicKeySize {
+		return pub, ErrInvalidKey
+	}
+
+	copy(pub[:], ed25519Key)
+	return
+}
+
+func privateKeyFromEd25519(key any) (priv PrivateKey, err error) {
+	if ptr, ok := key.(*ed25519.PrivateKey); ok {
+		key = *ptr
+	}
+
+	ed25519Key, ok := key.(ed25519.PrivateKey)
+	if !ok || len(ed25519Key) != PrivateKeySize {
+		return priv, ErrInvalidKey
+	}
+
+	copy(priv[:], ed25519Key)
+	return
+}
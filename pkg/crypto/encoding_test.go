@@ -0,0 +1,76 @@
+package crypto_test
+
+import (
+	"testing"
+
+	"selfupdate.blockthrough.com/pkg/crypto"
+)
+
+func TestEncodeParseFormats(t *testing.T) {
+	publicKey, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{crypto.FormatHex, crypto.FormatPEM, crypto.FormatOpenSSH} {
+		encodedPublicKey, err := crypto.EncodePublicKey(publicKey, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		encodedPrivateKey, err := crypto.EncodePrivateKey(privateKey, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := crypto.DetectFormat(encodedPublicKey); got != format {
+			t.Errorf("%s: public key detected as %s", format, got)
+		}
+
+		if got := crypto.DetectFormat(encodedPrivateKey); got != format {
+			t.Errorf("%s: private key detected as %s", format, got)
+		}
+
+		parsedPublicKey, err := crypto.ParsePublicKey(encodedPublicKey)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		if parsedPublicKey != publicKey {
+			t.Errorf("%s: public key is not matched", format)
+		}
+
+		parsedPrivateKey, err := crypto.ParsePrivateKey(encodedPrivateKey)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		if parsedPrivateKey != privateKey {
+			t.Errorf("%s: private key is not matched", format)
+		}
+	}
+}
+
+func TestParseKeyringPEM(t *testing.T) {
+	publicKey1, _, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey2, _, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pem1, _ := crypto.EncodePublicKey(publicKey1, crypto.FormatPEM)
+	pem2, _ := crypto.EncodePublicKey(publicKey2, crypto.FormatPEM)
+
+	keyring, err := crypto.ParseKeyring(pem1 + pem2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if keyring.Len() != 2 {
+		t.Fatalf("expected 2 keys, got %d", keyring.Len())
+	}
+}
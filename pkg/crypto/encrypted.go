@@ -0,0 +1,231 @@
+package crypto
+
+import (
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	KDFScrypt   = "scrypt"
+	KDFArgon2id = "argon2id"
+
+	// FormatEncrypted is a PEM block which holds a private key encrypted with
+	// XChaCha20-Poly1305, using a key derived from a passphrase
+	FormatEncrypted = "encrypted"
+
+	pemEncryptedPrivateKeyType = "SELFUPDATE ENCRYPTED PRIVATE KEY"
+
+	encryptionCipher  = "xchacha20-poly1305"
+	encryptionKeyLen  = chacha20poly1305.KeySize
+	encryptionSaltLen = 16
+)
+
+var (
+	ErrWrongPassphrase    = errors.New("wrong passphrase")
+	ErrPassphraseRequired = errors.New("private key is encrypted, passphrase is required")
+)
+
+// default costs of the key derivation functions, scrypt uses the recommended
+// interactive parameters and argon2id the recommended parameters of RFC 9106
+var (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+
+	argon2Time    uint32 = 3
+	argon2Memory  uint32 = 64 * 1024
+	argon2Threads uint8  = 4
+)
+
+// EncryptPrivateKey encrypts the private key with a key derived from the passphrase
+// using either scrypt or argon2id, and returns it as a PEM block. The parameters
+// of the key derivation are stored in the headers of the block.
+func EncryptPrivateKey(key PrivateKey, passphrase string, kdf string) (string, error) {
+	salt := make([]byte, encryptionSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	headers := map[string]string{
+		"KDF":    kdf,
+		"Salt":   hex.EncodeToString(salt),
+		"Cipher": encryptionCipher,
+		"Nonce":  hex.EncodeToString(nonce),
+	}
+
+	switch kdf {
+	case KDFScrypt:
+		headers["N"] = strconv.Itoa(scryptN)
+		headers["R"] = strconv.Itoa(scryptR)
+		headers["P"] = strconv.Itoa(scryptP)
+	case KDFArgon2id:
+		headers["Time"] = strconv.FormatUint(uint64(argon2Time), 10)
+		headers["Memory"] = strconv.FormatUint(uint64(argon2Memory), 10)
+		headers["Threads"] = strconv.FormatUint(uint64(argon2Threads), 10)
+	default:
+		return "", ErrUnknownFormat
+	}
+
+	aead, err := encryptionAEAD(passphrase, headers)
+	if err != nil {
+		return "", err
+	}
+
+	block := &pem.Block{
+		Type:    pemEncryptedPrivateKeyType,
+		Headers: headers,
+		Bytes:   aead.Seal(nil, nonce, key[:], []byte(pemEncryptedPrivateKeyType)),
+	}
+
+	return string(pem.EncodeToMemory(block)), nil
+}
+
+// EncodePrivateKeyWithPassphrase is like EncodePrivateKey, but the key is
+// encrypted. OpenSSH keys use the encryption of OpenSSH itself, so they can be
+// used by ssh-keygen. Every other format is stored by EncryptPrivateKey.
+func EncodePrivateKeyWithPassphrase(key PrivateKey, format string, passphrase string, kdf string) (string, error) {
+	if format != FormatOpenSSH {
+		return EncryptPrivateKey(key, passphrase, kdf)
+	}
+
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(ed25519.PrivateKey(key[:]), openSSHKeyComment, []byte(passphrase))
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(block)), nil
+}
+
+// ParsePrivateKeyWithPassphrase is like ParsePrivateKey, but it also accepts
+// keys encrypted by EncryptPrivateKey, encrypted OpenSSH keys and encrypted
+// minisign secret keys.
+func ParsePrivateKeyWithPassphrase(key string, passphrase string) (priv PrivateKey, err error) {
+	switch DetectFormat(key) {
+	case FormatEncrypted:
+		return decryptPrivateKey(key, passphrase)
+	case FormatOpenSSH:
+		priv, err = parseOpenSSHPrivateKey(key)
+
+		var missingErr *ssh.PassphraseMissingError
+		if !errors.As(err, &missingErr) {
+			return
+		}
+
+		if passphrase == "" {
+			return priv, ErrPassphraseRequired
+		}
+
+		parsed, err := ssh.ParseRawPrivateKeyWithPassphrase([]byte(key), []byte(passphrase))
+		if errors.Is(err, x509.IncorrectPasswordError) {
+			return priv, ErrWrongPassphrase
+		} else if err != nil {
+			return priv, err
+		}
+
+		return privateKeyFromEd25519(parsed)
+	case FormatMinisign:
+		minisignKey, err := ParseMinisignPrivateKey(key, passphrase)
+		if errors.Is(err, ErrMinisignPassphraseNeeded) {
+			return priv, ErrPassphraseRequired
+		} else if errors.Is(err, ErrMinisignWrongPassphrase) {
+			return priv, ErrWrongPassphrase
+		}
+
+		return minisignKey.Key, err
+	}
+
+	return ParsePrivateKey(key)
+}
+
+// IsEncrypted reports whether the private key needs a passphrase to be parsed
+func IsEncrypted(key string) bool {
+	_, err := ParsePrivateKeyWithPassphrase(key, "")
+	return errors.Is(err, ErrPassphraseRequired)
+}
+
+func decryptPrivateKey(key string, passphrase string) (priv PrivateKey, err error) {
+	if passphrase == "" {
+		return priv, ErrPassphraseRequired
+	}
+
+	block, _ := pem.Decode([]byte(strings.TrimSpace(key)))
+	if block == nil || block.Type != pemEncryptedPrivateKeyType || block.Headers["Cipher"] != encryptionCipher {
+		return priv, ErrInvalidKey
+	}
+
+	nonce, err := hex.DecodeString(block.Headers["Nonce"])
+	if err != nil || len(nonce) != chacha20poly1305.NonceSizeX {
+		return priv, ErrInvalidKey
+	}
+
+	aead, err := encryptionAEAD(passphrase, block.Headers)
+	if err != nil {
+		return
+	}
+
+	plain, err := aead.Open(nil, nonce, block.Bytes, []byte(pemEncryptedPrivateKeyType))
+	if err != nil {
+		return priv, ErrWrongPassphrase
+	}
+
+	if len(plain) != PrivateKeySize {
+		return priv, ErrInvalidKey
+	}
+
+	copy(priv[:], plain)
+	return
+}
+
+func encryptionAEAD(passphrase string, headers map[string]string) (cipher.AEAD, error) {
+	salt, err := hex.DecodeString(headers["Salt"])
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+
+	var key []byte
+
+	switch headers["KDF"] {
+	case KDFScrypt:
+		n, errN := strconv.Atoi(headers["N"])
+		r, errR := strconv.Atoi(headers["R"])
+		p, errP := strconv.Atoi(headers["P"])
+		if errN != nil || errR != nil || errP != nil {
+			return nil, ErrInvalidKey
+		}
+
+		key, err = scrypt.Key([]byte(passphrase), salt, n, r, p, encryptionKeyLen)
+		if err != nil {
+			return nil, err
+		}
+	case KDFArgon2id:
+		time, errTime := strconv.ParseUint(headers["Time"], 10, 32)
+		memory, errMemory := strconv.ParseUint(headers["Memory"], 10, 32)
+		threads, errThreads := strconv.ParseUint(headers["Threads"], 10, 8)
+		if errTime != nil || errMemory != nil || errThreads != nil || time == 0 || threads == 0 {
+			return nil, ErrInvalidKey
+		}
+
+		key = argon2.IDKey([]byte(passphrase), salt, uint32(time), uint32(memory), uint8(threads), encryptionKeyLen)
+	default:
+		return nil, ErrUnknownFormat
+	}
+
+	return chacha20poly1305.NewX(key)
+}
@@ -0,0 +1,99 @@
+package crypto_test
+
+import (
+	"errors"
+	"testing"
+
+	"selfupdate.blockthrough.com/pkg/crypto"
+)
+
+func TestEncryptPrivateKey(t *testing.T) {
+	_, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, kdf := range []string{crypto.KDFScrypt, crypto.KDFArgon2id} {
+		encrypted, err := crypto.EncryptPrivateKey(privateKey, "correct horse", kdf)
+		if err != nil {
+			t.Fatalf("%s: %v", kdf, err)
+		}
+
+		if got := crypto.DetectFormat(encrypted); got != crypto.FormatEncrypted {
+			t.Errorf("%s: encrypted key detected as %s", kdf, got)
+		}
+
+		if !crypto.IsEncrypted(encrypted) {
+			t.Errorf("%s: expected the key to be encrypted", kdf)
+		}
+
+		_, err = crypto.ParsePrivateKey(encrypted)
+		if !errors.Is(err, crypto.ErrPassphraseRequired) {
+			t.Errorf("%s: expected ErrPassphraseRequired but got %v", kdf, err)
+		}
+
+		_, err = crypto.ParsePrivateKeyWithPassphrase(encrypted, "wrong horse")
+		if !errors.Is(err, crypto.ErrWrongPassphrase) {
+			t.Errorf("%s: expected ErrWrongPassphrase but got %v", kdf, err)
+		}
+
+		parsedPrivateKey, err := crypto.ParsePrivateKeyWithPassphrase(encrypted, "correct horse")
+		if err != nil {
+			t.Fatalf("%s: %v", kdf, err)
+		}
+
+		if parsedPrivateKey != privateKey {
+			t.Errorf("%s: private key is not matched", kdf)
+		}
+	}
+}
+
+func TestEncodePrivateKeyWithPassphraseOpenSSH(t *testing.T) {
+	_, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := crypto.EncodePrivateKeyWithPassphrase(privateKey, crypto.FormatOpenSSH, "correct horse", crypto.KDFArgon2id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !crypto.IsEncrypted(encrypted) {
+		t.Fatal("expected the key to be encrypted")
+	}
+
+	_, err = crypto.ParsePrivateKeyWithPassphrase(encrypted, "wrong horse")
+	if !errors.Is(err, crypto.ErrWrongPassphrase) {
+		t.Errorf("expected ErrWrongPassphrase but got %v", err)
+	}
+
+	parsedPrivateKey, err := crypto.ParsePrivateKeyWithPassphrase(encrypted, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsedPrivateKey != privateKey {
+		t.Error("private key is not matched")
+	}
+}
+
+func TestUnencryptedPrivateKey(t *testing.T) {
+	_, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if crypto.IsEncrypted(privateKey.String()) {
+		t.Error("expected the key not to be encrypted")
+	}
+
+	parsedPrivateKey, err := crypto.ParsePrivateKeyWithPassphrase(privateKey.String(), "ignored")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsedPrivateKey != privateKey {
+		t.Error("private key is not matched")
+	}
+}
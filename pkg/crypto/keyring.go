@@ -0,0 +1,149 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"strings"
+	"unicode"
+)
+
+const (
+	KeyIDSize = 8
+)
+
+// KeyID is a short fingerprint of a public key, it's the first 8 bytes of the
+// SHA-256 of the key
+type KeyID [KeyIDSize]byte
+
+func (id KeyID) String() string {
+	return binary2String(id[:])
+}
+
+func ParseKeyID(str string) (id KeyID, err error) {
+	bytes, err := hex.DecodeString(str)
+	if err != nil {
+		return
+	}
+
+	if len(bytes) != KeyIDSize {
+		return id, ErrInvalidKey
+	}
+
+	copy(id[:], bytes)
+	return
+}
+
+func (p PublicKey) ID() (id KeyID) {
+	sum := sha256.Sum256(p[:])
+	copy(id[:], sum[:KeyIDSize])
+	return
+}
+
+// Public returns the public key of the private key. NaCl private keys contain
+// the public key in their last 32 bytes.
+func (p PrivateKey) Public() (pub PublicKey) {
+	copy(pub[:], p[PrivateKeySize-PublicKeySize:])
+	return
+}
+
+// Keyring is a set of trusted public keys, looked up by their key IDs
+type Keyring struct {
+	ids  []KeyID
+	keys map[KeyID]PublicKey
+}
+
+func NewKeyring(keys ...PublicKey) *Keyring {
+	k := &Keyring{
+		keys: make(map[KeyID]PublicKey),
+	}
+
+	for _, key := range keys {
+		k.Add(key)
+	}
+
+	return k
+}
+
+func (k *Keyring) Add(key PublicKey) {
+	id := key.ID()
+	if _, ok := k.keys[id]; ok {
+		return
+	}
+
+	k.ids = append(k.ids, id)
+	k.keys[id] = key
+}
+
+func (k *Keyring) Get(id KeyID) (PublicKey, bool) {
+	key, ok := k.keys[id]
+	return key, ok
+}
+
+// Keys returns all the keys in the order they were added
+func (k *Keyring) Keys() []PublicKey {
+	keys := make([]PublicKey, 0, len(k.ids))
+	for _, id := range k.ids {
+		keys = append(keys, k.keys[id])
+	}
+
+	return keys
+}
+
+func (k *Keyring) Len() int {
+	return len(k.ids)
+}
+
+// ParseKeyring parses a list of public keys, in any format ParsePublicKey
+// supports, separated by commas or any whitespace. PEM keys are simply
+// concatenated.
+func ParseKeyring(str string) (*Keyring, error) {
+	var fields []string
+
+	if DetectFormat(str) == FormatPEM {
+		rest := []byte(strings.TrimSpace(str))
+		for len(rest) > 0 {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				return nil, ErrInvalidKey
+			}
+
+			fields = append(fields, string(pem.EncodeToMemory(block)))
+			rest = []byte(strings.TrimSpace(string(rest)))
+		}
+	} else {
+		// comment lines, e.g. of minisign public key files, contain spaces
+		var lines []string
+		for _, line := range strings.Split(str, "\n") {
+			if !strings.HasPrefix(strings.TrimSpace(line), "untrusted comment:") {
+				lines = append(lines, line)
+			}
+		}
+
+		fields = strings.FieldsFunc(strings.Join(lines, "\n"), func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		})
+	}
+
+	keyring := NewKeyring()
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" || strings.HasPrefix(field, "untrusted comment:") {
+			continue
+		}
+
+		key, err := ParsePublicKey(field)
+		if err != nil {
+			return nil, err
+		}
+
+		keyring.Add(key)
+	}
+
+	if keyring.Len() == 0 {
+		return nil, ErrInvalidKey
+	}
+
+	return keyring, nil
+}
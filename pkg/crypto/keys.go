@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"strings"
 
 	"golang.org/x/crypto/nacl/sign"
 )
@@ -48,8 +49,22 @@ func GenerateKeys() (publicKey PublicKey, privateKey PrivateKey, err error) {
 	return *publicKeyPtr, *privateKeyPtr, nil
 }
 
+// ParsePrivateKey detects the format of the key and parses it. Hex NaCl keys,
+// PEM PKCS#8, OpenSSH and unencrypted minisign ed25519 keys are supported.
 func ParsePrivateKey(key string) (priv PrivateKey, err error) {
-	bytes, err := string2Binary(key)
+	switch DetectFormat(key) {
+	case FormatEncrypted:
+		return priv, ErrPassphraseRequired
+	case FormatPEM:
+		return parsePEMPrivateKey(key)
+	case FormatOpenSSH:
+		return parseOpenSSHPrivateKey(key)
+	case FormatMinisign:
+		minisignKey, err := ParseMinisignPrivateKey(key, "")
+		return minisignKey.Key, err
+	}
+
+	bytes, err := string2Binary(strings.TrimSpace(key))
 	if err != nil {
 		return
 	}
@@ -62,8 +77,20 @@ func ParsePrivateKey(key string) (priv PrivateKey, err error) {
 	return
 }
 
+// ParsePublicKey detects the format of the key and parses it. Hex NaCl keys,
+// PEM PKIX, OpenSSH authorized keys and minisign ed25519 keys are supported.
 func ParsePublicKey(key string) (pub PublicKey, err error) {
-	bytes, err := string2Binary(key)
+	switch DetectFormat(key) {
+	case FormatPEM:
+		return parsePEMPublicKey(key)
+	case FormatOpenSSH:
+		return parseOpenSSHPublicKey(key)
+	case FormatMinisign:
+		minisignKey, err := ParseMinisignPublicKey(key)
+		return minisignKey.Key, err
+	}
+
+	bytes, err := string2Binary(strings.TrimSpace(key))
 	if err != nil {
 		return
 	}
@@ -59,3 +59,65 @@ func TestEncodeDecodePrivateKey(t *testing.T) {
 		t.Fatal("public key is not matched")
 	}
 }
+
+func TestKeyring(t *testing.T) {
+	publicKey, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if privateKey.Public() != publicKey {
+		t.Fatal("public key of private key is not matched")
+	}
+
+	id, err := crypto.ParseKeyID(publicKey.ID().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring, err := crypto.ParseKeyring(publicKey.String() + ", " + publicKey.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if keyring.Len() != 1 {
+		t.Fatal("duplicated keys should be added once")
+	}
+
+	key, ok := keyring.Get(id)
+	if !ok || key != publicKey {
+		t.Fatal("key is not found by its id")
+	}
+}
+
+func TestParseKeyringSeparators(t *testing.T) {
+	publicKey1, _, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey2, _, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key1, key2 := publicKey1.String(), publicKey2.String()
+
+	for _, text := range []string{
+		key1 + "," + key2,
+		key1 + "\n" + key2 + "\n",
+		key1 + " " + key2,
+		key1 + "\t" + key2,
+		" " + key1 + ",\r\n\t" + key2 + " ",
+		"untrusted comment: release keys\n" + key1 + "\n" + key2,
+	} {
+		keyring, err := crypto.ParseKeyring(text)
+		if err != nil {
+			t.Fatalf("%q: %v", text, err)
+		}
+
+		if keyring.Len() != 2 {
+			t.Fatalf("%q: expected 2 keys, got %d", text, keyring.Len())
+		}
+	}
+}
@@ -0,0 +1,437 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/scrypt"
+)
+
+// minisign and signify compatible keys and signatures, for more info about
+// the formats, please refer to https://jedisct1.github.io/minisign/
+
+var (
+	ErrMinisignInvalidFormat    = errors.New("invalid minisign format")
+	ErrMinisignWrongPassphrase  = errors.New("wrong minisign passphrase")
+	ErrMinisignPassphraseNeeded = errors.New("minisign secret key is encrypted, passphrase is required")
+)
+
+const (
+	MinisignKeyIDSize = 8
+
+	minisignSignatureSize = ed25519.SignatureSize
+	minisignKeynumSKSize  = MinisignKeyIDSize + PrivateKeySize + blake2b.Size256
+
+	// the same limits minisign uses, which are libsodium's "sensitive" limits
+	minisignDefaultOpsLimit = 33554432
+	minisignDefaultMemLimit = 1073741824
+)
+
+var (
+	minisignAlgorithm       = [2]byte{'E', 'd'}
+	minisignAlgorithmHashed = [2]byte{'E', 'D'}
+	minisignKDFScrypt       = [2]byte{'S', 'c'}
+	minisignKDFNone         = [2]byte{0, 0}
+	minisignChecksumBlake2b = [2]byte{'B', '2'}
+)
+
+// MinisignKeyID is stored little endian, minisign prints it as an uppercase
+// hex of the 64 bits number
+type MinisignKeyID [MinisignKeyIDSize]byte
+
+func (id MinisignKeyID) String() string {
+	return fmt.Sprintf("%016X", binary.LittleEndian.Uint64(id[:]))
+}
+
+type MinisignPublicKey struct {
+	KeyID MinisignKeyID
+	Key   PublicKey
+}
+
+type MinisignPrivateKey struct {
+	KeyID MinisignKeyID
+	Key   PrivateKey
+}
+
+type MinisignSignature struct {
+	Prehashed        bool
+	KeyID            MinisignKeyID
+	Signature        [minisignSignatureSize]byte
+	UntrustedComment string
+	TrustedComment   string
+	GlobalSignature  [minisignSignatureSize]byte
+}
+
+// NewMinisignKeys wraps a private key with a random key id
+func NewMinisignKeys(privateKey PrivateKey) (pub MinisignPublicKey, priv MinisignPrivateKey, err error) {
+	if _, err = rand.Read(priv.KeyID[:]); err != nil {
+		return
+	}
+
+	priv.Key = privateKey
+	pub.KeyID = priv.KeyID
+	pub.Key = privateKey.Public()
+
+	return
+}
+
+func (p MinisignPrivateKey) Public() MinisignPublicKey {
+	return MinisignPublicKey{
+		KeyID: p.KeyID,
+		Key:   p.Key.Public(),
+	}
+}
+
+// String returns the content of a minisign public key file
+func (p MinisignPublicKey) String() string {
+	return fmt.Sprintf("untrusted comment: minisign public key %s\n%s\n", p.KeyID, p.Base64())
+}
+
+// Base64 returns only the key line of the public key file, which is what
+// `minisign -P` accepts
+func (p MinisignPublicKey) Base64() string {
+	var buffer bytes.Buffer
+	buffer.Write(minisignAlgorithm[:])
+	buffer.Write(p.KeyID[:])
+	buffer.Write(p.Key[:])
+
+	return base64.StdEncoding.EncodeToString(buffer.Bytes())
+}
+
+// ParseMinisignPublicKey accepts either the content of a public key file or
+// only its base64 line
+func ParseMinisignPublicKey(text string) (pub MinisignPublicKey, err error) {
+	data, err := minisignDecodeLine(minisignKeyLine(text))
+	if err != nil {
+		return
+	}
+
+	if len(data) != 2+MinisignKeyIDSize+PublicKeySize || !bytes.Equal(data[:2], minisignAlgorithm[:]) {
+		return pub, ErrMinisignInvalidFormat
+	}
+
+	copy(pub.KeyID[:], data[2:])
+	copy(pub.Key[:], data[2+MinisignKeyIDSize:])
+	return
+}
+
+type minisignEncodeOptions struct {
+	opsLimit uint64
+	memLimit uint64
+}
+
+type minisignEncodeOptFn func(opts *minisignEncodeOptions)
+
+// WithMinisignScryptLimits changes the cost of the key derivation used to encrypt
+// secret keys. The defaults are the same as minisign's.
+func WithMinisignScryptLimits(opsLimit uint64, memLimit uint64) minisignEncodeOptFn {
+	return func(opts *minisignEncodeOptions) {
+		opts.opsLimit = opsLimit
+		opts.memLimit = memLimit
+	}
+}
+
+// Encode returns the content of a minisign secret key file. If passphrase is
+// empty, the key is stored unencrypted, like `minisign -W` does.
+func (p MinisignPrivateKey) Encode(passphrase string, optFns ...minisignEncodeOptFn) (string, error) {
+	opts := &minisignEncodeOptions{
+		opsLimit: minisignDefaultOpsLimit,
+		memLimit: minisignDefaultMemLimit,
+	}
+
+	for _, optFn := range optFns {
+		optFn(opts)
+	}
+
+	keynumSK := make([]byte, 0, minisignKeynumSKSize)
+	keynumSK = append(keynumSK, p.KeyID[:]...)
+	keynumSK = append(keynumSK, p.Key[:]...)
+	checksum := minisignSecretKeyChecksum(p.KeyID, p.Key)
+	keynumSK = append(keynumSK, checksum[:]...)
+
+	var salt [32]byte
+	var opsLimit, memLimit uint64
+
+	kdf := minisignKDFNone
+	comment := "minisign secret key"
+
+	if passphrase != "" {
+		if _, err := rand.Read(salt[:]); err != nil {
+			return "", err
+		}
+
+		kdf = minisignKDFScrypt
+		comment = "minisign encrypted secret key"
+		opsLimit = opts.opsLimit
+		memLimit = opts.memLimit
+
+		stream, err := minisignScrypt(passphrase, salt[:], opsLimit, memLimit)
+		if err != nil {
+			return "", err
+		}
+
+		subtle.XORBytes(keynumSK, keynumSK, stream)
+	}
+
+	var buffer bytes.Buffer
+	buffer.Write(minisignAlgorithm[:])
+	buffer.Write(kdf[:])
+	buffer.Write(minisignChecksumBlake2b[:])
+	buffer.Write(salt[:])
+	binary.Write(&buffer, binary.LittleEndian, opsLimit)
+	binary.Write(&buffer, binary.LittleEndian, memLimit)
+	buffer.Write(keynumSK)
+
+	return fmt.Sprintf("untrusted comment: %s\n%s\n", comment, base64.StdEncoding.EncodeToString(buffer.Bytes())), nil
+}
+
+// ParseMinisignPrivateKey parses the content of a minisign secret key file,
+// the passphrase is only used if the key is encrypted
+func ParseMinisignPrivateKey(text string, passphrase string) (priv MinisignPrivateKey, err error) {
+	data, err := minisignDecodeLine(minisignKeyLine(text))
+	if err != nil {
+		return
+	}
+
+	const headerSize = 2 + 2 + 2 + 32 + 8 + 8
+	if len(data) != headerSize+minisignKeynumSKSize ||
+		!bytes.Equal(data[:2], minisignAlgorithm[:]) ||
+		!bytes.Equal(data[4:6], minisignChecksumBlake2b[:]) {
+		return priv, ErrMinisignInvalidFormat
+	}
+
+	keynumSK := data[headerSize:]
+
+	switch {
+	case bytes.Equal(data[2:4], minisignKDFScrypt[:]):
+		if passphrase == "" {
+			return priv, ErrMinisignPassphraseNeeded
+		}
+
+		salt := data[6:38]
+		opsLimit := binary.LittleEndian.Uint64(data[38:46])
+		memLimit := binary.LittleEndian.Uint64(data[46:54])
+
+		stream, err := minisignScrypt(passphrase, salt, opsLimit, memLimit)
+		if err != nil {
+			return priv, err
+		}
+
+		subtle.XORBytes(keynumSK, keynumSK, stream)
+	case bytes.Equal(data[2:4], minisignKDFNone[:]):
+	default:
+		return priv, ErrMinisignInvalidFormat
+	}
+
+	copy(priv.KeyID[:], keynumSK)
+	copy(priv.Key[:], keynumSK[MinisignKeyIDSize:])
+
+	checksum := minisignSecretKeyChecksum(priv.KeyID, priv.Key)
+	if subtle.ConstantTimeCompare(checksum[:], keynumSK[MinisignKeyIDSize+PrivateKeySize:]) != 1 {
+		return MinisignPrivateKey{}, ErrMinisignWrongPassphrase
+	}
+
+	return priv, nil
+}
+
+// Sign creates a minisign signature of message. The prehashed mode signs the
+// BLAKE2b-512 of the message, which is the default of minisign since 0.8. If
+// trustedComment is empty, a timestamp is used, the same as minisign.
+func (p MinisignPrivateKey) Sign(message []byte, trustedComment string, prehashed bool) *MinisignSignature {
+	if trustedComment == "" {
+		trustedComment = fmt.Sprintf("timestamp:%d", time.Now().Unix())
+	}
+
+	sig := &MinisignSignature{
+		Prehashed:        prehashed,
+		KeyID:            p.KeyID,
+		UntrustedComment: "signature from selfupdate secret key",
+		TrustedComment:   trustedComment,
+	}
+
+	if prehashed {
+		sum := blake2b.Sum512(message)
+		message = sum[:]
+	}
+
+	copy(sig.Signature[:], ed25519.Sign(ed25519.PrivateKey(p.Key[:]), message))
+	copy(sig.GlobalSignature[:], ed25519.Sign(ed25519.PrivateKey(p.Key[:]), sig.globalMessage()))
+
+	return sig
+}
+
+// Verify checks both the signature of the message and the global signature
+// which covers the trusted comment
+func (p MinisignPublicKey) Verify(message []byte, sig *MinisignSignature) bool {
+	if p.KeyID != sig.KeyID {
+		return false
+	}
+
+	if sig.Prehashed {
+		sum := blake2b.Sum512(message)
+		message = sum[:]
+	}
+
+	if !ed25519.Verify(ed25519.PublicKey(p.Key[:]), message, sig.Signature[:]) {
+		return false
+	}
+
+	return ed25519.Verify(ed25519.PublicKey(p.Key[:]), sig.globalMessage(), sig.GlobalSignature[:])
+}
+
+// String returns the content of a .minisig file
+func (s *MinisignSignature) String() string {
+	algorithm := minisignAlgorithm
+	if s.Prehashed {
+		algorithm = minisignAlgorithmHashed
+	}
+
+	var buffer bytes.Buffer
+	buffer.Write(algorithm[:])
+	buffer.Write(s.KeyID[:])
+	buffer.Write(s.Signature[:])
+
+	return fmt.Sprintf(
+		"untrusted comment: %s\n%s\ntrusted comment: %s\n%s\n",
+		s.UntrustedComment,
+		base64.StdEncoding.EncodeToString(buffer.Bytes()),
+		s.TrustedComment,
+		base64.StdEncoding.EncodeToString(s.GlobalSignature[:]),
+	)
+}
+
+// ParseMinisignSignature parses the content of a .minisig file
+func ParseMinisignSignature(text string) (*MinisignSignature, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if len(lines) < 4 {
+		return nil, ErrMinisignInvalidFormat
+	}
+
+	untrustedComment, ok := strings.CutPrefix(lines[0], "untrusted comment: ")
+	if !ok {
+		return nil, ErrMinisignInvalidFormat
+	}
+
+	trustedComment, ok := strings.CutPrefix(lines[2], "trusted comment: ")
+	if !ok {
+		return nil, ErrMinisignInvalidFormat
+	}
+
+	data, err := minisignDecodeLine(lines[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) != 2+MinisignKeyIDSize+minisignSignatureSize {
+		return nil, ErrMinisignInvalidFormat
+	}
+
+	sig := &MinisignSignature{
+		UntrustedComment: untrustedComment,
+		TrustedComment:   trustedComment,
+	}
+
+	switch {
+	case bytes.Equal(data[:2], minisignAlgorithm[:]):
+	case bytes.Equal(data[:2], minisignAlgorithmHashed[:]):
+		sig.Prehashed = true
+	default:
+		return nil, ErrMinisignInvalidFormat
+	}
+
+	copy(sig.KeyID[:], data[2:])
+	copy(sig.Signature[:], data[2+MinisignKeyIDSize:])
+
+	globalSignature, err := minisignDecodeLine(lines[3])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(globalSignature) != minisignSignatureSize {
+		return nil, ErrMinisignInvalidFormat
+	}
+
+	copy(sig.GlobalSignature[:], globalSignature)
+
+	return sig, nil
+}
+
+func (s *MinisignSignature) globalMessage() []byte {
+	return append(s.Signature[:], []byte(s.TrustedComment)...)
+}
+
+func minisignSecretKeyChecksum(keyID MinisignKeyID, key PrivateKey) [blake2b.Size256]byte {
+	data := make([]byte, 0, 2+MinisignKeyIDSize+PrivateKeySize)
+	data = append(data, minisignAlgorithm[:]...)
+	data = append(data, keyID[:]...)
+	data = append(data, key[:]...)
+
+	return blake2b.Sum256(data)
+}
+
+// minisignScrypt derives the key stream the same way libsodium's
+// crypto_pwhash_scryptsalsa208sha256 turns opslimit and memlimit into N, r and p
+func minisignScrypt(passphrase string, salt []byte, opsLimit uint64, memLimit uint64) ([]byte, error) {
+	if opsLimit < 32768 {
+		opsLimit = 32768
+	}
+
+	r := uint64(8)
+	p := uint64(1)
+	var nLog2 uint64
+
+	if opsLimit < memLimit/32 {
+		maxN := opsLimit / (r * 4)
+		for nLog2 = 1; nLog2 < 63; nLog2++ {
+			if uint64(1)<<nLog2 > maxN/2 {
+				break
+			}
+		}
+	} else {
+		maxN := memLimit / (r * 128)
+		for nLog2 = 1; nLog2 < 63; nLog2++ {
+			if uint64(1)<<nLog2 > maxN/2 {
+				break
+			}
+		}
+
+		maxRP := (opsLimit / 4) / (uint64(1) << nLog2)
+		if maxRP > 0x3fffffff {
+			maxRP = 0x3fffffff
+		}
+		p = maxRP / r
+	}
+
+	return scrypt.Key([]byte(passphrase), salt, 1<<nLog2, int(r), int(p), minisignKeynumSKSize)
+}
+
+// minisignKeyLine returns the base64 line of a key file, or the text itself
+// if it has no comment line
+func minisignKeyLine(text string) string {
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "untrusted comment:") {
+			return line
+		}
+	}
+
+	return ""
+}
+
+func minisignDecodeLine(line string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(line))
+	if err != nil {
+		return nil, ErrMinisignInvalidFormat
+	}
+
+	return data, nil
+}
@@ -0,0 +1,136 @@
+package crypto_test
+
+import (
+	"errors"
+	"testing"
+
+	"selfupdate.blockthrough.com/pkg/crypto"
+)
+
+func TestMinisignKeys(t *testing.T) {
+	_, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey, minisignPrivateKey, err := crypto.NewMinisignKeys(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsedPublicKey, err := crypto.ParseMinisignPublicKey(publicKey.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsedPublicKey != publicKey {
+		t.Fatal("public key is not matched")
+	}
+
+	for _, passphrase := range []string{"", "secret"} {
+		text, err := minisignPrivateKey.Encode(passphrase, crypto.WithMinisignScryptLimits(32768, 16*1024*1024))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parsedPrivateKey, err := crypto.ParseMinisignPrivateKey(text, passphrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if parsedPrivateKey != minisignPrivateKey {
+			t.Fatal("private key is not matched")
+		}
+
+		if passphrase != "" {
+			_, err = crypto.ParseMinisignPrivateKey(text, "wrong")
+			if !errors.Is(err, crypto.ErrMinisignWrongPassphrase) {
+				t.Fatalf("expected wrong passphrase error, got %v", err)
+			}
+		}
+	}
+}
+
+func TestMinisignSignVerify(t *testing.T) {
+	_, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey, minisignPrivateKey, err := crypto.NewMinisignKeys(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := []byte("hello, world")
+
+	for _, prehashed := range []bool{false, true} {
+		sig := minisignPrivateKey.Sign(message, "file:hello.txt", prehashed)
+
+		parsed, err := crypto.ParseMinisignSignature(sig.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if parsed.TrustedComment != "file:hello.txt" || parsed.Prehashed != prehashed {
+			t.Fatal("signature is not matched")
+		}
+
+		if !publicKey.Verify(message, parsed) {
+			t.Fatal("verify failed")
+		}
+
+		if publicKey.Verify([]byte("hello, world!"), parsed) {
+			t.Fatal("verify should fail for another message")
+		}
+
+		parsed.TrustedComment = "file:evil.txt"
+		if publicKey.Verify(message, parsed) {
+			t.Fatal("verify should fail for a modified trusted comment")
+		}
+	}
+}
+
+// TestMinisignKnownAnswer verifies a signature made by the minisign tool, it's
+// the one of the test suite of go-minisign
+func TestMinisignKnownAnswer(t *testing.T) {
+	publicKey, err := crypto.ParseMinisignPublicKey("RWQf6LRCGA9i53mlYecO4IzT51TGPpvWucNSCh1CBM0QTaLn73Y7GFO3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature := "untrusted comment: signature from minisign secret key\n" +
+		"RWQf6LRCGA9i59SLOFxz6NxvASXDJeRtuZykwQepbDEGt87ig1BNpWaVWuNrm73YiIiJbq71Wi+dP9eKL8OC351vwIasSSbXxwA=\n" +
+		"trusted comment: timestamp:1555779966\tfile:test\n" +
+		"QtKMXWyYcwdpZAlPF7tE2ENJkRd1ujvKjlj1m9RtHTBnZPa5WKU5uWRs5GoP5M/VqE81QFuMKI5k/SfNQUaOAA=="
+
+	tests := []struct {
+		name           string
+		message        string
+		trustedComment string
+		valid          bool
+	}{
+		{"signed message", "test", "", true},
+		{"other message", "test\n", "", false},
+		{"changed trusted comment", "test", "timestamp:1555779966\tfile:other", false},
+	}
+
+	for _, tt := range tests {
+		sig, err := crypto.ParseMinisignSignature(signature)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sig.KeyID != publicKey.KeyID {
+			t.Fatalf("expected key id %s, got %s", publicKey.KeyID, sig.KeyID)
+		}
+
+		if tt.trustedComment != "" {
+			sig.TrustedComment = tt.trustedComment
+		}
+
+		if valid := publicKey.Verify([]byte(tt.message), sig); valid != tt.valid {
+			t.Errorf("%s: expected valid %t, got %t", tt.name, tt.valid, valid)
+		}
+	}
+}
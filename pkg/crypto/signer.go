@@ -0,0 +1,109 @@
+package crypto
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// SignatureSize is the size of an ed25519 signature returned by a
+	// DigestSigner, it's the Overhead of a signed message
+	SignatureSize = Overhead
+)
+
+var (
+	ErrInvalidSignature       = errors.New("invalid signature")
+	ErrUnknownSignerProvider  = errors.New("unknown signer provider")
+	ErrSignerProviderExists   = errors.New("signer provider is already registered")
+	ErrSignerProviderEmptyURI = errors.New("signer uri has no scheme")
+)
+
+// DigestSigner signs a digest of the content without exposing the private key,
+// so the key can be kept in a KMS, an HSM or any other external process.
+type DigestSigner interface {
+	// Public returns the public key of the signing key, it's used for the key id
+	// and for checking the signatures returned by SignDigest
+	Public() PublicKey
+	// SignDigest returns the ed25519 signature of the digest, without the digest
+	SignDigest(ctx context.Context, digest []byte) ([]byte, error)
+}
+
+// SignDigest makes PrivateKey a DigestSigner
+func (p PrivateKey) SignDigest(ctx context.Context, digest []byte) ([]byte, error) {
+	return p.Sign(digest)[:SignatureSize], nil
+}
+
+// SignerProvider opens a DigestSigner described by a uri, e.g. a PKCS#11 token
+// as pkcs11:token=release;object=signing-key. Providers are registered by their
+// uri scheme with RegisterSignerProvider, usually in the init function of the
+// package which implements them.
+type SignerProvider func(ctx context.Context, uri string) (DigestSigner, error)
+
+var (
+	signerProvidersMu sync.RWMutex
+	signerProviders   = map[string]SignerProvider{}
+)
+
+// RegisterSignerProvider makes a provider available by the scheme of its uris.
+// Registering the same scheme twice returns ErrSignerProviderExists.
+func RegisterSignerProvider(scheme string, provider SignerProvider) error {
+	signerProvidersMu.Lock()
+	defer signerProvidersMu.Unlock()
+
+	if _, ok := signerProviders[scheme]; ok {
+		return ErrSignerProviderExists
+	}
+
+	signerProviders[scheme] = provider
+	return nil
+}
+
+// SignerProviders returns the sorted schemes of the registered providers
+func SignerProviders() []string {
+	signerProvidersMu.RLock()
+	defer signerProvidersMu.RUnlock()
+
+	schemes := make([]string, 0, len(signerProviders))
+	for scheme := range signerProviders {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+
+	return schemes
+}
+
+// HasSignerProvider reports whether the scheme of the uri is registered
+func HasSignerProvider(uri string) bool {
+	scheme, _, ok := strings.Cut(uri, ":")
+	if !ok {
+		return false
+	}
+
+	signerProvidersMu.RLock()
+	defer signerProvidersMu.RUnlock()
+
+	_, ok = signerProviders[scheme]
+	return ok
+}
+
+// OpenSigner opens the signer with the provider registered for the scheme of
+// the uri
+func OpenSigner(ctx context.Context, uri string) (DigestSigner, error) {
+	scheme, _, ok := strings.Cut(uri, ":")
+	if !ok || scheme == "" {
+		return nil, ErrSignerProviderEmptyURI
+	}
+
+	signerProvidersMu.RLock()
+	provider, ok := signerProviders[scheme]
+	signerProvidersMu.RUnlock()
+
+	if !ok {
+		return nil, ErrUnknownSignerProvider
+	}
+
+	return provider(ctx, uri)
+}
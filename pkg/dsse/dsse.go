@@ -0,0 +1,107 @@
+package dsse
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"selfupdate.blockthrough.com/pkg/crypto"
+)
+
+const (
+	// PayloadTypeInToto is the payload type of in-toto statements
+	PayloadTypeInToto = "application/vnd.in-toto+json"
+)
+
+var (
+	ErrInvalidEnvelope  = errors.New("invalid dsse envelope")
+	ErrEnvelopeUnsigned = errors.New("dsse envelope is not signed by any trusted key")
+)
+
+type Signature struct {
+	KeyID string `json:"keyid"`
+	Sig   []byte `json:"sig"`
+}
+
+// Envelope is a Dead Simple Signing Envelope. The signatures cover the payload
+// type and the payload, please refer to PAE.
+type Envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     []byte      `json:"payload"`
+	Signatures  []Signature `json:"signatures"`
+}
+
+// PAE is the pre-authentication encoding of the payload, which is what gets
+// signed
+//
+//	"DSSEv1" SP len(type) SP type SP len(payload) SP payload
+func PAE(payloadType string, payload []byte) []byte {
+	return append([]byte(fmt.Sprintf("DSSEv1 %d %s %d ", len(payloadType), payloadType, len(payload))), payload...)
+}
+
+// Sign returns an envelope of the payload signed by every signer. The keys of
+// this repo sign the SHA-256 of the encoded payload, like every other digest
+// they sign, and the key ids are the ones of crypto.KeyID.
+func Sign(ctx context.Context, payloadType string, payload []byte, signers ...crypto.DigestSigner) (*Envelope, error) {
+	digest := sha256.Sum256(PAE(payloadType, payload))
+
+	envelope := &Envelope{
+		PayloadType: payloadType,
+		Payload:     payload,
+	}
+
+	for _, signer := range signers {
+		sig, err := signer.SignDigest(ctx, digest[:])
+		if err != nil {
+			return nil, err
+		}
+
+		envelope.Signatures = append(envelope.Signatures, Signature{
+			KeyID: signer.Public().ID().String(),
+			Sig:   sig,
+		})
+	}
+
+	return envelope, nil
+}
+
+// Parse reads an envelope without verifying it
+func Parse(data []byte) (*Envelope, error) {
+	var envelope Envelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+
+	if envelope.PayloadType == "" || len(envelope.Signatures) == 0 {
+		return nil, ErrInvalidEnvelope
+	}
+
+	return &envelope, nil
+}
+
+// Verify checks that at least one of the signatures is made by a key of the
+// keyring, signatures of unknown keys are ignored
+func (e *Envelope) Verify(keyring *crypto.Keyring) error {
+	digest := sha256.Sum256(PAE(e.PayloadType, e.Payload))
+
+	for _, signature := range e.Signatures {
+		keyID, err := crypto.ParseKeyID(signature.KeyID)
+		if err != nil {
+			continue
+		}
+
+		key, ok := keyring.Get(keyID)
+		if !ok || len(signature.Sig) != crypto.SignatureSize {
+			continue
+		}
+
+		signedMessage := append(append([]byte{}, signature.Sig...), digest[:]...)
+		if key.Verify(signedMessage) {
+			return nil
+		}
+	}
+
+	return ErrEnvelopeUnsigned
+}
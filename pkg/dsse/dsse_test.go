@@ -0,0 +1,60 @@
+package dsse_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"selfupdate.blockthrough.com/pkg/crypto"
+	"selfupdate.blockthrough.com/pkg/dsse"
+)
+
+func TestEnvelope(t *testing.T) {
+	publicKey, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherPublicKey, _, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelope, err := dsse.Sign(context.Background(), dsse.PayloadTypeInToto, []byte(`{"_type":"https://in-toto.io/Statement/v1"}`), privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := dsse.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := parsed.Verify(crypto.NewKeyring(otherPublicKey, publicKey)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := parsed.Verify(crypto.NewKeyring(otherPublicKey)); !errors.Is(err, dsse.ErrEnvelopeUnsigned) {
+		t.Fatalf("expected unsigned envelope, got %v", err)
+	}
+
+	// the payload type is signed as well
+	parsed.PayloadType = "text/plain"
+	if err := parsed.Verify(crypto.NewKeyring(publicKey)); !errors.Is(err, dsse.ErrEnvelopeUnsigned) {
+		t.Fatalf("expected unsigned envelope, got %v", err)
+	}
+}
+
+func TestPAE(t *testing.T) {
+	// the example of the DSSE specification
+	expected := "DSSEv1 29 http://example.com/HelloWorld 11 hello world"
+	if pae := string(dsse.PAE("http://example.com/HelloWorld", []byte("hello world"))); pae != expected {
+		t.Fatalf("expected %q, got %q", expected, pae)
+	}
+}
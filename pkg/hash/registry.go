@@ -0,0 +1,138 @@
+package hash
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"hash"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+	"lukechampine.com/blake3"
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown hash algorithm")
+	ErrAlgorithmExists  = errors.New("hash algorithm is already registered")
+)
+
+// Algorithm identifies a digest algorithm. The value is stored in signature
+// headers, so the values of the registered algorithms must never change.
+type Algorithm byte
+
+const (
+	SHA256     Algorithm = 0x01
+	SHA512     Algorithm = 0x02
+	BLAKE2b256 Algorithm = 0x03
+	BLAKE3     Algorithm = 0x04
+)
+
+type algorithm struct {
+	name string
+	size int
+	new  func() hash.Hash
+}
+
+var (
+	algorithmsMu sync.RWMutex
+	algorithms   = map[Algorithm]algorithm{
+		SHA256:     {name: "sha256", size: sha256.Size, new: sha256.New},
+		SHA512:     {name: "sha512", size: sha512.Size, new: sha512.New},
+		BLAKE2b256: {name: "blake2b-256", size: blake2b.Size256, new: newBlake2b256},
+		BLAKE3:     {name: "blake3", size: 32, new: newBlake3},
+	}
+)
+
+// Register adds an algorithm to the registry, so it can be named in signature
+// headers. Verifiers still reject it unless it's in their allowlist.
+func Register(id Algorithm, name string, size int, new func() hash.Hash) error {
+	algorithmsMu.Lock()
+	defer algorithmsMu.Unlock()
+
+	for existingID, existing := range algorithms {
+		if existingID == id || existing.name == name {
+			return ErrAlgorithmExists
+		}
+	}
+
+	algorithms[id] = algorithm{name: name, size: size, new: new}
+	return nil
+}
+
+// Lookup returns the algorithm registered with the given name, e.g. sha512
+func Lookup(name string) (Algorithm, error) {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+
+	for id, algorithm := range algorithms {
+		if algorithm.name == name {
+			return id, nil
+		}
+	}
+
+	return 0, ErrUnknownAlgorithm
+}
+
+// Available reports whether the algorithm is registered
+func (a Algorithm) Available() bool {
+	_, ok := a.lookup()
+	return ok
+}
+
+func (a Algorithm) String() string {
+	algorithm, ok := a.lookup()
+	if !ok {
+		return "unknown"
+	}
+
+	return algorithm.name
+}
+
+// Size returns the size of the digest in bytes, or zero if the algorithm is
+// not registered
+func (a Algorithm) Size() int {
+	algorithm, _ := a.lookup()
+	return algorithm.size
+}
+
+func (a Algorithm) New() (hash.Hash, error) {
+	algorithm, ok := a.lookup()
+	if !ok {
+		return nil, ErrUnknownAlgorithm
+	}
+
+	return algorithm.new(), nil
+}
+
+// FromReader is like the package level FromReader, but with this algorithm
+func (a Algorithm) FromReader(r io.Reader) ([]byte, error) {
+	hasher, err := a.New()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(hasher, r); err != nil {
+		return nil, err
+	}
+
+	return hasher.Sum(nil), nil
+}
+
+func (a Algorithm) lookup() (algorithm, bool) {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+
+	algorithm, ok := algorithms[a]
+	return algorithm, ok
+}
+
+func newBlake2b256() hash.Hash {
+	// the error is only returned for keys which are too long
+	hasher, _ := blake2b.New256(nil)
+	return hasher
+}
+
+func newBlake3() hash.Hash {
+	return blake3.New(32, nil)
+}
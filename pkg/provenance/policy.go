@@ -0,0 +1,49 @@
+package provenance
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrBuilderMismatch    = errors.New("provenance builder is not matched")
+	ErrRepositoryMismatch = errors.New("provenance source repository is not matched")
+	ErrRefMismatch        = errors.New("provenance source ref is not matched")
+)
+
+// TagRef only accepts artifacts built from a tag
+var TagRef = regexp.MustCompile(`^refs/tags/`)
+
+// Policy is what the provenance of an artifact must say, empty fields are not
+// checked
+type Policy struct {
+	// BuilderID is matched exactly, or without the version after the @ of the
+	// provenance builder, e.g. a reusable workflow of slsa-github-generator
+	BuilderID string
+	// SourceRepository is the repository the artifact is built from, e.g.
+	// https://github.com/owner/repo
+	SourceRepository string
+	// SourceRef matches the git ref the artifact is built from, e.g. TagRef
+	SourceRef *regexp.Regexp
+}
+
+// Check returns an error if the provenance doesn't satisfy the policy
+func (p Policy) Check(provenance *Provenance) error {
+	if p.BuilderID != "" && provenance.BuilderID != p.BuilderID {
+		builderID, _, _ := strings.Cut(provenance.BuilderID, "@")
+		if builderID != p.BuilderID {
+			return ErrBuilderMismatch
+		}
+	}
+
+	if p.SourceRepository != "" && provenance.SourceRepository != normalizeRepository(p.SourceRepository) {
+		return ErrRepositoryMismatch
+	}
+
+	if p.SourceRef != nil && !p.SourceRef.MatchString(provenance.SourceRef) {
+		return ErrRefMismatch
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package provenance_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"regexp"
+	"testing"
+
+	"selfupdate.blockthrough.com/pkg/crypto"
+	"selfupdate.blockthrough.com/pkg/dsse"
+	"selfupdate.blockthrough.com/pkg/provenance"
+	"selfupdate.blockthrough.com/pkg/sigstore"
+)
+
+func TestVerify(t *testing.T) {
+	publicKey, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherPublicKey, _, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	artifact := []byte("hello, world")
+
+	statement, err := provenance.NewStatement("app-linux-amd64", artifact, provenance.Provenance{
+		BuilderID:        "https://github.com/owner/repo/.github/workflows/release.yml@refs/tags/v1.0.0",
+		SourceRepository: "https://github.com/owner/repo",
+		SourceRef:        "refs/tags/v1.0.0",
+		SourceCommit:     "f0b49a04e5a62250e0f60fb128004a73110fe311",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelope, err := dsse.Sign(context.Background(), dsse.PayloadTypeInToto, payload, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attestation, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the attestation of another artifact is skipped
+	otherStatement, err := provenance.NewStatement("app-darwin-arm64", []byte("other"), provenance.Provenance{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherPayload, err := json.Marshal(otherStatement)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherEnvelope, err := dsse.Sign(context.Background(), dsse.PayloadTypeInToto, otherPayload, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherAttestation, err := json.Marshal(otherEnvelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attestations := append(append(otherAttestation, '\n'), attestation...)
+
+	policy := provenance.Policy{
+		BuilderID:        "https://github.com/owner/repo/.github/workflows/release.yml",
+		SourceRepository: "https://github.com/owner/repo",
+		SourceRef:        provenance.TagRef,
+	}
+
+	tests := []struct {
+		name     string
+		verifier provenance.Verifier
+		artifact []byte
+		policy   provenance.Policy
+		err      error
+	}{
+		{"matching", provenance.NewKeyringVerifier(crypto.NewKeyring(publicKey)), artifact, policy, nil},
+		{"untrusted key", provenance.NewKeyringVerifier(crypto.NewKeyring(otherPublicKey)), artifact, policy, dsse.ErrEnvelopeUnsigned},
+		{"other artifact", provenance.NewKeyringVerifier(crypto.NewKeyring(publicKey)), []byte("hello, world!"), policy, provenance.ErrSubjectMismatch},
+		{"other builder", provenance.NewKeyringVerifier(crypto.NewKeyring(publicKey)), artifact, provenance.Policy{BuilderID: "https://github.com/owner/repo/.github/workflows/other.yml"}, provenance.ErrBuilderMismatch},
+		{"other repository", provenance.NewKeyringVerifier(crypto.NewKeyring(publicKey)), artifact, provenance.Policy{SourceRepository: "https://github.com/owner/fork"}, provenance.ErrRepositoryMismatch},
+		{"other ref", provenance.NewKeyringVerifier(crypto.NewKeyring(publicKey)), artifact, provenance.Policy{SourceRef: regexp.MustCompile(`^refs/heads/main$`)}, provenance.ErrRefMismatch},
+	}
+
+	for _, tt := range tests {
+		prov, err := provenance.Verify(tt.verifier, attestations, tt.artifact, tt.policy)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v but got %v", tt.name, tt.err, err)
+		} else if err == nil && prov.SourceCommit != "f0b49a04e5a62250e0f60fb128004a73110fe311" {
+			t.Errorf("%s: provenance is not matched", tt.name)
+		}
+	}
+
+	if _, err := provenance.Verify(provenance.NewKeyringVerifier(crypto.NewKeyring(publicKey)), nil, artifact, policy); !errors.Is(err, provenance.ErrNoAttestation) {
+		t.Fatalf("expected no attestation, got %v", err)
+	}
+}
+
+func TestSigstoreProvenance(t *testing.T) {
+	// the build provenance of sigstore-js, signed by GitHub Actions
+	data, err := os.ReadFile("../sigstore/testdata/provenance.sigstore.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := provenance.NewSigstoreVerifier(sigstore.PublicGoodTrustedRoot(), sigstore.GitHubActionsIdentity("sigstore/sigstore-js", "release.yml"))
+	if _, err := verifier.VerifyAttestation(data); !errors.Is(err, sigstore.ErrIdentityMismatch) {
+		t.Fatalf("expected identity mismatch for a build of a branch, got %v", err)
+	}
+
+	verifier = provenance.NewSigstoreVerifier(sigstore.PublicGoodTrustedRoot(), sigstore.Identity{
+		Issuer:  sigstore.GitHubActionsIssuer,
+		Subject: "https://github.com/sigstore/sigstore-js/.github/workflows/release.yml@refs/heads/main",
+	})
+
+	envelope, err := verifier.VerifyAttestation(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statement, err := provenance.ParseStatement(envelope.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prov, err := statement.Provenance()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := provenance.Provenance{
+		BuilderID:        "https://github.com/actions/runner/github-hosted",
+		SourceRepository: "https://github.com/sigstore/sigstore-js",
+		SourceRef:        "refs/heads/main",
+		SourceCommit:     "f0b49a04e5a62250e0f60fb128004a73110fe311",
+	}
+
+	if *prov != expected {
+		t.Fatalf("expected %+v, got %+v", expected, *prov)
+	}
+
+	// the subject is the npm package, not an artifact of this test
+	if _, err := provenance.Verify(verifier, data, []byte("hello, world"), provenance.Policy{}); !errors.Is(err, provenance.ErrSubjectMismatch) {
+		t.Fatalf("expected subject mismatch, got %v", err)
+	}
+}
+
+func TestProvenanceV02(t *testing.T) {
+	statement := &provenance.Statement{
+		Type:          provenance.StatementTypeV01,
+		PredicateType: provenance.PredicateTypeSLSAV02,
+		Predicate: json.RawMessage(`{
+			"builder": {"id": "https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml@refs/tags/v1.9.0"},
+			"invocation": {"configSource": {"uri": "git+https://github.com/owner/repo@refs/tags/v1.0.0", "digest": {"sha1": "abc"}}}
+		}`),
+	}
+
+	prov, err := statement.Provenance()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := provenance.Policy{
+		BuilderID:        "https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml",
+		SourceRepository: "https://github.com/owner/repo.git",
+		SourceRef:        provenance.TagRef,
+	}
+
+	if err := policy.Check(prov); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,228 @@
+package provenance
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"selfupdate.blockthrough.com/pkg/hash"
+)
+
+const (
+	StatementTypeV01 = "https://in-toto.io/Statement/v0.1"
+	StatementTypeV1  = "https://in-toto.io/Statement/v1"
+
+	PredicateTypeSLSAV02 = "https://slsa.dev/provenance/v0.2"
+	PredicateTypeSLSAV1  = "https://slsa.dev/provenance/v1"
+
+	// BuildTypeGitHubActions is the build type of SLSA v1 provenance generated
+	// for GitHub Actions workflows
+	BuildTypeGitHubActions = "https://slsa-framework.github.io/github-actions-buildtypes/workflow/v1"
+)
+
+var (
+	ErrUnknownStatement = errors.New("unknown in-toto statement type")
+	ErrUnknownPredicate = errors.New("unknown provenance predicate type")
+)
+
+// Statement is an in-toto statement, which makes a claim, the predicate, about
+// the subjects
+type Statement struct {
+	Type          string          `json:"_type"`
+	Subject       []Subject       `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate"`
+}
+
+// Subject is an artifact identified by its digests, keyed by the algorithm
+// names of pkg/hash, e.g. sha256
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Provenance is what a SLSA provenance predicate says about how the subjects
+// were built, in both versions of the predicate
+type Provenance struct {
+	BuilderID        string
+	SourceRepository string
+	SourceRef        string
+	SourceCommit     string
+}
+
+// predicateV02 is the part of a SLSA v0.2 predicate Provenance is read from
+type predicateV02 struct {
+	Builder struct {
+		ID string `json:"id"`
+	} `json:"builder"`
+	Invocation struct {
+		ConfigSource struct {
+			URI    string            `json:"uri"`
+			Digest map[string]string `json:"digest"`
+		} `json:"configSource"`
+	} `json:"invocation"`
+}
+
+// predicateV1 is the part of a SLSA v1 predicate Provenance is read from, the
+// source is in the external parameters of GitHub Actions builds, otherwise it's
+// the first git dependency
+type predicateV1 struct {
+	BuildDefinition struct {
+		BuildType          string `json:"buildType"`
+		ExternalParameters struct {
+			Workflow struct {
+				Repository string `json:"repository"`
+				Ref        string `json:"ref"`
+			} `json:"workflow"`
+		} `json:"externalParameters"`
+		ResolvedDependencies []resourceDescriptor `json:"resolvedDependencies"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+	} `json:"runDetails"`
+}
+
+type resourceDescriptor struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest"`
+}
+
+// NewStatement returns a statement with the artifact as the only subject and a
+// SLSA v1 predicate of the provenance
+func NewStatement(name string, artifact []byte, provenance Provenance) (*Statement, error) {
+	digest, err := hash.SHA256.FromReader(bytes.NewReader(artifact))
+	if err != nil {
+		return nil, err
+	}
+
+	var predicate predicateV1
+	predicate.BuildDefinition.BuildType = BuildTypeGitHubActions
+	predicate.BuildDefinition.ExternalParameters.Workflow.Repository = provenance.SourceRepository
+	predicate.BuildDefinition.ExternalParameters.Workflow.Ref = provenance.SourceRef
+	predicate.BuildDefinition.ResolvedDependencies = []resourceDescriptor{{
+		URI:    "git+" + provenance.SourceRepository + "@" + provenance.SourceRef,
+		Digest: map[string]string{"gitCommit": provenance.SourceCommit},
+	}}
+	predicate.RunDetails.Builder.ID = provenance.BuilderID
+
+	data, err := json.Marshal(predicate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Statement{
+		Type: StatementTypeV1,
+		Subject: []Subject{{
+			Name:   name,
+			Digest: map[string]string{hash.SHA256.String(): hex.EncodeToString(digest)},
+		}},
+		PredicateType: PredicateTypeSLSAV1,
+		Predicate:     data,
+	}, nil
+}
+
+// ParseStatement reads a statement, e.g. the payload of a DSSE envelope
+func ParseStatement(data []byte) (*Statement, error) {
+	var statement Statement
+	if err := json.Unmarshal(data, &statement); err != nil {
+		return nil, err
+	}
+
+	if statement.Type != StatementTypeV01 && statement.Type != StatementTypeV1 {
+		return nil, ErrUnknownStatement
+	}
+
+	return &statement, nil
+}
+
+// Provenance returns the provenance of a SLSA v0.2 or v1 predicate
+func (s *Statement) Provenance() (*Provenance, error) {
+	switch s.PredicateType {
+	case PredicateTypeSLSAV02:
+		var predicate predicateV02
+		if err := json.Unmarshal(s.Predicate, &predicate); err != nil {
+			return nil, err
+		}
+
+		repository, ref := splitSourceURI(predicate.Invocation.ConfigSource.URI)
+		return &Provenance{
+			BuilderID:        predicate.Builder.ID,
+			SourceRepository: repository,
+			SourceRef:        ref,
+			SourceCommit:     predicate.Invocation.ConfigSource.Digest["sha1"],
+		}, nil
+	case PredicateTypeSLSAV1:
+		var predicate predicateV1
+		if err := json.Unmarshal(s.Predicate, &predicate); err != nil {
+			return nil, err
+		}
+
+		provenance := &Provenance{
+			BuilderID: predicate.RunDetails.Builder.ID,
+		}
+
+		for _, dependency := range predicate.BuildDefinition.ResolvedDependencies {
+			if strings.HasPrefix(dependency.URI, "git+") {
+				provenance.SourceRepository, provenance.SourceRef = splitSourceURI(dependency.URI)
+				provenance.SourceCommit = dependency.Digest["gitCommit"]
+				break
+			}
+		}
+
+		if workflow := predicate.BuildDefinition.ExternalParameters.Workflow; workflow.Repository != "" {
+			provenance.SourceRepository = normalizeRepository(workflow.Repository)
+			provenance.SourceRef = workflow.Ref
+		}
+
+		return provenance, nil
+	}
+
+	return nil, ErrUnknownPredicate
+}
+
+// matches reports whether any subject is the artifact. Every digest of the
+// subject with an algorithm of pkg/hash must match, and there has to be one.
+func (s *Statement) matches(artifact []byte) bool {
+	for _, subject := range s.Subject {
+		matched := false
+
+		for name, expected := range subject.Digest {
+			algorithm, err := hash.Lookup(name)
+			if err != nil {
+				continue
+			}
+
+			digest, err := algorithm.FromReader(bytes.NewReader(artifact))
+			if err != nil || hex.EncodeToString(digest) != strings.ToLower(expected) {
+				matched = false
+				break
+			}
+
+			matched = true
+		}
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitSourceURI splits a git uri of SLSA, e.g. git+https://github.com/owner/repo@refs/tags/v1.0.0
+func splitSourceURI(uri string) (repository string, ref string) {
+	uri = strings.TrimPrefix(uri, "git+")
+	if i := strings.LastIndex(uri, "@"); i >= 0 {
+		return normalizeRepository(uri[:i]), uri[i+1:]
+	}
+
+	return normalizeRepository(uri), ""
+}
+
+func normalizeRepository(repository string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(repository, "git+"), ".git")
+}
@@ -0,0 +1,115 @@
+package provenance
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"selfupdate.blockthrough.com/pkg/crypto"
+	"selfupdate.blockthrough.com/pkg/dsse"
+	"selfupdate.blockthrough.com/pkg/sigstore"
+)
+
+var (
+	ErrNoAttestation   = errors.New("no attestation found")
+	ErrSubjectMismatch = errors.New("attestation subject is not the artifact")
+	ErrPayloadType     = errors.New("attestation payload is not an in-toto statement")
+)
+
+// Verifier checks the signature of an attestation and returns its envelope
+type Verifier interface {
+	VerifyAttestation(data []byte) (*dsse.Envelope, error)
+}
+
+type VerifierFunc func(data []byte) (*dsse.Envelope, error)
+
+func (f VerifierFunc) VerifyAttestation(data []byte) (*dsse.Envelope, error) {
+	return f(data)
+}
+
+// NewKeyringVerifier accepts DSSE envelopes signed by any key of the keyring,
+// e.g. created by 'selfupdate crypto attest'
+func NewKeyringVerifier(keyring *crypto.Keyring) Verifier {
+	return VerifierFunc(func(data []byte) (*dsse.Envelope, error) {
+		envelope, err := dsse.Parse(data)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := envelope.Verify(keyring); err != nil {
+			return nil, err
+		}
+
+		return envelope, nil
+	})
+}
+
+// NewSigstoreVerifier accepts sigstore bundles of DSSE envelopes signed by the
+// identity, e.g. created by the actions/attest-build-provenance GitHub Action
+func NewSigstoreVerifier(root *sigstore.TrustedRoot, identity sigstore.Identity) Verifier {
+	return VerifierFunc(func(data []byte) (*dsse.Envelope, error) {
+		bundle, err := sigstore.ParseBundle(data)
+		if err != nil {
+			return nil, err
+		}
+
+		return root.VerifyEnvelope(bundle, identity)
+	})
+}
+
+// Verify checks the attestations, a sequence of JSON documents like the lines of
+// .intoto.jsonl files, and returns the provenance of the first one which is
+// signed, has the artifact as its subject and satisfies the policy. If there is
+// none, the error of the last attestation is returned.
+func Verify(verifier Verifier, attestations []byte, artifact []byte, policy Policy) (*Provenance, error) {
+	err := ErrNoAttestation
+
+	decoder := json.NewDecoder(bytes.NewReader(attestations))
+	for {
+		var attestation json.RawMessage
+		if decodeErr := decoder.Decode(&attestation); decodeErr == io.EOF {
+			break
+		} else if decodeErr != nil {
+			return nil, decodeErr
+		}
+
+		var provenance *Provenance
+		if provenance, err = verifyAttestation(verifier, attestation, artifact, policy); err == nil {
+			return provenance, nil
+		}
+	}
+
+	return nil, err
+}
+
+func verifyAttestation(verifier Verifier, data []byte, artifact []byte, policy Policy) (*Provenance, error) {
+	envelope, err := verifier.VerifyAttestation(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if envelope.PayloadType != dsse.PayloadTypeInToto {
+		return nil, ErrPayloadType
+	}
+
+	statement, err := ParseStatement(envelope.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if !statement.matches(artifact) {
+		return nil, ErrSubjectMismatch
+	}
+
+	provenance, err := statement.Provenance()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := policy.Check(provenance); err != nil {
+		return nil, err
+	}
+
+	return provenance, nil
+}
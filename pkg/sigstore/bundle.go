@@ -0,0 +1,180 @@
+package sigstore
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	"selfupdate.blockthrough.com/pkg/dsse"
+	"selfupdate.blockthrough.com/pkg/hash"
+)
+
+const (
+	// BundleMediaTypePrefix is the common prefix of the media types of every
+	// bundle version, e.g. application/vnd.dev.sigstore.bundle.v0.3+json
+	BundleMediaTypePrefix = "application/vnd.dev.sigstore.bundle"
+)
+
+var (
+	ErrInvalidBundle = errors.New("invalid sigstore bundle")
+)
+
+// digestAlgorithms maps the bundle names of the digest algorithms to the ones of
+// pkg/hash, whose names are used in the transparency log entries
+var digestAlgorithms = map[string]hash.Algorithm{
+	"SHA2_256": hash.SHA256,
+	"SHA2_512": hash.SHA512,
+}
+
+// Bundle is a .sigstore bundle as written by 'cosign sign-blob --bundle' with
+// the new bundle format, or by the sigstore GitHub Actions. It carries the
+// signing certificate, the signature of the artifact and the transparency log
+// entry, so it can be verified without contacting any sigstore service.
+// Versions 0.1 to 0.3 are supported. The content is either a message signature
+// of an artifact, or a DSSE envelope, e.g. an attestation of GitHub Actions.
+type Bundle struct {
+	certificate []byte
+	tlogEntries []tlogEntry
+	algorithm   string
+	digest      []byte
+	// signature is either the message signature or the only signature of the
+	// envelope
+	signature []byte
+	envelope  *dsse.Envelope
+}
+
+type tlogEntry struct {
+	LogIndex int64 `json:"logIndex,string"`
+	LogID    struct {
+		KeyID []byte `json:"keyId"`
+	} `json:"logId"`
+	KindVersion struct {
+		Kind    string `json:"kind"`
+		Version string `json:"version"`
+	} `json:"kindVersion"`
+	IntegratedTime   int64 `json:"integratedTime,string"`
+	InclusionPromise *struct {
+		SignedEntryTimestamp []byte `json:"signedEntryTimestamp"`
+	} `json:"inclusionPromise"`
+	InclusionProof *struct {
+		LogIndex   int64    `json:"logIndex,string"`
+		RootHash   []byte   `json:"rootHash"`
+		TreeSize   int64    `json:"treeSize,string"`
+		Hashes     [][]byte `json:"hashes"`
+		Checkpoint struct {
+			Envelope string `json:"envelope"`
+		} `json:"checkpoint"`
+	} `json:"inclusionProof"`
+	CanonicalizedBody []byte `json:"canonicalizedBody"`
+}
+
+type bundleJSON struct {
+	MediaType            string `json:"mediaType"`
+	VerificationMaterial struct {
+		// v0.1 and v0.2 have the chain, v0.3 only the leaf certificate
+		X509CertificateChain *struct {
+			Certificates []rawBytesJSON `json:"certificates"`
+		} `json:"x509CertificateChain"`
+		Certificate *rawBytesJSON `json:"certificate"`
+		TlogEntries []tlogEntry   `json:"tlogEntries"`
+	} `json:"verificationMaterial"`
+	MessageSignature *struct {
+		MessageDigest *struct {
+			Algorithm string `json:"algorithm"`
+			Digest    []byte `json:"digest"`
+		} `json:"messageDigest"`
+		Signature []byte `json:"signature"`
+	} `json:"messageSignature"`
+	DSSEEnvelope *dsse.Envelope `json:"dsseEnvelope"`
+}
+
+// ParseBundle reads a bundle
+func ParseBundle(data []byte) (*Bundle, error) {
+	var bundleJSON bundleJSON
+	if err := json.Unmarshal(data, &bundleJSON); err != nil {
+		return nil, err
+	}
+
+	return newBundle(&bundleJSON)
+}
+
+// ReadBundle reads a bundle from the start of r and returns the rest of r, so
+// the bundle can be followed by the artifact, which is the layout of the
+// detached downloader
+func ReadBundle(r io.Reader) (*Bundle, io.Reader, error) {
+	decoder := json.NewDecoder(r)
+
+	var bundleJSON bundleJSON
+	if err := decoder.Decode(&bundleJSON); err != nil {
+		return nil, nil, err
+	}
+
+	bundle, err := newBundle(&bundleJSON)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return bundle, skipNewline(io.MultiReader(decoder.Buffered(), r)), nil
+}
+
+func newBundle(bundleJSON *bundleJSON) (*Bundle, error) {
+	if !strings.HasPrefix(bundleJSON.MediaType, BundleMediaTypePrefix) {
+		return nil, ErrInvalidBundle
+	}
+
+	bundle := &Bundle{
+		tlogEntries: bundleJSON.VerificationMaterial.TlogEntries,
+	}
+
+	if bundleJSON.MessageSignature != nil {
+		bundle.signature = bundleJSON.MessageSignature.Signature
+
+		if digest := bundleJSON.MessageSignature.MessageDigest; digest != nil {
+			bundle.algorithm = digest.Algorithm
+			bundle.digest = digest.Digest
+		}
+	} else if envelope := bundleJSON.DSSEEnvelope; envelope != nil && len(envelope.Signatures) == 1 {
+		bundle.signature = envelope.Signatures[0].Sig
+		bundle.envelope = envelope
+	} else {
+		return nil, ErrInvalidBundle
+	}
+
+	material := bundleJSON.VerificationMaterial
+	if material.Certificate != nil {
+		bundle.certificate = material.Certificate.RawBytes
+	} else if material.X509CertificateChain != nil && len(material.X509CertificateChain.Certificates) > 0 {
+		// the rest of the chain is never trusted, it comes from the trusted root
+		bundle.certificate = material.X509CertificateChain.Certificates[0].RawBytes
+	} else {
+		return nil, ErrInvalidBundle
+	}
+
+	return bundle, nil
+}
+
+// digestAlgorithm returns the algorithm the artifact is hashed with
+func (bundle *Bundle) digestAlgorithm() (hash.Algorithm, error) {
+	if bundle.algorithm == "" {
+		return hash.SHA256, nil
+	}
+
+	algorithm, ok := digestAlgorithms[bundle.algorithm]
+	if !ok {
+		return 0, ErrUnknownAlgorithm
+	}
+
+	return algorithm, nil
+}
+
+// skipNewline drops the newline a bundle file usually ends with
+func skipNewline(r io.Reader) io.Reader {
+	var first [1]byte
+	n, err := io.ReadFull(r, first[:])
+	if err != nil || first[0] == '\n' {
+		return r
+	}
+
+	return io.MultiReader(strings.NewReader(string(first[:n])), r)
+}
@@ -0,0 +1,133 @@
+package sigstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// The canonicalized bodies of the transparency log entries a bundle can refer
+// to. A message signature is logged as a hashedrekord, a DSSE envelope either
+// as intoto or, more recently, as dsse.
+const (
+	kindHashedRekord = "hashedrekord"
+	kindInToto       = "intoto"
+	kindDSSE         = "dsse"
+)
+
+type entryBody struct {
+	Kind string `json:"kind"`
+}
+
+// hashedRekordBody records the digest of the artifact, its signature and the
+// signing certificate
+type hashedRekordBody struct {
+	Spec struct {
+		Data struct {
+			Hash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"hash"`
+		} `json:"data"`
+		Signature struct {
+			Content   []byte `json:"content"`
+			PublicKey struct {
+				Content []byte `json:"content"`
+			} `json:"publicKey"`
+		} `json:"signature"`
+	} `json:"spec"`
+}
+
+// inTotoBody records the envelope with the signing certificate, the signature
+// is base64 encoded twice
+type inTotoBody struct {
+	Spec struct {
+		Content struct {
+			Envelope struct {
+				Signatures []struct {
+					Sig       []byte `json:"sig"`
+					PublicKey []byte `json:"publicKey"`
+				} `json:"signatures"`
+			} `json:"envelope"`
+			PayloadHash hashJSON `json:"payloadHash"`
+		} `json:"content"`
+	} `json:"spec"`
+}
+
+// dsseBody records the signatures of the envelope with the signing certificate
+type dsseBody struct {
+	Spec struct {
+		PayloadHash hashJSON `json:"payloadHash"`
+		Signatures  []struct {
+			Signature string `json:"signature"`
+			Verifier  []byte `json:"verifier"`
+		} `json:"signatures"`
+	} `json:"spec"`
+}
+
+type hashJSON struct {
+	Algorithm string `json:"algorithm"`
+	Value     string `json:"value"`
+}
+
+func parseEntryBody(data []byte, kind string, body any) bool {
+	var header entryBody
+	if err := json.Unmarshal(data, &header); err != nil || header.Kind != kind {
+		return false
+	}
+
+	return json.Unmarshal(data, body) == nil
+}
+
+// matchesHashedRekord reports whether the entry records the message signature
+// of the bundle for the artifact digest
+func (bundle *Bundle) matchesHashedRekord(data []byte, digestAlgorithm string, digest []byte) bool {
+	var body hashedRekordBody
+	if !parseEntryBody(data, kindHashedRekord, &body) {
+		return false
+	}
+
+	return body.Spec.Data.Hash.Algorithm == digestAlgorithm &&
+		body.Spec.Data.Hash.Value == hex.EncodeToString(digest) &&
+		bytes.Equal(body.Spec.Signature.Content, bundle.signature) &&
+		bytes.Equal(pemBytes(body.Spec.Signature.PublicKey.Content), bundle.certificate)
+}
+
+// matchesEnvelope reports whether the entry records the signature of the DSSE
+// envelope of the bundle
+func (bundle *Bundle) matchesEnvelope(data []byte) bool {
+	payloadHash := sha256.Sum256(bundle.envelope.Payload)
+
+	var inToto inTotoBody
+	if parseEntryBody(data, kindInToto, &inToto) {
+		content := inToto.Spec.Content
+		if len(content.Envelope.Signatures) != 1 || !matchesHash(content.PayloadHash, payloadHash[:]) {
+			return false
+		}
+
+		sig, err := base64.StdEncoding.DecodeString(string(content.Envelope.Signatures[0].Sig))
+		return err == nil &&
+			bytes.Equal(sig, bundle.signature) &&
+			bytes.Equal(pemBytes(content.Envelope.Signatures[0].PublicKey), bundle.certificate)
+	}
+
+	var dsse dsseBody
+	if parseEntryBody(data, kindDSSE, &dsse) {
+		if len(dsse.Spec.Signatures) != 1 || !matchesHash(dsse.Spec.PayloadHash, payloadHash[:]) {
+			return false
+		}
+
+		sig, err := base64.StdEncoding.DecodeString(dsse.Spec.Signatures[0].Signature)
+		return err == nil &&
+			bytes.Equal(sig, bundle.signature) &&
+			bytes.Equal(pemBytes(dsse.Spec.Signatures[0].Verifier), bundle.certificate)
+	}
+
+	return false
+}
+
+func matchesHash(hash hashJSON, sum []byte) bool {
+	return hash.Algorithm == "sha256" && hash.Value == hex.EncodeToString(sum)
+}
@@ -0,0 +1,196 @@
+package sigstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTlogEntryMissing = errors.New("bundle has no transparency log entry")
+	ErrTlogUnknown      = errors.New("transparency log is not trusted")
+	ErrTlogInvalid      = errors.New("transparency log entry is invalid")
+	ErrInclusionProof   = errors.New("transparency log inclusion proof is invalid")
+)
+
+// signedEntryTimestamp is what the log signs when it promises to include an
+// entry, the fields are in the order of the canonical JSON
+type signedEntryTimestamp struct {
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogID          string `json:"logID"`
+	LogIndex       int64  `json:"logIndex"`
+}
+
+// verifyTlogEntry checks that the entry is signed by a trusted log, that it's
+// included in the tree of a signed checkpoint and that its body matches the
+// bundle. It returns the time the entry was integrated into the log.
+func (root *TrustedRoot) verifyTlogEntry(entry *tlogEntry, matchesBody func(body []byte) bool) (time.Time, error) {
+	integratedTime := time.Unix(entry.IntegratedTime, 0)
+
+	var tlog *transparencyLog
+	for i := range root.tlogs {
+		if bytes.Equal(root.tlogs[i].id, entry.LogID.KeyID) && validAt(integratedTime, root.tlogs[i].start, root.tlogs[i].end) {
+			tlog = &root.tlogs[i]
+			break
+		}
+	}
+
+	if tlog == nil {
+		return time.Time{}, ErrTlogUnknown
+	}
+
+	// the integrated time is only covered by the signed entry timestamp, and
+	// the certificate is checked at that time
+	if entry.InclusionPromise == nil || entry.InclusionProof == nil {
+		return time.Time{}, ErrTlogInvalid
+	}
+
+	set, err := json.Marshal(signedEntryTimestamp{
+		Body:           base64.StdEncoding.EncodeToString(entry.CanonicalizedBody),
+		IntegratedTime: entry.IntegratedTime,
+		LogID:          hex.EncodeToString(entry.LogID.KeyID),
+		LogIndex:       entry.LogIndex,
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if !verifySignature(tlog.publicKey, set, entry.InclusionPromise.SignedEntryTimestamp) {
+		return time.Time{}, ErrTlogInvalid
+	}
+
+	if err := verifyInclusionProof(tlog, entry); err != nil {
+		return time.Time{}, err
+	}
+
+	if !matchesBody(entry.CanonicalizedBody) {
+		return time.Time{}, ErrTlogInvalid
+	}
+
+	return integratedTime, nil
+}
+
+// verifyInclusionProof checks the RFC 6962 audit path of the entry up to the
+// root hash and the signature of the checkpoint which commits to that root
+func verifyInclusionProof(tlog *transparencyLog, entry *tlogEntry) error {
+	proof := entry.InclusionProof
+
+	if proof.LogIndex < 0 || proof.LogIndex >= proof.TreeSize {
+		return ErrInclusionProof
+	}
+
+	hash := leafHash(entry.CanonicalizedBody)
+	index, lastIndex := proof.LogIndex, proof.TreeSize-1
+
+	for _, sibling := range proof.Hashes {
+		if lastIndex == 0 {
+			return ErrInclusionProof
+		}
+
+		if index%2 == 1 || index == lastIndex {
+			hash = nodeHash(sibling, hash)
+			for index%2 == 0 && index != 0 {
+				index >>= 1
+				lastIndex >>= 1
+			}
+		} else {
+			hash = nodeHash(hash, sibling)
+		}
+
+		index >>= 1
+		lastIndex >>= 1
+	}
+
+	if lastIndex != 0 || !bytes.Equal(hash, proof.RootHash) {
+		return ErrInclusionProof
+	}
+
+	treeSize, rootHash, err := verifyCheckpoint(tlog, proof.Checkpoint.Envelope)
+	if err != nil {
+		return err
+	}
+
+	if treeSize != proof.TreeSize || !bytes.Equal(rootHash, proof.RootHash) {
+		return ErrInclusionProof
+	}
+
+	return nil
+}
+
+// verifyCheckpoint checks a checkpoint in the signed note format and returns the
+// tree size and the root hash it commits to
+//
+//	<origin>
+//	<tree size>
+//	<base64 root hash>
+//	[other lines]
+//
+//	— <name> <base64 of key hint (4 bytes) and signature>
+func verifyCheckpoint(tlog *transparencyLog, envelope string) (int64, []byte, error) {
+	text, signatures, ok := strings.Cut(envelope, "\n\n")
+	if !ok {
+		return 0, nil, ErrInclusionProof
+	}
+	text += "\n"
+
+	verified := false
+	for _, line := range strings.Split(strings.TrimSuffix(signatures, "\n"), "\n") {
+		fields := strings.Fields(strings.TrimPrefix(line, "— "))
+		if len(fields) != 2 {
+			continue
+		}
+
+		signature, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(signature) < 5 || len(tlog.id) < 4 || !bytes.Equal(signature[:4], tlog.id[:4]) {
+			continue
+		}
+
+		if verifySignature(tlog.publicKey, []byte(text), signature[4:]) {
+			verified = true
+			break
+		}
+	}
+
+	if !verified {
+		return 0, nil, ErrInclusionProof
+	}
+
+	lines := strings.Split(text, "\n")
+	if len(lines) < 3 {
+		return 0, nil, ErrInclusionProof
+	}
+
+	treeSize, err := strconv.ParseInt(lines[1], 10, 64)
+	if err != nil {
+		return 0, nil, ErrInclusionProof
+	}
+
+	rootHash, err := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil {
+		return 0, nil, ErrInclusionProof
+	}
+
+	return treeSize, rootHash, nil
+}
+
+func leafHash(data []byte) []byte {
+	hash := sha256.New()
+	hash.Write([]byte{0x00})
+	hash.Write(data)
+	return hash.Sum(nil)
+}
+
+func nodeHash(left []byte, right []byte) []byte {
+	hash := sha256.New()
+	hash.Write([]byte{0x01})
+	hash.Write(left)
+	hash.Write(right)
+	return hash.Sum(nil)
+}
@@ -0,0 +1,174 @@
+package sigstore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidTrustedRoot = errors.New("invalid sigstore trusted root")
+)
+
+//go:embed public-good.json
+var publicGoodTrustedRoot []byte
+
+// TrustedRoot is the set of certificate authorities and transparency logs a
+// bundle is verified against. It's read from the trusted_root.json of a sigstore
+// instance, which is distributed by its TUF repository, e.g.
+//
+//	cosign trusted-root create > trusted_root.json
+//
+// Only the Fulcio certificate authorities and the Rekor transparency logs are
+// used. Certificate transparency logs and timestamp authorities are ignored.
+type TrustedRoot struct {
+	authorities []certificateAuthority
+	tlogs       []transparencyLog
+}
+
+type certificateAuthority struct {
+	roots         *x509.CertPool
+	intermediates *x509.CertPool
+	start         time.Time
+	end           time.Time
+}
+
+type transparencyLog struct {
+	id        []byte
+	publicKey crypto.PublicKey
+	start     time.Time
+	end       time.Time
+}
+
+type trustedRootJSON struct {
+	MediaType   string `json:"mediaType"`
+	Authorities []struct {
+		CertChain struct {
+			Certificates []rawBytesJSON `json:"certificates"`
+		} `json:"certChain"`
+		ValidFor validForJSON `json:"validFor"`
+	} `json:"certificateAuthorities"`
+	Tlogs []struct {
+		PublicKey struct {
+			RawBytes []byte       `json:"rawBytes"`
+			ValidFor validForJSON `json:"validFor"`
+		} `json:"publicKey"`
+		LogID struct {
+			KeyID []byte `json:"keyId"`
+		} `json:"logId"`
+	} `json:"tlogs"`
+}
+
+type rawBytesJSON struct {
+	RawBytes []byte `json:"rawBytes"`
+}
+
+type validForJSON struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// PublicGoodTrustedRoot returns the trusted root of the public sigstore instance,
+// fulcio.sigstore.dev and rekor.sigstore.dev, which is used by cosign and GitHub
+// Actions by default
+func PublicGoodTrustedRoot() *TrustedRoot {
+	root, err := ParseTrustedRoot(publicGoodTrustedRoot)
+	if err != nil {
+		// the embedded file is tested
+		panic(err)
+	}
+
+	return root
+}
+
+// ParseTrustedRoot reads a trusted_root.json file
+func ParseTrustedRoot(data []byte) (*TrustedRoot, error) {
+	var rootJSON trustedRootJSON
+	if err := json.Unmarshal(data, &rootJSON); err != nil {
+		return nil, err
+	}
+
+	root := &TrustedRoot{}
+
+	for _, authorityJSON := range rootJSON.Authorities {
+		certs := authorityJSON.CertChain.Certificates
+		if len(certs) == 0 {
+			return nil, ErrInvalidTrustedRoot
+		}
+
+		authority := certificateAuthority{
+			roots:         x509.NewCertPool(),
+			intermediates: x509.NewCertPool(),
+			start:         authorityJSON.ValidFor.Start,
+			end:           authorityJSON.ValidFor.End,
+		}
+
+		// the chain starts with the issuing certificate and ends with the root
+		for i, certJSON := range certs {
+			cert, err := x509.ParseCertificate(certJSON.RawBytes)
+			if err != nil {
+				return nil, err
+			}
+
+			if i == len(certs)-1 {
+				authority.roots.AddCert(cert)
+			} else {
+				authority.intermediates.AddCert(cert)
+			}
+		}
+
+		root.authorities = append(root.authorities, authority)
+	}
+
+	for _, tlogJSON := range rootJSON.Tlogs {
+		publicKey, err := x509.ParsePKIXPublicKey(tlogJSON.PublicKey.RawBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		id := tlogJSON.LogID.KeyID
+		if len(id) == 0 {
+			sum := sha256.Sum256(tlogJSON.PublicKey.RawBytes)
+			id = sum[:]
+		}
+
+		root.tlogs = append(root.tlogs, transparencyLog{
+			id:        id,
+			publicKey: publicKey,
+			start:     tlogJSON.PublicKey.ValidFor.Start,
+			end:       tlogJSON.PublicKey.ValidFor.End,
+		})
+	}
+
+	if len(root.authorities) == 0 || len(root.tlogs) == 0 {
+		return nil, ErrInvalidTrustedRoot
+	}
+
+	return root, nil
+}
+
+// validAt reports whether t is in the validity period, a zero end means the
+// period is still open
+func validAt(t time.Time, start time.Time, end time.Time) bool {
+	return !t.Before(start) && (end.IsZero() || !t.After(end))
+}
+
+// verifySignature checks an ECDSA signature of the SHA-256 of message, or an
+// Ed25519 signature of the message itself
+func verifySignature(publicKey crypto.PublicKey, message []byte, signature []byte) bool {
+	switch publicKey := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(message)
+		return ecdsa.VerifyASN1(publicKey, digest[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(publicKey, message, signature)
+	}
+
+	return false
+}
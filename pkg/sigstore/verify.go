@@ -0,0 +1,311 @@
+package sigstore
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"io"
+	"regexp"
+	"slices"
+	"time"
+
+	"selfupdate.blockthrough.com/pkg/dsse"
+)
+
+const (
+	// GitHubActionsIssuer is the OIDC issuer of GitHub Actions workflows
+	GitHubActionsIssuer = "https://token.actions.githubusercontent.com"
+)
+
+var (
+	ErrCertificateInvalid = errors.New("signing certificate is not issued by a trusted certificate authority")
+	ErrIdentityMismatch   = errors.New("signing certificate identity is not matched")
+	ErrDigestMismatch     = errors.New("artifact digest is not matched")
+	ErrSignatureInvalid   = errors.New("artifact signature is invalid")
+	ErrUnknownAlgorithm   = errors.New("unknown message digest algorithm")
+)
+
+var (
+	// Fulcio certificate extensions, the first issuer extension is deprecated
+	// but still written next to the DER encoded one
+	oidIssuer         = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	oidIssuerV2       = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+	oidOtherNameSAN   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 7}
+	oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+)
+
+// Identity is who is expected to have signed the artifact, which is the OIDC
+// issuer and subject Fulcio recorded in the signing certificate. The subject is
+// matched with any of the subject alternative names of the certificate, either
+// exactly or with SubjectRegexp.
+type Identity struct {
+	Issuer        string
+	Subject       string
+	SubjectRegexp *regexp.Regexp
+}
+
+// GitHubActionsIdentity expects the artifact to be signed by the given workflow
+// of a repository, e.g. ("owner/repo", "release.yml"), run for a tag
+func GitHubActionsIdentity(repository string, workflow string) Identity {
+	return Identity{
+		Issuer:        GitHubActionsIssuer,
+		SubjectRegexp: regexp.MustCompile("^" + regexp.QuoteMeta("https://github.com/"+repository+"/.github/workflows/"+workflow+"@refs/tags/")),
+	}
+}
+
+func (id Identity) matches(issuer string, subjects []string) bool {
+	if id.Issuer == "" || id.Issuer != issuer {
+		return false
+	}
+
+	for _, subject := range subjects {
+		if id.Subject != "" && subject == id.Subject {
+			return true
+		}
+
+		if id.SubjectRegexp != nil && id.SubjectRegexp.MatchString(subject) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Verify checks the bundle completely offline: the signing certificate chains to
+// a certificate authority of the trusted root at the time the signature was
+// logged, the certificate was issued to the identity, the signature is of the
+// artifact and every transparency log entry is signed by a trusted log and
+// included in it.
+func (root *TrustedRoot) Verify(bundle *Bundle, artifact io.Reader, identity Identity) error {
+	digestAlgorithm, err := bundle.digestAlgorithm()
+	if err != nil {
+		return err
+	}
+
+	digest, err := digestAlgorithm.FromReader(artifact)
+	if err != nil {
+		return err
+	}
+
+	return root.VerifyDigest(bundle, digest, identity)
+}
+
+// VerifyDigest is like Verify, but with the digest of the artifact, which is
+// hashed with the algorithm named in the bundle, SHA-256 by default
+func (root *TrustedRoot) VerifyDigest(bundle *Bundle, digest []byte, identity Identity) error {
+	if bundle.envelope != nil {
+		return ErrInvalidBundle
+	}
+
+	digestAlgorithm, err := bundle.digestAlgorithm()
+	if err != nil {
+		return err
+	}
+
+	if bundle.digest != nil && !bytes.Equal(bundle.digest, digest) {
+		return ErrDigestMismatch
+	}
+
+	publicKey, err := root.verifyMaterial(bundle, identity, func(body []byte) bool {
+		return bundle.matchesHashedRekord(body, digestAlgorithm.String(), digest)
+	})
+	if err != nil {
+		return err
+	}
+
+	if !ecdsa.VerifyASN1(publicKey, digest, bundle.signature) {
+		return ErrSignatureInvalid
+	}
+
+	return nil
+}
+
+// VerifyEnvelope checks a bundle with a DSSE envelope the same way Verify does
+// and returns the envelope, whose payload is only trusted if there is no error
+func (root *TrustedRoot) VerifyEnvelope(bundle *Bundle, identity Identity) (*dsse.Envelope, error) {
+	if bundle.envelope == nil {
+		return nil, ErrInvalidBundle
+	}
+
+	publicKey, err := root.verifyMaterial(bundle, identity, bundle.matchesEnvelope)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256(dsse.PAE(bundle.envelope.PayloadType, bundle.envelope.Payload))
+	if !ecdsa.VerifyASN1(publicKey, digest[:], bundle.signature) {
+		return nil, ErrSignatureInvalid
+	}
+
+	return bundle.envelope, nil
+}
+
+// verifyMaterial checks everything but the signature itself: the transparency
+// log entries, the certificate chain and the identity. It returns the public
+// key of the certificate.
+func (root *TrustedRoot) verifyMaterial(bundle *Bundle, identity Identity, matchesBody func(body []byte) bool) (*ecdsa.PublicKey, error) {
+	if len(bundle.tlogEntries) == 0 {
+		return nil, ErrTlogEntryMissing
+	}
+
+	var integratedTimes []time.Time
+	for i := range bundle.tlogEntries {
+		integratedTime, err := root.verifyTlogEntry(&bundle.tlogEntries[i], matchesBody)
+		if err != nil {
+			return nil, err
+		}
+
+		integratedTimes = append(integratedTimes, integratedTime)
+	}
+
+	cert, err := x509.ParseCertificate(bundle.certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	issuer, subjects, err := certificateIdentity(cert)
+	if err != nil {
+		return nil, err
+	}
+
+	// the certificate only lives for a few minutes, it's enough that it was
+	// valid when the signature was logged
+	for _, integratedTime := range integratedTimes {
+		if !root.verifyCertificate(cert, integratedTime) {
+			return nil, ErrCertificateInvalid
+		}
+	}
+
+	if !identity.matches(issuer, subjects) {
+		return nil, ErrIdentityMismatch
+	}
+
+	// Fulcio only issues certificates for ECDSA keys to sign artifacts
+	publicKey, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, ErrSignatureInvalid
+	}
+
+	return publicKey, nil
+}
+
+func (root *TrustedRoot) verifyCertificate(cert *x509.Certificate, at time.Time) bool {
+	for _, authority := range root.authorities {
+		if !validAt(at, authority.start, authority.end) {
+			continue
+		}
+
+		_, err := cert.Verify(x509.VerifyOptions{
+			Roots:         authority.roots,
+			Intermediates: authority.intermediates,
+			CurrentTime:   at,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		})
+		if err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// certificateIdentity returns the OIDC issuer and the subject alternative names
+// of a Fulcio certificate, including the username!host other names Fulcio
+// issues for some identity providers. It has to be called before the
+// certificate is verified.
+func certificateIdentity(cert *x509.Certificate) (issuer string, subjects []string, err error) {
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidIssuerV2):
+			if _, err := asn1.UnmarshalWithParams(ext.Value, &issuer, "utf8"); err != nil {
+				return "", nil, err
+			}
+		case ext.Id.Equal(oidIssuer) && issuer == "":
+			issuer = string(ext.Value)
+		case ext.Id.Equal(oidSubjectAltName):
+			otherNames, err := parseOtherNames(ext.Value)
+			if err != nil {
+				return "", nil, err
+			}
+
+			subjects = append(subjects, otherNames...)
+
+			// crypto/x509 refuses a critical subject alternative name extension
+			// if it has none of the names it knows, but the other names are
+			// handled here
+			if len(otherNames) > 0 {
+				cert.UnhandledCriticalExtensions = slices.DeleteFunc(cert.UnhandledCriticalExtensions, oidSubjectAltName.Equal)
+			}
+		}
+	}
+
+	for _, uri := range cert.URIs {
+		subjects = append(subjects, uri.String())
+	}
+
+	subjects = append(subjects, cert.EmailAddresses...)
+
+	return issuer, subjects, nil
+}
+
+// parseOtherNames returns the Fulcio other names of a subject alternative name
+// extension, the other kinds of names are parsed by crypto/x509
+//
+//	OtherName ::= [0] IMPLICIT SEQUENCE { type-id OID, value [0] EXPLICIT ANY }
+func parseOtherNames(data []byte) ([]string, error) {
+	var names asn1.RawValue
+	if _, err := asn1.Unmarshal(data, &names); err != nil {
+		return nil, err
+	}
+
+	var otherNames []string
+	for rest := names.Bytes; len(rest) > 0; {
+		var name asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &name); err != nil {
+			return nil, err
+		}
+
+		if name.Class != asn1.ClassContextSpecific || name.Tag != 0 {
+			continue
+		}
+
+		var id asn1.ObjectIdentifier
+		value, err := asn1.Unmarshal(name.Bytes, &id)
+		if err != nil {
+			return nil, err
+		}
+
+		if !id.Equal(oidOtherNameSAN) {
+			continue
+		}
+
+		var wrapped asn1.RawValue
+		if _, err := asn1.Unmarshal(value, &wrapped); err != nil {
+			return nil, err
+		}
+
+		var otherName string
+		if _, err := asn1.UnmarshalWithParams(wrapped.Bytes, &otherName, "utf8"); err != nil {
+			return nil, err
+		}
+
+		otherNames = append(otherNames, otherName)
+	}
+
+	return otherNames, nil
+}
+
+// pemBytes returns the DER bytes of a PEM block, or data itself if it's not PEM
+func pemBytes(data []byte) []byte {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return data
+	}
+
+	return block.Bytes
+}
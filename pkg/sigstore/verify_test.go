@@ -0,0 +1,175 @@
+package sigstore_test
+
+import (
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"selfupdate.blockthrough.com/pkg/sigstore"
+)
+
+// the bundle and the trusted root are from the sigstore-go test data, signed by
+// a local sigstore instance for an identity with an other name
+const (
+	testDigest  = "bc103b4a84971ef6459b294a2b98568a2bfb72cded09d4acd1e16366a401f95b"
+	testIssuer  = "http://oidc.local:8080"
+	testSubject = "foo!oidc.local"
+)
+
+func readTestData(t *testing.T) (*sigstore.TrustedRoot, []byte) {
+	t.Helper()
+
+	rootData, err := os.ReadFile("testdata/scaffolding.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := sigstore.ParseTrustedRoot(rootData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bundleData, err := os.ReadFile("testdata/othername.sigstore.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return root, bundleData
+}
+
+func TestVerifyDigest(t *testing.T) {
+	root, bundleData := readTestData(t)
+
+	digest, err := hex.DecodeString(testDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherDigest := make([]byte, len(digest))
+
+	tests := []struct {
+		name     string
+		root     *sigstore.TrustedRoot
+		bundle   string
+		digest   []byte
+		identity sigstore.Identity
+		err      error
+	}{
+		{"subject", root, string(bundleData), digest, sigstore.Identity{Issuer: testIssuer, Subject: testSubject}, nil},
+		{"subject regexp", root, string(bundleData), digest, sigstore.Identity{Issuer: testIssuer, SubjectRegexp: regexp.MustCompile(`^foo!`)}, nil},
+		{"other subject", root, string(bundleData), digest, sigstore.Identity{Issuer: testIssuer, Subject: "foo@oidc.local"}, sigstore.ErrIdentityMismatch},
+		{"other issuer", root, string(bundleData), digest, sigstore.Identity{Issuer: sigstore.GitHubActionsIssuer, Subject: testSubject}, sigstore.ErrIdentityMismatch},
+		{"no subject", root, string(bundleData), digest, sigstore.Identity{Issuer: testIssuer}, sigstore.ErrIdentityMismatch},
+		{"other digest", root, string(bundleData), otherDigest, sigstore.Identity{Issuer: testIssuer, Subject: testSubject}, sigstore.ErrDigestMismatch},
+		{"public good root", sigstore.PublicGoodTrustedRoot(), string(bundleData), digest, sigstore.Identity{Issuer: testIssuer, Subject: testSubject}, sigstore.ErrTlogUnknown},
+		{"tampered proof", root, strings.Replace(string(bundleData), `"treeSize": "4"`, `"treeSize": "5"`, 1), digest, sigstore.Identity{Issuer: testIssuer, Subject: testSubject}, sigstore.ErrInclusionProof},
+		{"tampered timestamp", root, strings.Replace(string(bundleData), `"integratedTime": "1720811189"`, `"integratedTime": "1720811190"`, 1), digest, sigstore.Identity{Issuer: testIssuer, Subject: testSubject}, sigstore.ErrTlogInvalid},
+	}
+
+	for _, tt := range tests {
+		bundle, err := sigstore.ParseBundle([]byte(tt.bundle))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = tt.root.VerifyDigest(bundle, tt.digest, tt.identity)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v but got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestReadBundle(t *testing.T) {
+	_, bundleData := readTestData(t)
+
+	bundle, rest, err := sigstore.ReadBundle(strings.NewReader(string(bundleData) + "hello, world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bundle == nil {
+		t.Fatal("bundle is not read")
+	}
+
+	content, err := io.ReadAll(rest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "hello, world" {
+		t.Fatalf("expected the content after the bundle, got %q", content)
+	}
+}
+
+func TestGitHubActionsIdentity(t *testing.T) {
+	identity := sigstore.GitHubActionsIdentity("owner/repo", "release.yml")
+
+	tests := []struct {
+		subject string
+		ok      bool
+	}{
+		{"https://github.com/owner/repo/.github/workflows/release.yml@refs/tags/v1.0.0", true},
+		{"https://github.com/owner/repo/.github/workflows/release.yml@refs/heads/main", false},
+		{"https://github.com/owner/repo/.github/workflows/other.yml@refs/tags/v1.0.0", false},
+		{"https://github.com/other/repo/.github/workflows/release.yml@refs/tags/v1.0.0", false},
+	}
+
+	for _, tt := range tests {
+		if ok := identity.SubjectRegexp.MatchString(tt.subject); ok != tt.ok {
+			t.Errorf("%s: expected %v but got %v", tt.subject, tt.ok, ok)
+		}
+	}
+}
+
+func TestVerifyEnvelope(t *testing.T) {
+	// an attestation of the release workflow of sigstore-js, which is logged in
+	// the public instance as an intoto entry
+	bundleData, err := os.ReadFile("testdata/provenance.sigstore.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bundle, err := sigstore.ParseBundle(bundleData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := sigstore.PublicGoodTrustedRoot()
+	identity := sigstore.Identity{
+		Issuer:  sigstore.GitHubActionsIssuer,
+		Subject: "https://github.com/sigstore/sigstore-js/.github/workflows/release.yml@refs/heads/main",
+	}
+
+	envelope, err := root.VerifyEnvelope(bundle, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(envelope.Payload), "https://slsa.dev/provenance/v1") {
+		t.Fatal("payload is not matched")
+	}
+
+	identity.Subject = "https://github.com/sigstore/sigstore-js/.github/workflows/other.yml@refs/heads/main"
+	if _, err := root.VerifyEnvelope(bundle, identity); !errors.Is(err, sigstore.ErrIdentityMismatch) {
+		t.Fatalf("expected identity mismatch, got %v", err)
+	}
+
+	// the payload is covered by the signature and the log entry
+	tampered, err := sigstore.ParseBundle([]byte(strings.Replace(string(bundleData), `"payloadType": "application/vnd.in-toto+json"`, `"payloadType": "application/json"`, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identity.Subject = "https://github.com/sigstore/sigstore-js/.github/workflows/release.yml@refs/heads/main"
+	if _, err := root.VerifyEnvelope(tampered, identity); !errors.Is(err, sigstore.ErrSignatureInvalid) {
+		t.Fatalf("expected invalid signature, got %v", err)
+	}
+
+	if err := root.VerifyDigest(bundle, make([]byte, 32), identity); !errors.Is(err, sigstore.ErrInvalidBundle) {
+		t.Fatalf("expected invalid bundle, got %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"selfupdate.blockthrough.com/pkg/fileutil"
+)
+
+// MinBackoff is how long checks are skipped after the first failure, it
+// doubles with every further failure, up to the check interval
+const MinBackoff = 5 * time.Minute
+
+// State is what the updater remembers between runs of the app
+type State struct {
+	// LastCheck is the time of the last check, whether it succeeded or not
+	LastCheck time.Time `json:"lastCheck,omitempty"`
+	// LatestVersion is the latest version seen by a successful check
+	LatestVersion string `json:"latestVersion,omitempty"`
+	// Failures is the number of checks which failed since the last success
+	Failures  int    `json:"failures,omitempty"`
+	LastError string `json:"lastError,omitempty"`
+	// Staged is the version downloaded in the background, which is installed
+	// on the next run
+	Staged string `json:"staged,omitempty"`
+	// Skipped are the versions the user chose to skip
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// Checked records a check at now, latestVersion is the current version if
+// there was no new one
+func (s *State) Checked(now time.Time, latestVersion string, err error) {
+	s.LastCheck = now.UTC()
+
+	if err != nil {
+		s.Failures++
+		s.LastError = err.Error()
+		return
+	}
+
+	s.LatestVersion = latestVersion
+	s.Failures = 0
+	s.LastError = ""
+}
+
+// NextCheck returns when the next check is due, interval after a successful
+// check, and after a backoff from MinBackoff up to interval after failures
+func (s State) NextCheck(interval time.Duration) time.Time {
+	if s.LastCheck.IsZero() {
+		return time.Time{}
+	}
+
+	if s.Failures == 0 {
+		return s.LastCheck.Add(interval)
+	}
+
+	backoff := MinBackoff
+	for i := 1; i < s.Failures && backoff < interval; i++ {
+		backoff *= 2
+	}
+
+	return s.LastCheck.Add(min(backoff, interval))
+}
+
+// Due reports whether a check is due at now. A last check in the future, e.g.
+// after the clock was turned back, doesn't hold the checks back.
+func (s State) Due(now time.Time, interval time.Duration) bool {
+	return !now.Before(s.NextCheck(interval)) || now.Before(s.LastCheck)
+}
+
+// DefaultPath returns $XDG_STATE_HOME/<app>/selfupdate.json. If XDG_STATE_HOME
+// is not set, ~/.local/state is used, and the local app data dir on windows.
+func DefaultPath(app string) (string, error) {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" && runtime.GOOS == "windows" {
+		var err error
+		if dir, err = os.UserCacheDir(); err != nil {
+			return "", err
+		}
+	} else if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+
+	return filepath.Join(dir, app, "selfupdate.json"), nil
+}
+
+// Store keeps the state in a JSON file
+type Store struct {
+	path string
+}
+
+// New returns a store of the file at path, the file and its directory are
+// created on the first save
+func New(path string) *Store {
+	return &Store{path: path}
+}
+
+// Load returns the saved state, or an empty state if there is none yet
+func (s *Store) Load() (State, error) {
+	var state State
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	} else if err != nil {
+		return state, err
+	}
+
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+func (s *Store) Save(state State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+
+	// concurrent runs of the app never read a truncated file
+	return fileutil.WriteAtomic(s.path, data, 0644)
+}
+
+// Update loads the state, changes it with fn and saves it. A state file which
+// can't be read is replaced, it only holds back checks. Concurrent runs of the
+// app take turns through a lock file next to the state file, so no change is
+// lost.
+func (s *Store) Update(fn func(state *State)) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+
+	// the state file itself is replaced on save, so it can't hold the lock
+	f, err := os.OpenFile(s.path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := fileutil.Lock(f); err != nil {
+		return err
+	}
+	defer fileutil.Unlock(f)
+
+	state, _ := s.Load()
+	fn(&state)
+	return s.Save(state)
+}
@@ -0,0 +1,144 @@
+package state_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"selfupdate.blockthrough.com/pkg/state"
+)
+
+func TestDue(t *testing.T) {
+	interval := 24 * time.Hour
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	failed := errors.New("rate limited")
+
+	tests := []struct {
+		name     string
+		checks   []error
+		elapsed  time.Duration
+		expected bool
+	}{
+		{"never checked", nil, 0, true},
+		{"checked recently", []error{nil}, time.Hour, false},
+		{"checked an interval ago", []error{nil}, interval, true},
+		{"failed recently", []error{failed}, time.Minute, false},
+		{"failed a backoff ago", []error{failed}, state.MinBackoff, true},
+		{"failed twice", []error{failed, failed}, state.MinBackoff, false},
+		{"failed twice a backoff ago", []error{failed, failed}, 2 * state.MinBackoff, true},
+		{"failed often", []error{failed, failed, failed, failed, failed, failed, failed, failed, failed, failed}, interval - time.Minute, false},
+		{"backoff is capped by the interval", []error{failed, failed, failed, failed, failed, failed, failed, failed, failed, failed}, interval, true},
+		{"succeeded after failures", []error{failed, failed, nil}, 2 * state.MinBackoff, false},
+		{"clock turned back", []error{nil}, -time.Hour, true},
+	}
+
+	for _, tt := range tests {
+		var s state.State
+		for _, err := range tt.checks {
+			s.Checked(now, "v1.0.0", err)
+		}
+
+		if due := s.Due(now.Add(tt.elapsed), interval); due != tt.expected {
+			t.Errorf("%s: expected due %t, got %t", tt.name, tt.expected, due)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app", "selfupdate.json")
+	store := state.New(path)
+
+	s, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !s.LastCheck.IsZero() {
+		t.Fatalf("expected an empty state, got %+v", s)
+	}
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	err = store.Update(func(s *state.State) {
+		s.Checked(now, "v1.1.0", nil)
+		s.Staged = "v1.1.0"
+		s.Checked(now, "", errors.New("rate limited"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !s.LastCheck.Equal(now) || s.LatestVersion != "v1.1.0" || s.Failures != 1 || s.LastError != "rate limited" || s.Staged != "v1.1.0" {
+		t.Fatalf("unexpected state %+v", s)
+	}
+
+	// a broken file is replaced
+	if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Load(); err == nil {
+		t.Fatal("expected an error for a broken file")
+	}
+
+	if err := store.Update(func(s *state.State) { s.Checked(now, "v1.2.0", nil) }); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err = store.Load(); err != nil || s.LatestVersion != "v1.2.0" {
+		t.Fatalf("expected the file to be replaced, got %+v, %v", s, err)
+	}
+}
+
+func TestStoreConcurrentUpdate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app", "selfupdate.json")
+	failed := errors.New("rate limited")
+
+	// every store stands for another run of the app updating the same file
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			store := state.New(path)
+			for j := 0; j < 25; j++ {
+				if err := store.Update(func(s *state.State) { s.Checked(time.Now(), "", failed) }); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	s, err := state.New(path).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Failures != 200 {
+		t.Fatalf("expected 200 failures but got %d", s.Failures)
+	}
+}
+
+func TestDefaultPath(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", dir)
+
+	path, err := state.DefaultPath("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if path != filepath.Join(dir, "app", "selfupdate.json") {
+		t.Fatalf("unexpected path %s", path)
+	}
+}
@@ -0,0 +1,130 @@
+package terminal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+var (
+	ErrNotTerminal = errors.New("not a terminal")
+)
+
+// IsTerminal reports whether the file is connected to a terminal
+func IsTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// Open returns the controlling terminal of the process. It works even if stdin
+// and stdout are redirected, e.g. when a binary is piped through a command.
+func Open() (*os.File, error) {
+	name := "/dev/tty"
+	if runtime.GOOS == "windows" {
+		name = "CONIN$"
+	}
+
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return nil, ErrNotTerminal
+	}
+
+	if !IsTerminal(f) {
+		f.Close()
+		return nil, ErrNotTerminal
+	}
+
+	return f, nil
+}
+
+// ReadPassword prints the prompt to stderr and reads a line from the
+// controlling terminal without echoing it
+func ReadPassword(prompt string) (string, error) {
+	tty, err := Open()
+	if err != nil {
+		return "", err
+	}
+	defer tty.Close()
+
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(password), "\r\n"), nil
+}
+
+// ReadLine prints the prompt to stderr and reads a line from the controlling
+// terminal. It reads byte by byte, so nothing after the line is consumed.
+func ReadLine(prompt string) (string, error) {
+	tty, err := Open()
+	if err != nil {
+		return "", err
+	}
+	defer tty.Close()
+
+	fmt.Fprint(os.Stderr, prompt)
+
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := tty.Read(b)
+		if n == 1 && b[0] == '\n' {
+			break
+		} else if n == 1 {
+			line = append(line, b[0])
+		}
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return strings.TrimRight(string(line), "\r"), nil
+}
+
+var (
+	htmlCommentRegExp = regexp.MustCompile(`(?s)<!--.*?-->`)
+	headingRegExp     = regexp.MustCompile(`^#{1,6}\s+`)
+	bulletRegExp      = regexp.MustCompile(`^(\s*)[-*+]\s+`)
+	linkRegExp        = regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`)
+	emphasisRegExp    = regexp.MustCompile("\\*\\*|`")
+)
+
+// RenderMarkdown turns markdown, e.g. release notes, into plain text for the
+// terminal. Headings and emphasis lose their markers, bullets become dots,
+// links are followed by their url, and every line is indented.
+func RenderMarkdown(text string, indent string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = htmlCommentRegExp.ReplaceAllString(text, "")
+
+	var lines []string
+	blank := true
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			// collapse blank lines
+			if !blank {
+				lines = append(lines, "")
+			}
+			blank = true
+			continue
+		}
+		blank = false
+
+		line = headingRegExp.ReplaceAllString(line, "")
+		line = bulletRegExp.ReplaceAllString(line, "$1• ")
+		line = linkRegExp.ReplaceAllString(line, "$1 ($2)")
+		line = emphasisRegExp.ReplaceAllString(line, "")
+
+		lines = append(lines, indent+line)
+	}
+
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
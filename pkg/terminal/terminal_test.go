@@ -0,0 +1,28 @@
+package terminal_test
+
+import (
+	"testing"
+
+	"selfupdate.blockthrough.com/pkg/terminal"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		expected string
+	}{
+		{"plain", "Bug fixes", "  Bug fixes"},
+		{"heading", "## What's Changed\r\n* **New** `--json` flag", "  What's Changed\n  • New --json flag"},
+		{"nested bullets", "- one\n  - two", "  • one\n    • two"},
+		{"link", "See [the docs](https://example.com)", "  See the docs (https://example.com)"},
+		{"blank lines", "\n\none\n\n\n\ntwo\n\n", "  one\n\n  two"},
+		{"comment", "<!-- Release notes generated\nautomatically -->\nFixes", "  Fixes"},
+	}
+
+	for _, tt := range tests {
+		if rendered := terminal.RenderMarkdown(tt.markdown, "  "); rendered != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, rendered)
+		}
+	}
+}
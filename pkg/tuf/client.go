@@ -0,0 +1,319 @@
+package tuf
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+	"time"
+
+	"selfupdate.blockthrough.com/pkg/crypto"
+	"selfupdate.blockthrough.com/pkg/hash"
+)
+
+var (
+	ErrInvalidMetadata   = errors.New("tuf metadata is invalid")
+	ErrThresholdNotMet   = errors.New("tuf metadata has not enough valid signatures")
+	ErrRollback          = errors.New("tuf metadata is older than the trusted metadata")
+	ErrExpired           = errors.New("tuf metadata is expired")
+	ErrMetaMismatch      = errors.New("tuf metadata does not match the parent role")
+	ErrTargetNotFound    = errors.New("tuf target not found")
+	ErrTargetMismatch    = errors.New("tuf target does not match its metadata")
+	ErrNoTrustedMetadata = errors.New("tuf metadata has not been updated")
+	ErrUntrustedStore    = errors.New("tuf metadata in the store is not valid")
+)
+
+// RoleKeys are the trusted keys of a role, metadata of the role is only
+// trusted if at least Threshold of them signed it
+type RoleKeys struct {
+	Keyring   *crypto.Keyring
+	Threshold int
+}
+
+// Root holds the trusted keys of every role, it's embedded in the client
+type Root struct {
+	Timestamp RoleKeys
+	Snapshot  RoleKeys
+	Targets   RoleKeys
+}
+
+// NewRoot trusts the same keys for every role, which is the simplest setup for
+// a single release key
+func NewRoot(keyring *crypto.Keyring, threshold int) Root {
+	keys := RoleKeys{Keyring: keyring, Threshold: threshold}
+	return Root{Timestamp: keys, Snapshot: keys, Targets: keys}
+}
+
+// Fetcher returns the latest published metadata file with the given name
+type Fetcher interface {
+	Fetch(ctx context.Context, name string) ([]byte, error)
+}
+
+type FetcherFunc func(ctx context.Context, name string) ([]byte, error)
+
+var _ Fetcher = (FetcherFunc)(nil)
+
+func (f FetcherFunc) Fetch(ctx context.Context, name string) ([]byte, error) {
+	return f(ctx, name)
+}
+
+type clientOptFn func(c *Client)
+
+// WithClientClock overrides time.Now for checking the expiry of metadata
+func WithClientClock(now func() time.Time) clientOptFn {
+	return func(c *Client) {
+		c.now = now
+	}
+}
+
+// WithClientHashes sets the digest algorithms the hashes of metadata files and
+// targets are checked with, SHA-256 by default. Every listed hash of these
+// algorithms must match, and at least one must be listed.
+func WithClientHashes(algorithms ...hash.Algorithm) clientOptFn {
+	return func(c *Client) {
+		c.hashes = algorithms
+	}
+}
+
+type Client struct {
+	root    Root
+	fetcher Fetcher
+	store   Store
+	now     func() time.Time
+	hashes  []hash.Algorithm
+
+	mu      sync.Mutex
+	targets *Targets
+}
+
+func NewClient(root Root, fetcher Fetcher, store Store, optFns ...clientOptFn) *Client {
+	c := &Client{
+		root:    root,
+		fetcher: fetcher,
+		store:   store,
+		now:     time.Now,
+		hashes:  []hash.Algorithm{hash.SHA256},
+	}
+
+	for _, optFn := range optFns {
+		optFn(c)
+	}
+
+	return c
+}
+
+// Update fetches the timestamp, snapshot and targets metadata, in that order,
+// and returns the targets once every role is verified. The metadata is only
+// saved to the store if all of it is valid, so a failed update leaves the
+// previously trusted metadata in place.
+func (c *Client) Update(ctx context.Context) (*Targets, error) {
+	timestampData, err := c.fetcher.Fetch(ctx, Filename(RoleTimestamp))
+	if err != nil {
+		return nil, err
+	}
+
+	var timestamp Timestamp
+	if err := c.verify(RoleTimestamp, timestampData, c.root.Timestamp, &timestamp.Common, &timestamp); err != nil {
+		return nil, err
+	}
+
+	var trustedTimestamp Timestamp
+	if err := c.trusted(RoleTimestamp, c.root.Timestamp, &trustedTimestamp.Common, &trustedTimestamp); err != nil {
+		return nil, err
+	}
+
+	snapshotMeta, ok := timestamp.Meta[Filename(RoleSnapshot)]
+	if !ok || snapshotMeta.Version < trustedTimestamp.Meta[Filename(RoleSnapshot)].Version {
+		return nil, ErrRollback
+	}
+
+	snapshotData, err := c.fetcher.Fetch(ctx, Filename(RoleSnapshot))
+	if err != nil {
+		return nil, err
+	}
+
+	if !matches(snapshotMeta.Hashes, snapshotMeta.Length, snapshotData, c.hashes) {
+		return nil, ErrMetaMismatch
+	}
+
+	var snapshot Snapshot
+	if err := c.verify(RoleSnapshot, snapshotData, c.root.Snapshot, &snapshot.Common, &snapshot); err != nil {
+		return nil, err
+	}
+
+	if snapshot.Version != snapshotMeta.Version {
+		return nil, ErrMetaMismatch
+	}
+
+	var trustedSnapshot Snapshot
+	if err := c.trusted(RoleSnapshot, c.root.Snapshot, &trustedSnapshot.Common, &trustedSnapshot); err != nil {
+		return nil, err
+	}
+
+	targetsMeta, ok := snapshot.Meta[Filename(RoleTargets)]
+	if !ok || targetsMeta.Version < trustedSnapshot.Meta[Filename(RoleTargets)].Version {
+		return nil, ErrRollback
+	}
+
+	targetsData, err := c.fetcher.Fetch(ctx, Filename(RoleTargets))
+	if err != nil {
+		return nil, err
+	}
+
+	if !matches(targetsMeta.Hashes, targetsMeta.Length, targetsData, c.hashes) {
+		return nil, ErrMetaMismatch
+	}
+
+	var targets Targets
+	if err := c.verify(RoleTargets, targetsData, c.root.Targets, &targets.Common, &targets); err != nil {
+		return nil, err
+	}
+
+	if targets.Version != targetsMeta.Version {
+		return nil, ErrMetaMismatch
+	}
+
+	var trustedTargets Targets
+	if err := c.trusted(RoleTargets, c.root.Targets, &trustedTargets.Common, &trustedTargets); err != nil {
+		return nil, err
+	}
+
+	if timestamp.Version < trustedTimestamp.Version ||
+		snapshot.Version < trustedSnapshot.Version ||
+		targets.Version < trustedTargets.Version {
+		return nil, ErrRollback
+	}
+
+	for _, file := range []struct {
+		role string
+		data []byte
+	}{
+		{RoleTargets, targetsData},
+		{RoleSnapshot, snapshotData},
+		{RoleTimestamp, timestampData},
+	} {
+		if err := c.store.Save(Filename(file.role), file.data); err != nil {
+			return nil, err
+		}
+	}
+
+	c.mu.Lock()
+	c.targets = &targets
+	c.mu.Unlock()
+
+	return &targets, nil
+}
+
+// Target returns the metadata of a release asset from the last Update
+func (c *Client) Target(name string) (TargetFile, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.targets == nil {
+		return TargetFile{}, ErrNoTrustedMetadata
+	}
+
+	target, ok := c.targets.Targets[name]
+	if !ok {
+		return TargetFile{}, ErrTargetNotFound
+	}
+
+	return target, nil
+}
+
+// VerifyTarget checks the length and the hashes of a downloaded release asset
+// against the metadata of the last Update
+func (c *Client) VerifyTarget(name string, data []byte) error {
+	target, err := c.Target(name)
+	if err != nil {
+		return err
+	}
+
+	if !matches(target.Hashes, target.Length, data, c.hashes) {
+		return ErrTargetMismatch
+	}
+
+	return nil
+}
+
+// verify checks the signatures, the type and the expiry of a metadata file and
+// decodes its payload into payload. common must point into payload.
+func (c *Client) verify(role string, data []byte, keys RoleKeys, common *Common, payload any) error {
+	var envelope Envelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return ErrInvalidMetadata
+	}
+
+	if keys.Keyring == nil || keys.Threshold < 1 {
+		return ErrThresholdNotMet
+	}
+
+	digest := sha256.Sum256(envelope.Signed)
+
+	valid := map[crypto.KeyID]bool{}
+	for _, sig := range envelope.Signatures {
+		id, err := crypto.ParseKeyID(sig.KeyID)
+		if err != nil {
+			continue
+		}
+
+		key, ok := keys.Keyring.Get(id)
+		if !ok {
+			continue
+		}
+
+		signature, err := hex.DecodeString(sig.Sig)
+		if err != nil || len(signature) != crypto.SignatureSize {
+			continue
+		}
+
+		if key.Verify(append(signature, digest[:]...)) {
+			valid[id] = true
+		}
+	}
+
+	if len(valid) < keys.Threshold {
+		return ErrThresholdNotMet
+	}
+
+	if err := json.Unmarshal(envelope.Signed, payload); err != nil {
+		return ErrInvalidMetadata
+	}
+
+	if common.Type != role {
+		return ErrInvalidMetadata
+	}
+
+	if !c.now().Before(common.Expires) {
+		return ErrExpired
+	}
+
+	return nil
+}
+
+// trusted loads the metadata of the role from the store. It's not an error if
+// there is none yet, in which case every version is zero. Expired metadata is
+// fine here, it's only used for the version counters. Metadata which is not
+// valid, e.g. stored by a client built with other keys, fails, as starting
+// over from version zero would accept a rollback.
+func (c *Client) trusted(role string, keys RoleKeys, common *Common, payload any) error {
+	data, err := c.store.Load(Filename(role))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	err = c.verify(role, data, keys, common, payload)
+	if errors.Is(err, ErrExpired) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("%w: stored %s: %w", ErrUntrustedStore, Filename(role), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,335 @@
+package tuf_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+	"time"
+
+	"selfupdate.blockthrough.com/pkg/crypto"
+	"selfupdate.blockthrough.com/pkg/hash"
+	"selfupdate.blockthrough.com/pkg/tuf"
+)
+
+var now = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// repository publishes metadata the way a release pipeline would
+type repository struct {
+	t     *testing.T
+	key   crypto.PrivateKey
+	files map[string][]byte
+}
+
+func newRepository(t *testing.T, key crypto.PrivateKey) *repository {
+	return &repository{t: t, key: key, files: map[string][]byte{}}
+}
+
+func (r *repository) publish(version int64, expires time.Time, targets map[string]tuf.TargetFile) {
+	r.t.Helper()
+
+	ctx := context.Background()
+
+	targetsData, err := tuf.Sign(ctx, tuf.Targets{
+		Common:  tuf.Common{Type: tuf.RoleTargets, Version: version, Expires: expires},
+		Targets: targets,
+	}, r.key)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+
+	snapshotData, err := tuf.Sign(ctx, tuf.Snapshot{
+		Common: tuf.Common{Type: tuf.RoleSnapshot, Version: version, Expires: expires},
+		Meta:   map[string]tuf.MetaFile{tuf.Filename(tuf.RoleTargets): tuf.NewMetaFile(version, targetsData)},
+	}, r.key)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+
+	timestampData, err := tuf.Sign(ctx, tuf.Timestamp{
+		Common: tuf.Common{Type: tuf.RoleTimestamp, Version: version, Expires: expires},
+		Meta:   map[string]tuf.MetaFile{tuf.Filename(tuf.RoleSnapshot): tuf.NewMetaFile(version, snapshotData)},
+	}, r.key)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+
+	r.files = map[string][]byte{
+		tuf.Filename(tuf.RoleTargets):   targetsData,
+		tuf.Filename(tuf.RoleSnapshot):  snapshotData,
+		tuf.Filename(tuf.RoleTimestamp): timestampData,
+	}
+}
+
+func (r *repository) Fetch(ctx context.Context, name string) ([]byte, error) {
+	data, ok := r.files[name]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+
+	return data, nil
+}
+
+func newClient(t *testing.T, optFns ...tuf.ClientOptFn) (*repository, tuf.Store, func() *tuf.Client, crypto.PublicKey) {
+	publicKey, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := newRepository(t, privateKey)
+	store := tuf.NewMemoryStore()
+
+	return repo, store, func() *tuf.Client {
+		root := tuf.NewRoot(crypto.NewKeyring(publicKey), 1)
+		return tuf.NewClient(root, repo, store, append([]tuf.ClientOptFn{tuf.WithClientClock(func() time.Time { return now })}, optFns...)...)
+	}, publicKey
+}
+
+func TestClientUpdate(t *testing.T) {
+	repo, _, client, _ := newClient(t)
+
+	content := []byte("binary v1.1.0")
+	repo.publish(2, now.Add(time.Hour), map[string]tuf.TargetFile{
+		"app-linux-amd64": tuf.NewTargetFile("v1.1.0", content),
+	})
+
+	c := client()
+
+	targets, err := c.Update(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if targets.Targets["app-linux-amd64"].Custom.Version != "v1.1.0" {
+		t.Fatal("target version is not matched")
+	}
+
+	if err := c.VerifyTarget("app-linux-amd64", content); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.VerifyTarget("app-linux-amd64", []byte("malicious v1.1.0")); !errors.Is(err, tuf.ErrTargetMismatch) {
+		t.Fatalf("expected ErrTargetMismatch but got %v", err)
+	}
+
+	if err := c.VerifyTarget("app-darwin-arm64", content); !errors.Is(err, tuf.ErrTargetNotFound) {
+		t.Fatalf("expected ErrTargetNotFound but got %v", err)
+	}
+}
+
+func TestClientRollback(t *testing.T) {
+	repo, _, client, _ := newClient(t)
+
+	repo.publish(1, now.Add(time.Hour), map[string]tuf.TargetFile{
+		"app": tuf.NewTargetFile("v1.0.0", []byte("v1.0.0")),
+	})
+	oldFiles := repo.files
+
+	repo.publish(2, now.Add(time.Hour), map[string]tuf.TargetFile{
+		"app": tuf.NewTargetFile("v1.1.0", []byte("v1.1.0")),
+	})
+
+	if _, err := client().Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the mirror serves the older, validly signed metadata to a new process
+	repo.files = oldFiles
+
+	_, err := client().Update(context.Background())
+	if !errors.Is(err, tuf.ErrRollback) {
+		t.Fatalf("expected ErrRollback but got %v", err)
+	}
+}
+
+func TestClientExpired(t *testing.T) {
+	repo, _, client, _ := newClient(t)
+
+	repo.publish(1, now.Add(-time.Minute), map[string]tuf.TargetFile{
+		"app": tuf.NewTargetFile("v1.0.0", []byte("v1.0.0")),
+	})
+
+	_, err := client().Update(context.Background())
+	if !errors.Is(err, tuf.ErrExpired) {
+		t.Fatalf("expected ErrExpired but got %v", err)
+	}
+}
+
+func TestClientUntrustedKey(t *testing.T) {
+	repo, store, _, publicKey := newClient(t)
+
+	_, otherPrivateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo.key = otherPrivateKey
+	repo.publish(1, now.Add(time.Hour), map[string]tuf.TargetFile{
+		"app": tuf.NewTargetFile("v1.0.0", []byte("v1.0.0")),
+	})
+
+	c := tuf.NewClient(tuf.NewRoot(crypto.NewKeyring(publicKey), 1), repo, store, tuf.WithClientClock(func() time.Time { return now }))
+
+	_, err = c.Update(context.Background())
+	if !errors.Is(err, tuf.ErrThresholdNotMet) {
+		t.Fatalf("expected ErrThresholdNotMet but got %v", err)
+	}
+
+	if _, err := store.Load(tuf.Filename(tuf.RoleTimestamp)); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal("expected untrusted metadata not to be stored")
+	}
+}
+
+func TestClientSnapshotMismatch(t *testing.T) {
+	repo, _, client, _ := newClient(t)
+
+	repo.publish(1, now.Add(time.Hour), map[string]tuf.TargetFile{
+		"app": tuf.NewTargetFile("v1.0.0", []byte("v1.0.0")),
+	})
+	timestamp := repo.files[tuf.Filename(tuf.RoleTimestamp)]
+
+	repo.publish(2, now.Add(time.Hour), map[string]tuf.TargetFile{
+		"app": tuf.NewTargetFile("v1.1.0", []byte("v1.1.0")),
+	})
+	repo.files[tuf.Filename(tuf.RoleTimestamp)] = timestamp
+
+	_, err := client().Update(context.Background())
+	if !errors.Is(err, tuf.ErrMetaMismatch) {
+		t.Fatalf("expected ErrMetaMismatch but got %v", err)
+	}
+}
+
+func TestClientTargetsMismatch(t *testing.T) {
+	repo, _, client, _ := newClient(t)
+
+	repo.publish(1, now.Add(time.Hour), map[string]tuf.TargetFile{
+		"app": tuf.NewTargetFile("v1.0.0", []byte("v1.0.0")),
+	})
+	snapshot := repo.files[tuf.Filename(tuf.RoleSnapshot)]
+	timestamp := repo.files[tuf.Filename(tuf.RoleTimestamp)]
+
+	// targets.json of the same version, signed by the targets key, but not the
+	// one listed in the snapshot
+	repo.publish(1, now.Add(time.Hour), map[string]tuf.TargetFile{
+		"app": tuf.NewTargetFile("v1.0.0", []byte("malicious v1.0.0")),
+	})
+	repo.files[tuf.Filename(tuf.RoleSnapshot)] = snapshot
+	repo.files[tuf.Filename(tuf.RoleTimestamp)] = timestamp
+
+	_, err := client().Update(context.Background())
+	if !errors.Is(err, tuf.ErrMetaMismatch) {
+		t.Fatalf("expected ErrMetaMismatch but got %v", err)
+	}
+}
+
+func TestClientTargetsWithoutHashes(t *testing.T) {
+	repo, _, client, _ := newClient(t)
+
+	repo.publish(1, now.Add(time.Hour), map[string]tuf.TargetFile{
+		"app": tuf.NewTargetFile("v1.0.0", []byte("v1.0.0")),
+	})
+
+	ctx := context.Background()
+
+	// a snapshot which only has the version of targets.json
+	snapshotData, err := tuf.Sign(ctx, tuf.Snapshot{
+		Common: tuf.Common{Type: tuf.RoleSnapshot, Version: 1, Expires: now.Add(time.Hour)},
+		Meta:   map[string]tuf.MetaFile{tuf.Filename(tuf.RoleTargets): {Version: 1}},
+	}, repo.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timestampData, err := tuf.Sign(ctx, tuf.Timestamp{
+		Common: tuf.Common{Type: tuf.RoleTimestamp, Version: 1, Expires: now.Add(time.Hour)},
+		Meta:   map[string]tuf.MetaFile{tuf.Filename(tuf.RoleSnapshot): tuf.NewMetaFile(1, snapshotData)},
+	}, repo.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo.files[tuf.Filename(tuf.RoleSnapshot)] = snapshotData
+	repo.files[tuf.Filename(tuf.RoleTimestamp)] = timestampData
+
+	_, err = client().Update(ctx)
+	if !errors.Is(err, tuf.ErrMetaMismatch) {
+		t.Fatalf("expected ErrMetaMismatch but got %v", err)
+	}
+}
+
+func TestClientStoredMetadata(t *testing.T) {
+	repo, store, client, _ := newClient(t)
+
+	repo.publish(1, now.Add(time.Hour), map[string]tuf.TargetFile{
+		"app": tuf.NewTargetFile("v1.0.0", []byte("v1.0.0")),
+	})
+	oldFiles := repo.files
+
+	// the trusted metadata expires before the old one
+	repo.publish(2, now.Add(time.Minute), map[string]tuf.TargetFile{
+		"app": tuf.NewTargetFile("v1.1.0", []byte("v1.1.0")),
+	})
+	newFiles := repo.files
+
+	if _, err := client().Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// expired trusted metadata still holds back a rollback
+	repo.files = oldFiles
+	later := tuf.NewClient(tuf.NewRoot(crypto.NewKeyring(repo.key.Public()), 1), repo, store, tuf.WithClientClock(func() time.Time { return now.Add(30 * time.Minute) }))
+
+	_, err := later.Update(context.Background())
+	if !errors.Is(err, tuf.ErrRollback) {
+		t.Fatalf("expected ErrRollback but got %v", err)
+	}
+
+	// corrupt trusted metadata doesn't start over from version zero
+	repo.files = newFiles
+	if err := store.Save(tuf.Filename(tuf.RoleSnapshot), []byte("corrupt")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client().Update(context.Background())
+	if !errors.Is(err, tuf.ErrUntrustedStore) {
+		t.Fatalf("expected ErrUntrustedStore but got %v", err)
+	}
+}
+
+func TestClientHashes(t *testing.T) {
+	content := []byte("binary v1.0.0")
+
+	targets := map[string]tuf.TargetFile{
+		"app": tuf.NewTargetFile("v1.0.0", content, hash.SHA512),
+		"lib": tuf.NewTargetFile("v1.0.0", content, hash.SHA256, hash.SHA512),
+	}
+
+	// sha512 of lib doesn't match, sha256 does
+	targets["lib"].Hashes[hash.SHA512.String()] = "00"
+
+	tests := []struct {
+		name   string
+		hashes []hash.Algorithm
+		target string
+		err    error
+	}{
+		{"allowed hash", []hash.Algorithm{hash.SHA256, hash.SHA512}, "app", nil},
+		{"no allowed hash", []hash.Algorithm{hash.SHA256}, "app", tuf.ErrTargetMismatch},
+		{"one allowed hash mismatch", []hash.Algorithm{hash.SHA256, hash.SHA512}, "lib", tuf.ErrTargetMismatch},
+		{"mismatch not allowed", []hash.Algorithm{hash.SHA256}, "lib", nil},
+	}
+
+	for _, tt := range tests {
+		repo, _, client, _ := newClient(t, tuf.WithClientHashes(tt.hashes...))
+		repo.publish(1, now.Add(time.Hour), targets)
+
+		c := client()
+		if _, err := c.Update(context.Background()); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if err := c.VerifyTarget(tt.target, content); !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v but got %v", tt.name, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+package tuf
+
+type ClientOptFn = clientOptFn
@@ -0,0 +1,199 @@
+package tuf
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"selfupdate.blockthrough.com/pkg/crypto"
+	"selfupdate.blockthrough.com/pkg/hash"
+)
+
+// The metadata is modelled on The Update Framework. Each role is a JSON file
+// with the signed payload and the signatures of the role keys
+//
+//	timestamp.json: the version of snapshot.json and its hash, it expires
+//	                quickly and is re-signed often, so a frozen mirror is noticed
+//	snapshot.json:  the version of targets.json and its hash
+//	targets.json:   the length, hashes and version of every release asset
+//
+// Every role has a version counter which never goes back, that's how clients
+// refuse rollbacks to older metadata.
+const (
+	RoleTimestamp = "timestamp"
+	RoleSnapshot  = "snapshot"
+	RoleTargets   = "targets"
+
+	HashSHA256 = "sha256"
+)
+
+// Filename returns the name of the metadata file of the role, e.g. targets.json
+func Filename(role string) string {
+	return role + ".json"
+}
+
+type Signature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// Envelope is the content of a metadata file. Signed is kept as raw bytes, so
+// the signatures are verified against exactly what was signed.
+type Envelope struct {
+	Signed     json.RawMessage `json:"signed"`
+	Signatures []Signature     `json:"signatures"`
+}
+
+type Common struct {
+	Type    string    `json:"_type"`
+	Version int64     `json:"version"`
+	Expires time.Time `json:"expires"`
+}
+
+type Hashes map[string]string
+
+// MetaFile describes another metadata file, the timestamp role sets the hashes
+// and length of snapshot.json, and the snapshot role those of targets.json
+type MetaFile struct {
+	Version int64  `json:"version"`
+	Length  int64  `json:"length,omitempty"`
+	Hashes  Hashes `json:"hashes,omitempty"`
+}
+
+type Timestamp struct {
+	Common
+	Meta map[string]MetaFile `json:"meta"`
+}
+
+type Snapshot struct {
+	Common
+	Meta map[string]MetaFile `json:"meta"`
+}
+
+type TargetCustom struct {
+	Version string `json:"version"`
+}
+
+type TargetFile struct {
+	Length int64        `json:"length"`
+	Hashes Hashes       `json:"hashes"`
+	Custom TargetCustom `json:"custom"`
+}
+
+type Targets struct {
+	Common
+	Targets map[string]TargetFile `json:"targets"`
+}
+
+// NewMetaFile returns the description of a metadata file with its hashes, by
+// default only SHA-256
+func NewMetaFile(version int64, data []byte, algorithms ...hash.Algorithm) MetaFile {
+	return MetaFile{
+		Version: version,
+		Length:  int64(len(data)),
+		Hashes:  hashes(data, algorithms),
+	}
+}
+
+// NewTargetFile returns the description of a release asset of the given version
+// with its hashes, by default only SHA-256
+func NewTargetFile(version string, data []byte, algorithms ...hash.Algorithm) TargetFile {
+	return TargetFile{
+		Length: int64(len(data)),
+		Hashes: hashes(data, algorithms),
+		Custom: TargetCustom{Version: version},
+	}
+}
+
+// Sign returns the metadata file of the role payload signed by every signer
+func Sign(ctx context.Context, payload any, signers ...crypto.DigestSigner) ([]byte, error) {
+	signed, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256(signed)
+
+	envelope := Envelope{
+		Signed: signed,
+	}
+
+	for _, signer := range signers {
+		sig, err := signer.SignDigest(ctx, digest[:])
+		if err != nil {
+			return nil, err
+		}
+
+		envelope.Signatures = append(envelope.Signatures, Signature{
+			KeyID: signer.Public().ID().String(),
+			Sig:   hex.EncodeToString(sig),
+		})
+	}
+
+	// the envelope is not indented, since indenting would also change the
+	// bytes of the signed payload
+	return json.Marshal(envelope)
+}
+
+// Decode decodes the payload of a metadata file without verifying it. It's
+// meant for publishers which read their own previous metadata, clients must
+// use Client.Update.
+func Decode(data []byte, payload any) error {
+	var envelope Envelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(envelope.Signed, payload)
+}
+
+func hashes(data []byte, algorithms []hash.Algorithm) Hashes {
+	if len(algorithms) == 0 {
+		algorithms = []hash.Algorithm{hash.SHA256}
+	}
+
+	hashes := Hashes{}
+	for _, algorithm := range algorithms {
+		sum, err := algorithm.FromReader(bytes.NewReader(data))
+		if err != nil {
+			continue
+		}
+
+		hashes[algorithm.String()] = hex.EncodeToString(sum)
+	}
+
+	return hashes
+}
+
+// matches checks the length and every listed hash of an allowed algorithm,
+// at least one of which must be listed. Hashes of other algorithms are ignored.
+func matches(expected Hashes, length int64, data []byte, allowed []hash.Algorithm) bool {
+	if length != 0 && length != int64(len(data)) {
+		return false
+	}
+
+	checked := false
+	for _, algorithm := range allowed {
+		sum, ok := expected[algorithm.String()]
+		if !ok {
+			continue
+		}
+
+		actual, err := algorithm.FromReader(bytes.NewReader(data))
+		if err != nil {
+			return false
+		}
+
+		decoded, err := hex.DecodeString(sum)
+		if err != nil || !bytes.Equal(decoded, actual) {
+			return false
+		}
+
+		checked = true
+	}
+
+	return checked
+}
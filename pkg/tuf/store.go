@@ -0,0 +1,74 @@
+package tuf
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"selfupdate.blockthrough.com/pkg/fileutil"
+)
+
+// Store keeps the last trusted metadata of every role on the client. Load
+// returns an error which matches fs.ErrNotExist if there is none yet.
+type Store interface {
+	Load(name string) ([]byte, error)
+	Save(name string, data []byte) error
+}
+
+type fileStore struct {
+	dir string
+}
+
+var _ Store = (*fileStore)(nil)
+
+// NewFileStore keeps the metadata files in dir, which is created if needed
+func NewFileStore(dir string) Store {
+	return &fileStore{dir: dir}
+}
+
+func (s *fileStore) Load(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.dir, name))
+}
+
+func (s *fileStore) Save(name string, data []byte) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+
+	// a crash never leaves a truncated file which would make the client forget
+	// the trusted versions
+	return fileutil.WriteAtomic(filepath.Join(s.dir, name), data, 0644)
+}
+
+type memoryStore struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+var _ Store = (*memoryStore)(nil)
+
+// NewMemoryStore keeps the metadata in memory, it's mostly useful for tests
+func NewMemoryStore() Store {
+	return &memoryStore{files: map[string][]byte{}}
+}
+
+func (s *memoryStore) Load(name string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.files[name]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+
+	return data, nil
+}
+
+func (s *memoryStore) Save(name string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.files[name] = data
+	return nil
+}
@@ -1,85 +1,600 @@
 package selfupdate
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net"
 	"os"
-	"path/filepath"
-	"runtime"
+	"strings"
+	"time"
 
+	"selfupdate.blockthrough.com/pkg/auditlog"
 	"selfupdate.blockthrough.com/pkg/crypto"
-	"selfupdate.blockthrough.com/pkg/executil"
+	"selfupdate.blockthrough.com/pkg/fileutil"
+	"selfupdate.blockthrough.com/pkg/provenance"
+	"selfupdate.blockthrough.com/pkg/sigstore"
+	"selfupdate.blockthrough.com/pkg/tuf"
 )
 
-func Auto(ctx context.Context, owner string, repo string, currentVersion string, filename string, ghToken string, publicKey string) {
-	if currentVersion == "" {
-		return
+type autoOptions struct {
+	assetTemplate   string
+	platform        Platform
+	trustChain      string
+	trustChainPath  string
+	revocationsPath string
+	detached        string
+	minisign        bool
+	threshold       int
+	verifierOptFns  []verifierOptFn
+	tufRoot         *tuf.Root
+	tufStoreDir     string
+	binding         bool
+	sigstoreRoot    *sigstore.TrustedRoot
+	identity        sigstore.Identity
+	provenance      provenance.Verifier
+	policy          provenance.Policy
+	log             *auditlog.Log
+	revocationKeys  *crypto.Keyring
+	healthcheck     bool
+	healthTimeout   time.Duration
+	healthProbes    []HealthProbe
+	handshake       bool
+	runnerOptFns    []runnerOptFn
+	graceful        *gracefulRestart
+	throttle        time.Duration
+	statePath       string
+	async           bool
+	confirm         bool
+	confirmFallback string
+	// readLine reads the answer of a confirmation, it's nil without a terminal
+	readLine func(prompt string) (string, error)
+	// the following are only replaced by tests
+	executable string
+	github     *Github
+	exit       func(err error)
+	background func(fn func())
+}
+
+type gracefulRestart struct {
+	listeners []net.Listener
+	shutdown  func(ctx context.Context) error
+}
+
+type autoOptFn func(opts *autoOptions)
+
+// WithAutoAssetTemplate sets the template used to find the asset of the new
+// version, please refer to AssetTemplate for the available fields. If the asset
+// is a tar, tar.gz or zip archive, the binary is extracted from it.
+func WithAutoAssetTemplate(text string) autoOptFn {
+	return func(opts *autoOptions) {
+		opts.assetTemplate = text
 	}
+}
 
-	currentExecPath, err := executil.CurrentPath()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, fmt.Sprintf("failed to get current executable path: %s", err.Error()))
-		return
+// WithAutoPlatform overrides the platform detected by CurrentPlatform
+func WithAutoPlatform(platform Platform) autoOptFn {
+	return func(opts *autoOptions) {
+		opts.platform = platform
 	}
+}
 
-	actualFilename := filepath.Base(currentExecPath)
-	actualFileExt := filepath.Ext(actualFilename)
-	newFilename := filepath.Join(filepath.Dir(currentExecPath), filename+"-downloaded"+actualFileExt)
+// WithAutoTrustChain downloads the chain file with the given asset name from the
+// new release and trusts the keys it learns from the embedded public keys. The
+// chain is kept next to the executable, and the chain of a release must extend
+// it. Please refer to TrustChain for more info.
+func WithAutoTrustChain(assetName string) autoOptFn {
+	return func(opts *autoOptions) {
+		opts.trustChain = assetName
+	}
+}
 
-	// if the filename is not the same as the current executable, then we are
-	// running the patcher executable, so we simply
-	if actualFilename != filename {
-		// this is a good chance to copy the downloaded file to the original file
-		err = copyFile(filepath.Join(filepath.Dir(currentExecPath), filename+actualFileExt), currentExecPath)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, fmt.Sprintf("failed to copy the downloaded file over original one: %s", err.Error()))
+// WithAutoDetachedSignature expects the asset to be the unmodified binary and its
+// signature to be uploaded as a separate asset with the given suffix, please
+// refer to DefaultDetachedSuffix
+func WithAutoDetachedSignature(suffix string) autoOptFn {
+	return func(opts *autoOptions) {
+		opts.detached = suffix
+	}
+}
+
+// WithAutoMinisign treats the public keys as minisign public keys and verifies
+// the asset with its .minisig signature, please refer to DefaultMinisignSuffix.
+// It can't be combined with the options of the other signatures, e.g.
+// WithAutoBinding or WithAutoVerifier.
+func WithAutoMinisign() autoOptFn {
+	return func(opts *autoOptions) {
+		opts.minisign = true
+		if opts.detached == "" {
+			opts.detached = DefaultMinisignSuffix
+		}
+	}
+}
+
+// WithAutoThreshold expects the asset in a multi-signature envelope and only
+// accepts it if at least threshold of the public keys signed it, please refer
+// to NewThresholdVerifier. The envelope isn't bound, so it can't be combined
+// with WithAutoBinding.
+func WithAutoThreshold(threshold int) autoOptFn {
+	return func(opts *autoOptions) {
+		opts.threshold = threshold
+	}
+}
+
+// WithAutoVerifier sets the options of the verifier of the new version, e.g.
+// WithVerifierHashes, which also apply to the hashes of the TUF metadata
+func WithAutoVerifier(optFns ...verifierOptFn) autoOptFn {
+	return func(opts *autoOptions) {
+		opts.verifierOptFns = append(opts.verifierOptFns, optFns...)
+	}
+}
+
+// WithAutoTUF finds the new version in TUF metadata signed by the keys of root
+// and published in the latest release, instead of trusting the release listing.
+// The last trusted metadata is kept in storeDir, so downgrades and stale
+// metadata are refused. Please refer to NewTUFChecker.
+func WithAutoTUF(root tuf.Root, storeDir string) autoOptFn {
+	return func(opts *autoOptions) {
+		opts.tufRoot = &root
+		opts.tufStoreDir = storeDir
+	}
+}
+
+// WithAutoBinding only accepts signatures bound to the name of the app, the new
+// version and the platform of the asset, e.g. uploaded with 'github upload
+// --bind --name <filename>'. Please refer to NewBindingVerifier.
+func WithAutoBinding() autoOptFn {
+	return func(opts *autoOptions) {
+		opts.binding = true
+	}
+}
+
+// WithAutoSigstore verifies the asset with its sigstore bundle instead of the
+// embedded public keys, which are ignored. The bundle is expected as a separate
+// asset with DefaultSigstoreSuffix, and it's checked offline against root, e.g.
+// sigstore.PublicGoodTrustedRoot(). Please refer to NewSigstoreVerifier. It
+// can't be combined with the options of the other signatures, e.g.
+// WithAutoBinding or WithAutoVerifier.
+func WithAutoSigstore(root *sigstore.TrustedRoot, identity sigstore.Identity) autoOptFn {
+	return func(opts *autoOptions) {
+		opts.sigstoreRoot = root
+		opts.identity = identity
+		if opts.detached == "" {
+			opts.detached = DefaultSigstoreSuffix
+		}
+	}
+}
+
+// WithAutoProvenance downloads the attestations of the asset, uploaded with
+// DefaultProvenanceSuffix, and only installs the new version if one of them is
+// signed, has the asset as its subject and satisfies the policy. Please refer
+// to NewProvenanceVerifier.
+func WithAutoProvenance(verifier provenance.Verifier, policy provenance.Policy) autoOptFn {
+	return func(opts *autoOptions) {
+		opts.provenance = verifier
+		opts.policy = policy
+	}
+}
+
+// WithAutoLog appends every check, download, verification and install to the
+// hash-chained log at path, e.g. for audits of which versions a host ran. The
+// new version appends to the same log, so it should be passed the same path.
+// Please refer to auditlog.Log.
+func WithAutoLog(path string) autoOptFn {
+	return func(opts *autoOptions) {
+		opts.log = auditlog.New(path)
+	}
+}
+
+// WithAutoRevocations downloads the revocation list from the latest release
+// and checks that it's signed by a key of keyring, usually the embedded public
+// keys. Revoked versions, assets and keys are refused, and a client running a
+// revoked version moves to the next good version. Updates fail if the list
+// can't be loaded. Please refer to Revocations.
+func WithAutoRevocations(keyring *crypto.Keyring) autoOptFn {
+	return func(opts *autoOptions) {
+		opts.revocationKeys = keyring
+	}
+}
+
+// WithAutoHealthcheck runs the probes, e.g. InvocationProbe, on the new binary
+// before it replaces the current one. If one of them fails within timeout, the
+// update is rolled back, the current version keeps running and the new version
+// is marked bad on this host, so it isn't retried.
+func WithAutoHealthcheck(timeout time.Duration, probes ...HealthProbe) autoOptFn {
+	return func(opts *autoOptions) {
+		opts.healthcheck = true
+		opts.healthTimeout = timeout
+		opts.healthProbes = append(opts.healthProbes, probes...)
+	}
+}
+
+// WithAutoHealthHandshake requires the relaunched binary to call ConfirmHealthy
+// within the health timeout. If it exits before, whatever its exit code, or
+// doesn't confirm in time, it's killed, the previous binary is restored and
+// runs the command instead, and the new version is marked bad, please refer to
+// WithAutoHealthcheck. Once confirmed, the exit of the new version is the
+// result of the command.
+func WithAutoHealthHandshake() autoOptFn {
+	return func(opts *autoOptions) {
+		opts.healthcheck = true
+		opts.handshake = true
+	}
+}
+
+// WithAutoRunner adds options of relaunching the new version, by default it
+// gets the terminal, WithRunnerBackground undoes that. Please refer to
+// NewProcessRunner.
+func WithAutoRunner(optFns ...runnerOptFn) autoOptFn {
+	return func(opts *autoOptions) {
+		opts.runnerOptFns = append(opts.runnerOptFns, optFns...)
+	}
+}
+
+// WithAutoGracefulRestart hands the listeners over to the new version instead
+// of relaunching it as a command. Once it calls Ready, shutdown drains the
+// connections of this version, which exits. The new version picks the
+// listeners up with Listen. If it isn't ready within the health timeout, the
+// update is rolled back like a failed health check. Please refer to
+// NewGracefulRunner.
+func WithAutoGracefulRestart(listeners []net.Listener, shutdown func(ctx context.Context) error) autoOptFn {
+	return func(opts *autoOptions) {
+		opts.graceful = &gracefulRestart{
+			listeners: listeners,
+			shutdown:  shutdown,
 		}
+	}
+}
+
+// WithAutoThrottle checks for a new version at most once per interval, and
+// backs off after failed checks, so most runs of the app start right away.
+// The time of the last check is kept in the state file, please refer to
+// WithAutoStateFile.
+func WithAutoThrottle(interval time.Duration) autoOptFn {
+	return func(opts *autoOptions) {
+		opts.throttle = interval
+	}
+}
+
+// WithAutoStateFile sets the file where the updater remembers the last check
+// between runs, the default is state.DefaultPath of the filename
+func WithAutoStateFile(path string) autoOptFn {
+	return func(opts *autoOptions) {
+		opts.statePath = path
+	}
+}
+
+// WithAutoAsync checks for and downloads a new version in the background, so
+// Auto returns right away. The new version is verified and probed, and then
+// staged next to the executable, and the next run of the app is relaunched in
+// it. If the app exits before the download is done, it's retried on the next
+// run. The staged version is kept in the state file, please refer to
+// WithAutoStateFile.
+func WithAutoAsync() autoOptFn {
+	return func(opts *autoOptions) {
+		opts.async = true
+	}
+}
+
+// WithAutoConfirm shows the new version and its release notes and asks
+// whether to update, if stdin and stderr are terminals. Otherwise, fallback is
+// the answer, one of ConfirmYes, ConfirmNo and ConfirmSkip, any other one
+// fails with ErrConfirmFallback. Skipped versions are kept in the state file
+// and not offered again, please refer to WithAutoStateFile.
+func WithAutoConfirm(fallback string) autoOptFn {
+	return func(opts *autoOptions) {
+		opts.confirm = true
+		opts.confirmFallback = fallback
+	}
+}
+
+func Auto(ctx context.Context, owner string, repo string, currentVersion string, filename string, ghToken string, publicKey string, optFns ...autoOptFn) {
+	// the new binary may be invoked by InvocationProbe
+	HandleHealthcheck()
+
+	if currentVersion == "" {
 		return
-	} else {
-		// this is the actual executable, this is a good time to remove the
-		// downloaded file, if there is one, that's why we don't care about
-		// the error
-		os.Remove(newFilename)
 	}
 
-	key, err := crypto.ParsePublicKey(publicKey)
+	u, err := NewUpdater(owner, repo, currentVersion, filename, ghToken, publicKey, optFns...)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, fmt.Sprintf("failed to parse public key: %s", err.Error()))
+		fmt.Fprintln(os.Stderr, err.Error())
 		return
 	}
 
-	ghClient := NewGithub(ghToken, owner, repo)
+	// the relaunched new version has nothing to update
+	if u.relaunched {
+		return
+	}
+
+	if u.opts.async {
+		if update, ok := u.staged(); ok {
+			if u.opts.confirm && !u.confirm(update) {
+				return
+			}
 
-	signedFilename := fmt.Sprintf("%s-%s-%s.sign", filename, runtime.GOOS, runtime.GOARCH)
+			err = u.Apply(ctx, update)
+			if err != nil && !errors.Is(err, ErrUnhealthy) {
+				fmt.Fprintln(os.Stderr, err.Error())
+			}
+			return
+		}
+
+		// the download goes on when the caller is done with ctx, e.g. its
+		// command returned, it's only cut short by the process exiting
+		u.opts.background(func() { u.stage(context.WithoutCancel(ctx)) })
+		return
+	}
 
-	newVersion, _, err := ghClient.Check(ctx, signedFilename, currentVersion)
-	if errors.Is(err, ErrNoNewVersion) {
+	update, err := u.Check(ctx)
+	if errors.Is(err, ErrNoNewVersion) || errors.Is(err, ErrThrottled) || errors.Is(err, ErrSkipped) {
+		return
+	} else if errors.Is(err, ErrBadVersion) {
+		fmt.Fprintf(os.Stderr, "skipping new version: %s\n", err)
 		return
 	} else if err != nil {
 		fmt.Fprintln(os.Stderr, fmt.Sprintf("failed to check for new version: %s", err.Error()))
 		return
 	}
 
-	fmt.Fprintf(os.Stderr, "downloading new version (%s)...", newVersion)
+	if u.opts.confirm && !u.confirm(update) {
+		return
+	}
 
-	rc := ghClient.Download(ctx, signedFilename, newVersion)
-	defer rc.Close()
+	fmt.Fprintf(os.Stderr, "downloading new version (%s)...", update.Version)
 
-	err = NewPatcher(newFilename).Patch(context.Background(), NewHashVerifier(key).Verify(ctx, rc))
-	if err != nil {
-		fmt.Fprintln(os.Stderr, fmt.Sprintf("failed to patch: %s\n", err.Error()))
+	if err := u.download(ctx, update); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
 		return
 	}
 
 	fmt.Fprint(os.Stderr, "done\n")
 
+	// a failed probe is rolled back and reported by the rollback
+	if err := u.probe(ctx, update); err != nil {
+		return
+	}
+
 	fmt.Fprintln(os.Stderr, "running new version...")
 
-	err = NewCliRunner(newFilename, os.Args[1:]...).Run(ctx)
-	if err != nil {
+	err = u.Apply(ctx, update)
+	if err != nil && !errors.Is(err, ErrUnhealthy) {
 		fmt.Fprintln(os.Stderr, err.Error())
 	}
+}
+
+// probe runs the health probes on the new binary within the health timeout
+func (opts *autoOptions) probe(ctx context.Context, path string) error {
+	ctx, cancel := context.WithTimeout(ctx, opts.healthTimeout)
+	defer cancel()
+
+	for _, probe := range opts.healthProbes {
+		if err := probe(ctx, path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rollback marks the new version bad, so it isn't retried, and records it
+func (opts *autoOptions) rollback(bad badVersions, currentVersion string, newVersion string, err error) {
+	fmt.Fprintln(os.Stderr, fmt.Sprintf("rolling back to %s: %s", currentVersion, err.Error()))
+
+	if err := bad.add(newVersion); err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Sprintf("failed to mark the new version bad: %s", err.Error()))
+	}
+
+	opts.record(auditlog.Entry{
+		Event:          auditlog.EventRollback,
+		CurrentVersion: currentVersion,
+		NewVersion:     newVersion,
+		Error:          err.Error(),
+	})
+}
+
+// verifier returns the verifier for the new version out of the embedded public
+// keys and the ids of the trusted keys. publicKey may contain several keys
+// separated by commas, so a new key can be trusted by clients before releases
+// are signed with it. Keys revoked by revocations, if any, are not trusted.
+// validate refuses options which the verifier of the new version would
+// ignore, so an update is never verified less than asked for. The verifiers
+// of sigstore and minisign don't use the keys and the hash algorithms of the
+// signatures, and a multi-signature envelope isn't bound.
+func (opts *autoOptions) validate() error {
+	sigstore := opts.sigstoreRoot != nil
+	threshold := opts.threshold > 0
+	trustChain := opts.trustChain != ""
+	verifierOpts := len(opts.verifierOptFns) > 0
+
+	conflicts := []struct {
+		option string
+		other  string
+		set    bool
+	}{
+		{"WithAutoSigstore", "WithAutoMinisign", sigstore && opts.minisign},
+		{"WithAutoSigstore", "WithAutoThreshold", sigstore && threshold},
+		{"WithAutoSigstore", "WithAutoBinding", sigstore && opts.binding},
+		{"WithAutoSigstore", "WithAutoTrustChain", sigstore && trustChain},
+		{"WithAutoSigstore", "WithAutoVerifier", sigstore && verifierOpts},
+		{"WithAutoMinisign", "WithAutoThreshold", opts.minisign && threshold},
+		{"WithAutoMinisign", "WithAutoBinding", opts.minisign && opts.binding},
+		{"WithAutoMinisign", "WithAutoTrustChain", opts.minisign && trustChain},
+		{"WithAutoMinisign", "WithAutoVerifier", opts.minisign && verifierOpts},
+		{"WithAutoThreshold", "WithAutoBinding", threshold && opts.binding},
+	}
+
+	for _, conflict := range conflicts {
+		if conflict.set {
+			return fmt.Errorf("%w: %s and %s", ErrAutoOptions, conflict.option, conflict.other)
+		}
+	}
+
+	return nil
+}
+
+func (opts *autoOptions) verifier(ctx context.Context, downloader Downloader, publicKey string, newVersion string, binding *Binding, revocations *Revocations) (Verifier, []string, error) {
+	if opts.sigstoreRoot != nil {
+		return NewSigstoreVerifier(opts.sigstoreRoot, opts.identity), nil, nil
+	}
+
+	if opts.minisign {
+		var publicKeys []crypto.MinisignPublicKey
+		var keyIDs []string
+		for _, key := range strings.Split(publicKey, ",") {
+			minisignPublicKey, err := crypto.ParseMinisignPublicKey(key)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if revocations != nil && revocations.KeyRevoked(minisignPublicKey.KeyID.String()) {
+				continue
+			}
+
+			publicKeys = append(publicKeys, minisignPublicKey)
+			keyIDs = append(keyIDs, minisignPublicKey.KeyID.String())
+		}
+
+		return NewMinisignVerifier(publicKeys...), keyIDs, nil
+	}
+
+	keyring, err := crypto.ParseKeyring(publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if opts.trustChain != "" {
+		keyring, err = loadTrustChain(ctx, downloader, opts.trustChain, newVersion, keyring, opts.trustChainPath)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if revocations != nil {
+		keyring = revocations.Keyring(keyring)
+	}
+
+	var keyIDs []string
+	for _, key := range keyring.Keys() {
+		keyIDs = append(keyIDs, key.ID().String())
+	}
+
+	if opts.threshold > 0 {
+		return NewThresholdVerifier(keyring, opts.threshold, opts.verifierOptFns...), keyIDs, nil
+	}
+
+	if binding != nil {
+		return NewBindingVerifier(keyring, *binding, opts.verifierOptFns...), keyIDs, nil
+	}
+
+	return NewKeyringVerifier(keyring, opts.verifierOptFns...), keyIDs, nil
+}
+
+// checkRevocations returns the version to update to, its asset and its
+// release notes, skipping a revoked new version. A client running a revoked
+// version is told so, and moves to the successor of its version if there is
+// no good new version.
+func checkRevocations(ctx context.Context, checker AssetChecker, revocations *Revocations, currentVersion string, newVersion string, assetName string, desc string, candidatesFn func(version string) ([]string, error)) (string, string, string, error) {
+	next, err := revocations.next(currentVersion, newVersion)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	if revocation, ok := revocations.Version(currentVersion); ok {
+		fmt.Fprintf(os.Stderr, "current version is revoked: %s, moving to %s\n", revocation, next)
+	}
+
+	if next == newVersion {
+		return newVersion, assetName, desc, nil
+	}
+
+	assetName, desc, err = checker.FindAsset(ctx, next, candidatesFn)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return next, assetName, desc, nil
+}
+
+// loadTrustChain applies the chain learned on previous runs, kept at path, and
+// then the chain of the release, which may only extend it. So a release which
+// leaves out a revocation, or forks the chain, can't trust a revoked key again.
+func loadTrustChain(ctx context.Context, downloader Downloader, assetName string, version string, roots *crypto.Keyring, path string) (*crypto.Keyring, error) {
+	chain := NewTrustChain(roots)
+
+	known, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	if err := chain.Apply(bytes.NewReader(known)); err != nil {
+		return nil, err
+	}
+
+	rc := downloader.Download(ctx, assetName, version)
+	defer rc.Close()
+
+	if err := chain.Apply(rc); err != nil {
+		return nil, err
+	}
+
+	if data := chain.Bytes(); !bytes.Equal(data, known) {
+		if err := fileutil.WriteAtomic(path, data, 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	return chain.Keyring(version), nil
+}
+
+// record appends the entry to the log, if there is one. Failing to write the
+// log doesn't stop the update.
+func (opts *autoOptions) record(entry auditlog.Entry) {
+	if opts.log == nil {
+		return
+	}
+
+	if err := opts.log.Append(entry); err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Sprintf("failed to write update log: %s", err.Error()))
+	}
+}
+
+// recordingReader keeps the SHA-256 of everything read and the first error
+type recordingReader struct {
+	r    io.Reader
+	hash hash.Hash
+	err  error
+}
+
+var _ io.Reader = (*recordingReader)(nil)
+
+func newRecordingReader(r io.Reader) *recordingReader {
+	return &recordingReader{r: r, hash: sha256.New()}
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.hash.Write(p[:n])
+	if err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *recordingReader) digest() string {
+	return "sha256:" + hex.EncodeToString(r.hash.Sum(nil))
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
 
-	os.Exit(0)
+	return err.Error()
 }
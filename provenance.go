@@ -0,0 +1,40 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"selfupdate.blockthrough.com/pkg/provenance"
+)
+
+const (
+	// DefaultProvenanceSuffix is appended to the asset name to get the name of
+	// its provenance attestations, e.g. app-linux-amd64.intoto.jsonl
+	DefaultProvenanceSuffix = ".intoto.jsonl"
+)
+
+// NewProvenanceVerifier verifies the content with verifier first, then checks
+// that one of the attestations is signed, has the content as its subject and
+// satisfies the policy, e.g. it was built by the release workflow from a tag.
+// The content is only returned if both pass, so the Patcher never sees an
+// artifact of an unknown build.
+func NewProvenanceVerifier(verifier Verifier, attestations io.Reader, attestationVerifier provenance.Verifier, policy provenance.Policy) Verifier {
+	return VerifierFunc(func(ctx context.Context, r io.Reader) io.Reader {
+		content, err := io.ReadAll(verifier.Verify(ctx, r))
+		if err != nil {
+			return newErrorReader(err)
+		}
+
+		data, err := io.ReadAll(attestations)
+		if err != nil {
+			return newErrorReader(err)
+		}
+
+		if _, err := provenance.Verify(attestationVerifier, data, content, policy); err != nil {
+			return newErrorReader(err)
+		}
+
+		return bytes.NewReader(content)
+	})
+}
@@ -0,0 +1,73 @@
+package selfupdate_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"selfupdate.blockthrough.com"
+	"selfupdate.blockthrough.com/pkg/crypto"
+	"selfupdate.blockthrough.com/pkg/dsse"
+	"selfupdate.blockthrough.com/pkg/provenance"
+)
+
+func TestProvenanceVerifier(t *testing.T) {
+	publicKey, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := "hello, world"
+
+	statement, err := provenance.NewStatement("app", []byte(content), provenance.Provenance{
+		BuilderID:        "https://github.com/owner/repo/.github/workflows/release.yml@refs/tags/v1.0.0",
+		SourceRepository: "https://github.com/owner/repo",
+		SourceRef:        "refs/tags/v1.0.0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelope, err := dsse.Sign(context.Background(), dsse.PayloadTypeInToto, payload, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attestations, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := crypto.NewKeyring(publicKey)
+
+	tests := []struct {
+		name   string
+		policy provenance.Policy
+		err    error
+	}{
+		{"matching", provenance.Policy{SourceRepository: "https://github.com/owner/repo", SourceRef: provenance.TagRef}, nil},
+		{"other repository", provenance.Policy{SourceRepository: "https://github.com/owner/fork"}, provenance.ErrRepositoryMismatch},
+	}
+
+	for _, tt := range tests {
+		signed := selfupdate.NewHashSigner(privateKey).Sign(context.Background(), strings.NewReader(content))
+
+		verifier := selfupdate.NewProvenanceVerifier(selfupdate.NewKeyringVerifier(keyring), bytes.NewReader(attestations), provenance.NewKeyringVerifier(keyring), tt.policy)
+		verified, err := io.ReadAll(verifier.Verify(context.Background(), signed))
+
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v but got %v", tt.name, tt.err, err)
+		} else if err == nil && string(verified) != content {
+			t.Errorf("%s: content is not matched", tt.name)
+		}
+	}
+}
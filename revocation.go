@@ -0,0 +1,316 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"selfupdate.blockthrough.com/pkg/crypto"
+	"selfupdate.blockthrough.com/pkg/dsse"
+	"selfupdate.blockthrough.com/pkg/fileutil"
+)
+
+const (
+	// DefaultRevocationsAsset is the name of the revocation list, it's
+	// uploaded to the latest release, so it has to be uploaded again with
+	// every new release
+	DefaultRevocationsAsset = "revocations.json"
+
+	// PayloadTypeRevocations is the DSSE payload type of revocation lists
+	PayloadTypeRevocations = "application/vnd.selfupdate.revocations+json"
+)
+
+var (
+	ErrRevoked            = errors.New("release is revoked")
+	ErrRevocationsInvalid = errors.New("revocation list is invalid")
+	ErrRevocationsSigner  = errors.New("revocation list is only signed by revoked keys")
+	ErrRevocationsOlder   = errors.New("revocation list is older than the known one")
+)
+
+// Revocation revokes either a version, an asset by its digest or a key by its
+// id. Releases signed by a revoked key are refused, even the ones released
+// before the revocation.
+type Revocation struct {
+	Version string `json:"version,omitempty"`
+	// Digest is the SHA-256 of the asset content, please refer to RevocationDigest
+	Digest string `json:"digest,omitempty"`
+	KeyID  string `json:"keyId,omitempty"`
+	// Successor is the version clients running the revoked version should
+	// move to, it may be older than the revoked one
+	Successor string    `json:"successor,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Revoked   time.Time `json:"revoked"`
+}
+
+func (r Revocation) String() string {
+	subject := r.Version
+	if r.Digest != "" {
+		subject = r.Digest
+	} else if r.KeyID != "" {
+		subject = "key " + r.KeyID
+	}
+
+	if r.Reason != "" {
+		return subject + " (" + r.Reason + ")"
+	}
+
+	return subject
+}
+
+// Revocations is the list of revoked releases and keys, it's published signed
+// in a DSSE envelope, please refer to SignRevocations. Serial is increased with
+// every list, clients refuse a list older than the one they have seen.
+type Revocations struct {
+	Serial  int64        `json:"serial"`
+	Entries []Revocation `json:"entries"`
+}
+
+// RevocationDigest returns the digest of the content which revocations refer
+// to, e.g. sha256:<hex>. It's the same digest the update log records for the
+// verified content, please refer to WithAutoLog.
+func RevocationDigest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// SignRevocations returns the revocation list in a DSSE envelope signed by
+// every signer
+func SignRevocations(ctx context.Context, revocations Revocations, signers ...crypto.DigestSigner) ([]byte, error) {
+	payload, err := json.Marshal(revocations)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope, err := dsse.Sign(ctx, PayloadTypeRevocations, payload, signers...)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(envelope)
+}
+
+// ParseRevocations reads a revocation list and checks that it's signed by a
+// key of the keyring, usually the embedded public keys, which the list itself
+// doesn't revoke. So a stolen key can't publish a list, even one revoking it.
+func ParseRevocations(data []byte, keyring *crypto.Keyring) (*Revocations, error) {
+	envelope, err := dsse.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if envelope.PayloadType != PayloadTypeRevocations {
+		return nil, ErrRevocationsInvalid
+	}
+
+	// the payload is only trusted once the signature is checked below
+	var revocations Revocations
+	if err := json.Unmarshal(envelope.Payload, &revocations); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRevocationsInvalid, err)
+	}
+
+	if err := envelope.Verify(revocations.Keyring(keyring)); err != nil {
+		if envelope.Verify(keyring) == nil {
+			return nil, ErrRevocationsSigner
+		}
+
+		return nil, err
+	}
+
+	return &revocations, nil
+}
+
+// Version returns the revocation of the version, if it's revoked
+func (r *Revocations) Version(version string) (Revocation, bool) {
+	for _, entry := range r.Entries {
+		if entry.Version != "" && entry.Version == version {
+			return entry, true
+		}
+	}
+
+	return Revocation{}, false
+}
+
+// Content returns the revocation of the digest of content, if it's revoked
+func (r *Revocations) Content(content []byte) (Revocation, bool) {
+	digest := RevocationDigest(content)
+
+	for _, entry := range r.Entries {
+		if entry.Digest != "" && entry.Digest == digest {
+			return entry, true
+		}
+	}
+
+	return Revocation{}, false
+}
+
+// KeyRevoked reports whether the key id, either of crypto.KeyID or
+// crypto.MinisignKeyID, is revoked
+func (r *Revocations) KeyRevoked(keyID string) bool {
+	for _, entry := range r.Entries {
+		if entry.KeyID != "" && entry.KeyID == keyID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Keyring returns the keys of the keyring which are not revoked
+func (r *Revocations) Keyring(keyring *crypto.Keyring) *crypto.Keyring {
+	filtered := crypto.NewKeyring()
+
+	for _, key := range keyring.Keys() {
+		if !r.KeyRevoked(key.ID().String()) {
+			filtered.Add(key)
+		}
+	}
+
+	return filtered
+}
+
+// next returns the version to update to. A revoked new version is skipped, and
+// a client running a revoked version moves to the new version, or the
+// successor of its version if there is no good new version. It returns
+// ErrRevoked if the current version is revoked and there is nothing to move to.
+func (r *Revocations) next(currentVersion string, newVersion string) (string, error) {
+	if _, ok := r.Version(newVersion); ok {
+		newVersion = ""
+	}
+
+	current, revoked := r.Version(currentVersion)
+	if !revoked {
+		if newVersion == "" {
+			return "", ErrNoNewVersion
+		}
+
+		return newVersion, nil
+	}
+
+	if newVersion != "" {
+		return newVersion, nil
+	}
+
+	if _, ok := r.Version(current.Successor); current.Successor != "" && !ok {
+		return current.Successor, nil
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrRevoked, current)
+}
+
+type revocationChecker struct {
+	checker     Checker
+	revocations *Revocations
+}
+
+var _ Checker = (*revocationChecker)(nil)
+
+// NewRevocationChecker never offers a revoked version. If the current version
+// is revoked, it offers the new version, or the successor of the current
+// version if the new version is revoked too.
+func NewRevocationChecker(checker Checker, revocations *Revocations) Checker {
+	return &revocationChecker{
+		checker:     checker,
+		revocations: revocations,
+	}
+}
+
+func (c *revocationChecker) Check(ctx context.Context, filename string, currentVersion string) (newVersion string, desc string, err error) {
+	newVersion, desc, err = c.checker.Check(ctx, filename, currentVersion)
+	if err != nil && !errors.Is(err, ErrNoNewVersion) {
+		return "", "", err
+	}
+
+	next, err := c.revocations.next(currentVersion, newVersion)
+	if err != nil {
+		return "", "", err
+	}
+
+	if next != newVersion {
+		desc = ""
+	}
+
+	return next, desc, nil
+}
+
+// NewRevocationVerifier verifies the content with verifier first, then refuses
+// it if the version or the digest of the content is revoked. Revoked keys
+// should be removed from the keyring of verifier, please refer to
+// Revocations.Keyring.
+func NewRevocationVerifier(verifier Verifier, revocations *Revocations, version string) Verifier {
+	return VerifierFunc(func(ctx context.Context, r io.Reader) io.Reader {
+		if revocation, ok := revocations.Version(version); ok {
+			return newErrorReader(fmt.Errorf("%w: %s", ErrRevoked, revocation))
+		}
+
+		content, err := io.ReadAll(verifier.Verify(ctx, r))
+		if err != nil {
+			return newErrorReader(err)
+		}
+
+		if revocation, ok := revocations.Content(content); ok {
+			return newErrorReader(fmt.Errorf("%w: %s", ErrRevoked, revocation))
+		}
+
+		return bytes.NewReader(content)
+	})
+}
+
+// loadRevocations downloads the revocation list from the latest release. The
+// last accepted list is kept at path, a list older than it is refused and the
+// keys it revokes can't sign a newer one.
+func loadRevocations(ctx context.Context, g *Github, assetName string, keyring *crypto.Keyring, path string) (*Revocations, error) {
+	known := &Revocations{}
+
+	knownData, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	} else if err == nil {
+		known, err = ParseRevocations(knownData, keyring)
+		if err != nil {
+			return nil, fmt.Errorf("known revocation list: %w", err)
+		}
+	}
+
+	latest, err := g.LatestVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rc := g.Download(ctx, assetName, latest)
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	revocations, err := ParseRevocations(data, known.Keyring(keyring))
+	if errors.Is(err, dsse.ErrEnvelopeUnsigned) {
+		if _, signedErr := ParseRevocations(data, keyring); signedErr == nil {
+			return nil, ErrRevocationsSigner
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if revocations.Serial < known.Serial {
+		return nil, fmt.Errorf("%w: %d, known %d", ErrRevocationsOlder, revocations.Serial, known.Serial)
+	}
+
+	if knownData == nil || revocations.Serial > known.Serial {
+		if err := fileutil.WriteAtomic(path, data, 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	return revocations, nil
+}
@@ -0,0 +1,204 @@
+package selfupdate_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"selfupdate.blockthrough.com"
+	"selfupdate.blockthrough.com/pkg/crypto"
+	"selfupdate.blockthrough.com/pkg/dsse"
+)
+
+// latestChecker always offers the same version, like a release listing
+type latestChecker string
+
+func (c latestChecker) Check(ctx context.Context, filename string, currentVersion string) (string, string, error) {
+	if string(c) == currentVersion {
+		return "", "", selfupdate.ErrNoNewVersion
+	}
+
+	return string(c), "release notes", nil
+}
+
+func TestRevocations(t *testing.T) {
+	publicKey, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherPublicKey, _, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	malicious := []byte("malicious content")
+
+	data, err := selfupdate.SignRevocations(context.Background(), selfupdate.Revocations{
+		Entries: []selfupdate.Revocation{
+			{Version: "v1.1.0", Successor: "v1.0.0", Reason: "broken migration"},
+			{Version: "v1.3.0"},
+			{Digest: selfupdate.RevocationDigest(malicious)},
+			{KeyID: otherPublicKey.ID().String(), Reason: "leaked"},
+		},
+	}, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := selfupdate.ParseRevocations(data, crypto.NewKeyring(otherPublicKey)); !errors.Is(err, dsse.ErrEnvelopeUnsigned) {
+		t.Fatalf("expected unsigned revocation list, got %v", err)
+	}
+
+	revocations, err := selfupdate.ParseRevocations(data, crypto.NewKeyring(publicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := revocations.Keyring(crypto.NewKeyring(publicKey, otherPublicKey))
+	if _, ok := keyring.Get(otherPublicKey.ID()); ok || keyring.Len() != 1 {
+		t.Fatal("revoked key is still trusted")
+	}
+
+	checks := []struct {
+		name           string
+		latest         string
+		currentVersion string
+		newVersion     string
+		err            error
+	}{
+		{"good new version", "v1.2.0", "v1.0.0", "v1.2.0", nil},
+		{"revoked new version", "v1.1.0", "v1.0.0", "", selfupdate.ErrNoNewVersion},
+		{"revoked current version", "v1.2.0", "v1.1.0", "v1.2.0", nil},
+		{"revoked current and new version", "v1.1.0", "v1.1.0", "v1.0.0", nil},
+		{"revoked current version without successor", "v1.3.0", "v1.3.0", "", selfupdate.ErrRevoked},
+	}
+
+	for _, tt := range checks {
+		newVersion, _, err := selfupdate.NewRevocationChecker(latestChecker(tt.latest), revocations).Check(context.Background(), "app", tt.currentVersion)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v but got %v", tt.name, tt.err, err)
+		} else if newVersion != tt.newVersion {
+			t.Errorf("%s: expected %q but got %q", tt.name, tt.newVersion, newVersion)
+		}
+	}
+
+	verifies := []struct {
+		name    string
+		version string
+		content []byte
+		err     error
+	}{
+		{"good content", "v1.2.0", []byte("good content"), nil},
+		{"revoked content", "v1.2.0", malicious, selfupdate.ErrRevoked},
+		{"revoked version", "v1.1.0", []byte("good content"), selfupdate.ErrRevoked},
+	}
+
+	for _, tt := range verifies {
+		verifier := selfupdate.NewRevocationVerifier(selfupdate.NewKeyringVerifier(crypto.NewKeyring(publicKey)), revocations, tt.version)
+		signed := selfupdate.NewHashSigner(privateKey).Sign(context.Background(), bytes.NewReader(tt.content))
+
+		content, err := io.ReadAll(verifier.Verify(context.Background(), signed))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v but got %v", tt.name, tt.err, err)
+		} else if err == nil && !bytes.Equal(content, tt.content) {
+			t.Errorf("%s: content is modified", tt.name)
+		}
+	}
+}
+
+func TestRevocationsRevokedSigner(t *testing.T) {
+	publicKey, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherPublicKey, otherPrivateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := crypto.NewKeyring(publicKey, otherPublicKey)
+
+	revocations := selfupdate.Revocations{
+		Entries: []selfupdate.Revocation{{KeyID: publicKey.ID().String(), Reason: "leaked"}},
+	}
+
+	// the leaked key revokes itself, so its list can't be told from the thief's
+	data, err := selfupdate.SignRevocations(context.Background(), revocations, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := selfupdate.ParseRevocations(data, keyring); !errors.Is(err, selfupdate.ErrRevocationsSigner) {
+		t.Fatalf("expected ErrRevocationsSigner but got %v", err)
+	}
+
+	data, err = selfupdate.SignRevocations(context.Background(), revocations, privateKey, otherPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := selfupdate.ParseRevocations(data, keyring); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadRevocations(t *testing.T) {
+	publicKey, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherPublicKey, otherPrivateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := crypto.NewKeyring(publicKey, otherPublicKey)
+
+	sign := func(revocations selfupdate.Revocations, signer crypto.PrivateKey) string {
+		t.Helper()
+
+		data, err := selfupdate.SignRevocations(context.Background(), revocations, signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(data)
+	}
+
+	server := &githubServer{}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	g := selfupdate.NewGithubWithURL(httpServer.URL, "owner", "repo")
+	path := filepath.Join(t.TempDir(), "revocations.json")
+
+	tests := []struct {
+		name string
+		list string
+		err  error
+	}{
+		{"first", sign(selfupdate.Revocations{Serial: 1, Entries: []selfupdate.Revocation{{Version: "v1.1.0"}}}, privateKey), nil},
+		{"revokes a key", sign(selfupdate.Revocations{Serial: 2, Entries: []selfupdate.Revocation{{Version: "v1.1.0"}, {KeyID: otherPublicKey.ID().String()}}}, privateKey), nil},
+		{"older", sign(selfupdate.Revocations{Serial: 1, Entries: []selfupdate.Revocation{{Version: "v1.1.0"}}}, privateKey), selfupdate.ErrRevocationsOlder},
+		{"same again", sign(selfupdate.Revocations{Serial: 2, Entries: []selfupdate.Revocation{{Version: "v1.1.0"}, {KeyID: otherPublicKey.ID().String()}}}, privateKey), nil},
+		{"signed by a key revoked before", sign(selfupdate.Revocations{Serial: 3}, otherPrivateKey), selfupdate.ErrRevocationsSigner},
+		{"newer", sign(selfupdate.Revocations{Serial: 3, Entries: []selfupdate.Revocation{{Version: "v1.2.0"}}}, privateKey), nil},
+	}
+
+	for i, tt := range tests {
+		server.publish(fmt.Sprintf("v1.0.%d", i), map[string]string{selfupdate.DefaultRevocationsAsset: tt.list})
+
+		_, err := selfupdate.LoadRevocations(context.Background(), g, selfupdate.DefaultRevocationsAsset, keyring, path)
+		if !errors.Is(err, tt.err) {
+			t.Fatalf("%s: expected %v but got %v", tt.name, tt.err, err)
+		}
+	}
+}
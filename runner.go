@@ -2,23 +2,170 @@ package selfupdate
 
 import (
 	"context"
+	"errors"
 	"os"
 	"os/exec"
+	"os/signal"
+	"syscall"
 )
 
+// forwardedSignals are passed on to the child while the runner waits for it
+var forwardedSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP}
+
+type runnerOptions struct {
+	tty bool
+	env []string
+}
+
+type runnerOptFn func(opts *runnerOptions)
+
+// WithRunnerTTY makes the child the foreground process group of the terminal,
+// so it can read from it and gets Ctrl-C directly. It's ignored if stdin is not
+// a terminal or the runner itself is in the background.
+func WithRunnerTTY() runnerOptFn {
+	return func(opts *runnerOptions) {
+		opts.tty = true
+	}
+}
+
+// WithRunnerBackground undoes WithRunnerTTY, the child runs in the background
+// of the terminal. Since reading from it would stop the child, its stdin is
+// not the terminal then.
+func WithRunnerBackground() runnerOptFn {
+	return func(opts *runnerOptions) {
+		opts.tty = false
+	}
+}
+
+// WithRunnerEnv adds environment variables, in the key=value form, to the ones
+// the child inherits
+func WithRunnerEnv(env ...string) runnerOptFn {
+	return func(opts *runnerOptions) {
+		opts.env = append(opts.env, env...)
+	}
+}
+
 // NewCliRunner rerun the an executable with the same arguments.
 // it requires the first argument to be the path to the executable.
+// The executable gets the terminal, please refer to WithRunnerTTY.
 func NewCliRunner(path string, args ...string) Runner {
+	return NewProcessRunner(path, args, WithRunnerTTY())
+}
+
+// NewProcessRunner runs the executable in its own process group and forwards
+// SIGINT, SIGTERM and SIGHUP to the group until it exits. Without WithRunnerTTY
+// the group is in the background, so the child doesn't read from a terminal.
+// The error of Run is an *exec.ExitError if the child failed, please refer to
+// ExitCode.
+func NewProcessRunner(path string, args []string, optFns ...runnerOptFn) Runner {
+	opts := &runnerOptions{}
+	for _, optFn := range optFns {
+		optFn(opts)
+	}
+
 	return RunnerFunc(func(ctx context.Context) error {
-		cmd := exec.Command(path, args...)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		err := cmd.Start()
+		p, err := startProcess(path, args, opts)
 		if err != nil {
 			return err
 		}
 
-		return cmd.Wait()
+		return p.wait()
 	})
 }
+
+// ExitCode returns the exit code for the error of a Runner: 0 if it's nil, the
+// exit code of the child, 128 plus the signal number if the child was killed
+// by a signal, like shells report it, or 1 for any other error
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return 1
+	}
+
+	if sig, ok := exitSignal(exitErr.ProcessState); ok {
+		return 128 + int(sig)
+	}
+
+	return exitErr.ExitCode()
+}
+
+// exitLike exits the same way the child did, it's killed by the same signal if
+// the child was
+func exitLike(err error) {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if sig, ok := exitSignal(exitErr.ProcessState); ok {
+			raise(sig)
+		}
+	}
+
+	os.Exit(ExitCode(err))
+}
+
+// process is a started child whose signals are forwarded
+type process struct {
+	cmd  *exec.Cmd
+	done chan struct{}
+	err  error
+}
+
+func startProcess(path string, args []string, opts *runnerOptions) (*process, error) {
+	cmd := exec.Command(path, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+	cmd.Env = append(os.Environ(), opts.env...)
+
+	restore := setProcessGroup(cmd, opts.tty)
+
+	// signals are caught before the child starts, so none of them kills the
+	// runner and leaves the child behind
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+
+	if err := cmd.Start(); err != nil {
+		signal.Stop(signals)
+		restore()
+		return nil, err
+	}
+
+	p := &process{
+		cmd:  cmd,
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		p.err = cmd.Wait()
+		signal.Stop(signals)
+		restore()
+		close(p.done)
+	}()
+
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				forwardSignal(cmd.Process, sig)
+			case <-p.done:
+				return
+			}
+		}
+	}()
+
+	return p, nil
+}
+
+func (p *process) wait() error {
+	<-p.done
+	return p.err
+}
+
+// kill kills the child and waits for it
+func (p *process) kill() {
+	killProcess(p.cmd.Process)
+	<-p.done
+}
@@ -0,0 +1,76 @@
+//go:build linux
+
+package selfupdate_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"selfupdate.blockthrough.com"
+)
+
+// openTerminal returns a new pseudo terminal, which is not the controlling
+// terminal of the test, and its master side
+func openTerminal(t *testing.T) (pts *os.File, ptmx *os.File) {
+	t.Helper()
+
+	ptmx, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("no pseudo terminal: %v", err)
+	}
+	t.Cleanup(func() { ptmx.Close() })
+
+	if err := unix.IoctlSetPointerInt(int(ptmx.Fd()), unix.TIOCSPTLCK, 0); err != nil {
+		t.Skipf("no pseudo terminal: %v", err)
+	}
+
+	n, err := unix.IoctlGetInt(int(ptmx.Fd()), unix.TIOCGPTN)
+	if err != nil {
+		t.Skipf("no pseudo terminal: %v", err)
+	}
+
+	pts, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("no pseudo terminal: %v", err)
+	}
+	t.Cleanup(func() { pts.Close() })
+
+	return pts, ptmx
+}
+
+func TestProcessRunnerBackgroundTerminal(t *testing.T) {
+	pts, ptmx := openTerminal(t)
+
+	stdin := os.Stdin
+	os.Stdin = pts
+	t.Cleanup(func() { os.Stdin = stdin })
+
+	path := filepath.Join(t.TempDir(), "app")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\nread line && exit 1\nexit 0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- selfupdate.NewProcessRunner(path, nil).Run(context.Background())
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected the child not to read from the terminal, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		// unblock the child, which waits for the terminal
+		ptmx.Write([]byte("line\n"))
+		<-done
+		t.Fatal("child in the background reads from the terminal")
+	}
+}
@@ -0,0 +1,86 @@
+//go:build !windows
+
+package selfupdate
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// setProcessGroup starts the child in its own process group, which is made the
+// foreground group of the terminal if tty is set. Otherwise, the child doesn't
+// get the terminal as stdin, where a read would stop it with SIGTTIN. The
+// returned func gives the terminal back to the runner.
+func setProcessGroup(cmd *exec.Cmd, tty bool) (restore func()) {
+	if tty && isForeground() {
+		// Ctty is the descriptor of the terminal in the child, which is stdin
+		cmd.SysProcAttr = &syscall.SysProcAttr{Foreground: true, Ctty: 0}
+		return reclaimForeground
+	}
+
+	if cmd.Stdin == os.Stdin && term.IsTerminal(int(os.Stdin.Fd())) {
+		cmd.Stdin = nil
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return func() {}
+}
+
+// isForeground reports whether stdin is a terminal and the runner is in its
+// foreground process group
+func isForeground() bool {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return false
+	}
+
+	pgrp, err := unix.IoctlGetInt(fd, unix.TIOCGPGRP)
+	return err == nil && pgrp == unix.Getpgrp()
+}
+
+// reclaimForeground makes the process group of the runner the foreground group
+// of the terminal again. A background group which does so gets SIGTTOU, so it's
+// ignored meanwhile.
+func reclaimForeground() {
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+
+	unix.IoctlSetPointerInt(int(os.Stdin.Fd()), unix.TIOCSPGRP, unix.Getpgrp())
+}
+
+// forwardSignal sends the signal to the process group of the child, so its own
+// children get it too
+func forwardSignal(p *os.Process, sig os.Signal) {
+	if s, ok := sig.(syscall.Signal); ok {
+		unix.Kill(-p.Pid, s)
+	}
+}
+
+func killProcess(p *os.Process) {
+	unix.Kill(-p.Pid, unix.SIGKILL)
+}
+
+func exitSignal(state *os.ProcessState) (syscall.Signal, bool) {
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return 0, false
+	}
+
+	return status.Signal(), true
+}
+
+// raise kills the runner with the signal, using its default action
+func raise(sig syscall.Signal) {
+	signal.Reset(sig)
+	unix.Kill(os.Getpid(), sig)
+
+	// the signal may be delivered asynchronously, or its default action is
+	// not to terminate, e.g. SIGCHLD
+	time.Sleep(100 * time.Millisecond)
+}
@@ -0,0 +1,57 @@
+//go:build !windows
+
+package selfupdate_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"selfupdate.blockthrough.com"
+)
+
+func TestCliRunner(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name   string
+		script string
+		signal syscall.Signal
+		code   int
+	}{
+		{"success", `exit 0`, 0, 0},
+		{"exit code", `exit 3`, 0, 3},
+		{"killed by signal", `kill -KILL $$`, 0, 128 + int(syscall.SIGKILL)},
+		{"forwarded sigterm", `trap 'exit 42' TERM; touch ready; while true; do sleep 0.1; done`, syscall.SIGTERM, 42},
+		{"forwarded sighup", `trap 'exit 43' HUP; touch ready; while true; do sleep 0.1; done`, syscall.SIGHUP, 43},
+	}
+
+	for i, tt := range tests {
+		path := filepath.Join(dir, string(rune('a'+i)))
+		if err := os.WriteFile(path, []byte("#!/bin/sh\ncd "+dir+"\n"+tt.script+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		ready := filepath.Join(dir, "ready")
+		os.Remove(ready)
+
+		if tt.signal != 0 {
+			go func() {
+				for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+					if _, err := os.Stat(ready); err == nil {
+						syscall.Kill(os.Getpid(), tt.signal)
+						return
+					}
+				}
+			}()
+		}
+
+		err := selfupdate.NewCliRunner(path).Run(context.Background())
+		if code := selfupdate.ExitCode(err); code != tt.code {
+			t.Errorf("%s: expected exit code %d but got %d (%v)", tt.name, tt.code, code, err)
+		}
+	}
+}
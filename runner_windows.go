@@ -0,0 +1,33 @@
+//go:build windows
+
+package selfupdate
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup keeps the child in the console of the runner, so it gets
+// Ctrl-C and the other console events itself
+func setProcessGroup(cmd *exec.Cmd, tty bool) (restore func()) {
+	return func() {}
+}
+
+// forwardSignal only terminates the child, interrupts reach it through the
+// shared console
+func forwardSignal(p *os.Process, sig os.Signal) {
+	if sig == syscall.SIGTERM {
+		p.Kill()
+	}
+}
+
+func killProcess(p *os.Process) {
+	p.Kill()
+}
+
+func exitSignal(state *os.ProcessState) (syscall.Signal, bool) {
+	return 0, false
+}
+
+func raise(sig syscall.Signal) {}
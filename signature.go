@@ -0,0 +1,225 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"selfupdate.blockthrough.com/pkg/crypto"
+	"selfupdate.blockthrough.com/pkg/hash"
+)
+
+// A signature is prepended to the signed content in one of the following formats
+//
+//	legacy: | signed hash (96 bytes) | content |
+//	v1:     | "SUSG" | 0x01 | key id (8 bytes) | signed hash (96 bytes) | content |
+//	v2:     | "SUSG" | 0x02 | key id (8 bytes) | payload length (2 bytes) | payload | signature (64 bytes) | content |
+//	v3:     | "SUSG" | 0x03 | hash algorithm (1 byte) | key id (8 bytes) | signed hash (64 + hash size bytes) | content |
+//
+// the signed hash is the NaCl signature of the SHA-256 of the content. The legacy
+// format carries no key id, so it has to be verified against every trusted key.
+// In v2, the signature covers the SHA-256 of a JSON payload, which binds the hash
+// of the content to the app, version and platform it was released for, please
+// refer to Binding. v3 is v1 with the digest algorithm of the content named in
+// the header, please refer to hash.Algorithm. v2 names it in the payload.
+// SHA-256 signatures are still written as legacy, v1 or v2, so clients which
+// don't know about v3 keep working until another algorithm is used.
+const (
+	signatureMagic    = "SUSG"
+	signatureVersion1 = 0x01
+	signatureVersion2 = 0x02
+	signatureVersion3 = 0x03
+
+	signedHashSize        = hash.HashSize + crypto.Overhead
+	signatureV1HeaderSize = len(signatureMagic) + 1 + crypto.KeyIDSize
+	signatureV2HeaderSize = signatureV1HeaderSize + 2
+	signatureV3HeaderSize = signatureV1HeaderSize + 1
+	signaturePayloadLimit = 1<<16 - 1
+)
+
+// signedPayload is the JSON payload of a v2 signature. Timestamps are unix
+// seconds, Expires is zero if the signature never expires.
+type signedPayload struct {
+	Hash      string `json:"hash"`
+	Alg       string `json:"alg,omitempty"`
+	App       string `json:"app,omitempty"`
+	Version   string `json:"version,omitempty"`
+	OS        string `json:"os,omitempty"`
+	Arch      string `json:"arch,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+	Expires   int64  `json:"expires,omitempty"`
+}
+
+type signature struct {
+	version byte
+	// algorithm is the digest algorithm of the content, zero means SHA-256
+	algorithm  hash.Algorithm
+	keyID      crypto.KeyID
+	signedHash []byte
+	// payload is the raw JSON payload of v2 signatures, the signed hash is the
+	// signature of its SHA-256 followed by the SHA-256 itself
+	payload []byte
+}
+
+func (s *signature) Bytes() []byte {
+	if s.version == 0 {
+		return s.signedHash
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString(signatureMagic)
+	buffer.WriteByte(s.version)
+	if s.version == signatureVersion3 {
+		buffer.WriteByte(byte(s.algorithm))
+	}
+	buffer.Write(s.keyID[:])
+
+	if s.version == signatureVersion2 {
+		buffer.WriteByte(byte(len(s.payload) >> 8))
+		buffer.WriteByte(byte(len(s.payload)))
+		buffer.Write(s.payload)
+		buffer.Write(s.signedHash[:crypto.SignatureSize])
+		return buffer.Bytes()
+	}
+
+	buffer.Write(s.signedHash)
+
+	return buffer.Bytes()
+}
+
+// hashAlgorithm returns the digest algorithm of the content
+func (s *signature) hashAlgorithm() (hash.Algorithm, error) {
+	if s.version == signatureVersion2 {
+		payload, err := s.decodePayload()
+		if err != nil {
+			return 0, err
+		}
+
+		if payload.Alg != "" {
+			return hash.Lookup(payload.Alg)
+		}
+	}
+
+	if s.algorithm == 0 {
+		return hash.SHA256, nil
+	}
+
+	return s.algorithm, nil
+}
+
+// decodePayload returns the payload of a v2 signature
+func (s *signature) decodePayload() (*signedPayload, error) {
+	var payload signedPayload
+	if err := json.Unmarshal(s.payload, &payload); err != nil {
+		return nil, err
+	}
+
+	return &payload, nil
+}
+
+// decodeSignatures returns every way the beginning of data can be read as a
+// signature, paired with the rest of the data as content. A legacy signature may
+// start with the magic bytes by accident, that's why it is always returned last.
+func decodeSignatures(data []byte) (sigs []signature, contents [][]byte) {
+	if len(data) >= signatureV3HeaderSize &&
+		bytes.HasPrefix(data, []byte(signatureMagic)) &&
+		data[len(signatureMagic)] == signatureVersion3 {
+
+		algorithm := hash.Algorithm(data[len(signatureMagic)+1])
+		end := signatureV3HeaderSize + crypto.Overhead + algorithm.Size()
+
+		// signatures of unknown algorithms can't be verified anyway
+		if algorithm.Available() && len(data) >= end {
+			sig := signature{
+				version:    signatureVersion3,
+				algorithm:  algorithm,
+				signedHash: data[signatureV3HeaderSize:end],
+			}
+			copy(sig.keyID[:], data[len(signatureMagic)+2:])
+
+			sigs = append(sigs, sig)
+			contents = append(contents, data[end:])
+		}
+	}
+
+	if len(data) >= signatureV2HeaderSize &&
+		bytes.HasPrefix(data, []byte(signatureMagic)) &&
+		data[len(signatureMagic)] == signatureVersion2 {
+
+		payloadSize := int(data[signatureV1HeaderSize])<<8 | int(data[signatureV1HeaderSize+1])
+		end := signatureV2HeaderSize + payloadSize + crypto.SignatureSize
+
+		if len(data) >= end {
+			payload := data[signatureV2HeaderSize : signatureV2HeaderSize+payloadSize]
+			payloadHash := sha256.Sum256(payload)
+
+			sig := signature{
+				version:    signatureVersion2,
+				payload:    payload,
+				signedHash: append(append([]byte{}, data[end-crypto.SignatureSize:end]...), payloadHash[:]...),
+			}
+			copy(sig.keyID[:], data[len(signatureMagic)+1:])
+
+			sigs = append(sigs, sig)
+			contents = append(contents, data[end:])
+		}
+	}
+
+	if len(data) >= signatureV1HeaderSize+signedHashSize &&
+		bytes.HasPrefix(data, []byte(signatureMagic)) &&
+		data[len(signatureMagic)] == signatureVersion1 {
+
+		sig := signature{
+			version:    signatureVersion1,
+			signedHash: data[signatureV1HeaderSize : signatureV1HeaderSize+signedHashSize],
+		}
+		copy(sig.keyID[:], data[len(signatureMagic)+1:])
+
+		sigs = append(sigs, sig)
+		contents = append(contents, data[signatureV1HeaderSize+signedHashSize:])
+	}
+
+	if len(data) >= signedHashSize {
+		sigs = append(sigs, signature{signedHash: data[:signedHashSize]})
+		contents = append(contents, data[signedHashSize:])
+	}
+
+	return
+}
+
+// verify checks the signature against the content with the matching key in
+// the keyring, or with every key if the signature has no key id
+func (s *signature) verify(keyring *crypto.Keyring, content []byte) bool {
+	algorithm, err := s.hashAlgorithm()
+	if err != nil {
+		return false
+	}
+
+	contentHash, err := algorithm.FromReader(bytes.NewReader(content))
+	if err != nil {
+		return false
+	}
+
+	if s.version == signatureVersion2 {
+		payload, err := s.decodePayload()
+		if err != nil || payload.Hash != hex.EncodeToString(contentHash) {
+			return false
+		}
+	} else if !bytes.Equal(contentHash, s.signedHash[crypto.Overhead:]) {
+		return false
+	}
+
+	if s.version != 0 {
+		key, ok := keyring.Get(s.keyID)
+		return ok && key.Verify(s.signedHash)
+	}
+
+	for _, key := range keyring.Keys() {
+		if key.Verify(s.signedHash) {
+			return true
+		}
+	}
+
+	return false
+}
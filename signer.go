@@ -3,24 +3,150 @@ package selfupdate
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"io"
+	"time"
 
 	"selfupdate.blockthrough.com/pkg/crypto"
 	"selfupdate.blockthrough.com/pkg/hash"
 )
 
-func NewHashSigner(privateKey crypto.PrivateKey) Signer {
+type signerOptions struct {
+	withKeyID bool
+	detached  bool
+	binding   *Binding
+	expiry    time.Duration
+	hash      hash.Algorithm
+}
+
+type signerOptFn func(opts *signerOptions)
+
+// WithSignerKeyID prepends a versioned header with the key id of the private key
+// to the signature, so it can be verified by a keyring of several trusted keys.
+// Clients older than the keyring support can't read this format.
+func WithSignerKeyID() signerOptFn {
+	return func(opts *signerOptions) {
+		opts.withKeyID = true
+	}
+}
+
+// WithSignerDetached makes the signer return only the signature, without the
+// content, so it can be stored next to the unmodified binary
+func WithSignerDetached() signerOptFn {
+	return func(opts *signerOptions) {
+		opts.detached = true
+	}
+}
+
+// WithSignerHash sets the digest algorithm of the content, SHA-256 by default.
+// Other algorithms name the algorithm in the signature header, which clients
+// older than the hash agility support can't read.
+func WithSignerHash(algorithm hash.Algorithm) signerOptFn {
+	return func(opts *signerOptions) {
+		opts.hash = algorithm
+	}
+}
+
+func NewHashSigner(privateKey crypto.PrivateKey, optFns ...signerOptFn) Signer {
+	return NewDigestSigner(privateKey, optFns...)
+}
+
+// NewDigestSigner is like NewHashSigner, but only the SHA-256 digest of the
+// content is passed to the signer, so the private key can live outside of this
+// process, e.g. in a KMS or behind crypto.NewCommandSigner.
+func NewDigestSigner(signer crypto.DigestSigner, optFns ...signerOptFn) Signer {
+	opts := &signerOptions{
+		hash: hash.SHA256,
+	}
+
+	for _, optFn := range optFns {
+		optFn(opts)
+	}
+
 	return SignerFunc(func(ctx context.Context, r io.Reader) io.Reader {
 		var buffer bytes.Buffer
 
-		hash, err := hash.FromReader(io.TeeReader(r, &buffer))
+		contentHash, err := opts.hash.FromReader(io.TeeReader(r, &buffer))
+		if err != nil {
+			return newErrorReader(err)
+		}
+
+		sig, err := signDigest(ctx, signer, contentHash, opts)
 		if err != nil {
 			return newErrorReader(err)
 		}
 
+		if opts.detached {
+			return bytes.NewReader(sig.Bytes())
+		}
+
 		return io.MultiReader(
-			bytes.NewReader(privateKey.Sign(hash)),
+			bytes.NewReader(sig.Bytes()),
 			&buffer,
 		)
 	})
 }
+
+// signDigest returns the signature of the content hash in the format selected
+// by the options
+func signDigest(ctx context.Context, signer crypto.DigestSigner, contentHash []byte, opts *signerOptions) (*signature, error) {
+	sig := &signature{}
+	digest := contentHash
+
+	if opts.binding != nil {
+		now := time.Now()
+
+		payload := signedPayload{
+			Hash:      hex.EncodeToString(contentHash),
+			App:       opts.binding.App,
+			Version:   opts.binding.Version,
+			OS:        opts.binding.OS,
+			Arch:      opts.binding.Arch,
+			Timestamp: now.Unix(),
+		}
+
+		if opts.expiry > 0 {
+			payload.Expires = now.Add(opts.expiry).Unix()
+		}
+
+		if opts.hash != hash.SHA256 {
+			payload.Alg = opts.hash.String()
+		}
+
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(data) > signaturePayloadLimit {
+			return nil, ErrBindingTooLarge
+		}
+
+		payloadHash := sha256.Sum256(data)
+
+		sig.version = signatureVersion2
+		sig.payload = data
+		digest = payloadHash[:]
+	} else if opts.hash != hash.SHA256 {
+		sig.version = signatureVersion3
+		sig.algorithm = opts.hash
+	} else if opts.withKeyID {
+		sig.version = signatureVersion1
+	}
+
+	signed, err := signer.SignDigest(ctx, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(signed) != crypto.SignatureSize {
+		return nil, crypto.ErrInvalidSignature
+	}
+
+	sig.keyID = signer.Public().ID()
+	sig.signedHash = append(append([]byte{}, signed...), digest...)
+
+	return sig, nil
+}
@@ -2,12 +2,14 @@ package selfupdate_test
 
 import (
 	"context"
+	"errors"
 	"io"
 	"strings"
 	"testing"
 
 	"selfupdate.blockthrough.com"
 	"selfupdate.blockthrough.com/pkg/crypto"
+	"selfupdate.blockthrough.com/pkg/hash"
 )
 
 func TestSignerVerifier(t *testing.T) {
@@ -34,3 +36,115 @@ func TestSignerVerifier(t *testing.T) {
 		t.Fatal("content is not matched")
 	}
 }
+
+func TestKeyringVerifier(t *testing.T) {
+	oldPublicKey, oldPrivateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newPublicKey, newPrivateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, untrustedPrivateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := selfupdate.NewKeyringVerifier(crypto.NewKeyring(oldPublicKey, newPublicKey))
+
+	tests := []struct {
+		name   string
+		signer selfupdate.Signer
+		ok     bool
+	}{
+		{"legacy old key", selfupdate.NewHashSigner(oldPrivateKey), true},
+		{"legacy new key", selfupdate.NewHashSigner(newPrivateKey), true},
+		{"key id new key", selfupdate.NewHashSigner(newPrivateKey, selfupdate.WithSignerKeyID()), true},
+		{"legacy untrusted key", selfupdate.NewHashSigner(untrustedPrivateKey), false},
+		{"key id untrusted key", selfupdate.NewHashSigner(untrustedPrivateKey, selfupdate.WithSignerKeyID()), false},
+	}
+
+	for _, tt := range tests {
+		signed := tt.signer.Sign(context.Background(), strings.NewReader("hello, world"))
+		content, err := io.ReadAll(verifier.Verify(context.Background(), signed))
+
+		if tt.ok && (err != nil || string(content) != "hello, world") {
+			t.Errorf("%s: expected verification to pass, got %v", tt.name, err)
+		} else if !tt.ok && err == nil {
+			t.Errorf("%s: expected verification to fail", tt.name)
+		}
+	}
+}
+
+type failingDigestSigner struct {
+	crypto.PrivateKey
+}
+
+func (f failingDigestSigner) SignDigest(ctx context.Context, digest []byte) ([]byte, error) {
+	return []byte("short"), nil
+}
+
+func TestDigestSigner(t *testing.T) {
+	publicKey, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := selfupdate.NewHashVerifier(publicKey)
+
+	signed := selfupdate.NewDigestSigner(privateKey, selfupdate.WithSignerKeyID()).Sign(context.Background(), strings.NewReader("hello, world"))
+	content, err := io.ReadAll(verifier.Verify(context.Background(), signed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "hello, world" {
+		t.Fatal("content is not matched")
+	}
+
+	signed = selfupdate.NewDigestSigner(failingDigestSigner{privateKey}).Sign(context.Background(), strings.NewReader("hello, world"))
+	_, err = io.ReadAll(signed)
+	if !errors.Is(err, crypto.ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature but got %v", err)
+	}
+}
+
+func TestHashVerifier(t *testing.T) {
+	publicKey, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := crypto.NewKeyring(publicKey)
+	binding := selfupdate.Binding{App: "app"}
+
+	tests := []struct {
+		name     string
+		signer   selfupdate.Signer
+		verifier selfupdate.Verifier
+		err      error
+	}{
+		{"sha512", selfupdate.NewHashSigner(privateKey, selfupdate.WithSignerHash(hash.SHA512)), selfupdate.NewKeyringVerifier(keyring), nil},
+		{"blake2b-256", selfupdate.NewHashSigner(privateKey, selfupdate.WithSignerHash(hash.BLAKE2b256)), selfupdate.NewKeyringVerifier(keyring), nil},
+		{"blake3", selfupdate.NewHashSigner(privateKey, selfupdate.WithSignerHash(hash.BLAKE3)), selfupdate.NewKeyringVerifier(keyring), nil},
+		{"bound blake3", selfupdate.NewHashSigner(privateKey, selfupdate.WithSignerHash(hash.BLAKE3), selfupdate.WithSignerBinding(binding)), selfupdate.NewBindingVerifier(keyring, binding), nil},
+		{"sha256 allowed", selfupdate.NewHashSigner(privateKey), selfupdate.NewKeyringVerifier(keyring, selfupdate.WithVerifierHashes(hash.SHA256)), nil},
+		{"sha512 not allowed", selfupdate.NewHashSigner(privateKey, selfupdate.WithSignerHash(hash.SHA512)), selfupdate.NewKeyringVerifier(keyring, selfupdate.WithVerifierHashes(hash.SHA256)), selfupdate.ErrHashNotAllowed},
+		{"sha256 not allowed", selfupdate.NewHashSigner(privateKey), selfupdate.NewKeyringVerifier(keyring, selfupdate.WithVerifierHashes(hash.BLAKE3)), selfupdate.ErrHashNotAllowed},
+		{"bound sha512 not allowed", selfupdate.NewHashSigner(privateKey, selfupdate.WithSignerHash(hash.SHA512), selfupdate.WithSignerBinding(binding)), selfupdate.NewBindingVerifier(keyring, binding, selfupdate.WithVerifierHashes(hash.SHA256)), selfupdate.ErrHashNotAllowed},
+	}
+
+	for _, tt := range tests {
+		signed := tt.signer.Sign(context.Background(), strings.NewReader("hello, world"))
+		content, err := io.ReadAll(tt.verifier.Verify(context.Background(), signed))
+
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v but got %v", tt.name, tt.err, err)
+		} else if err == nil && string(content) != "hello, world" {
+			t.Errorf("%s: content is not matched", tt.name)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"selfupdate.blockthrough.com/pkg/sigstore"
+)
+
+const (
+	// DefaultSigstoreSuffix is appended to the asset name to get the name of its
+	// sigstore bundle, e.g. 'cosign sign-blob --bundle app-linux-amd64.sigstore'
+	DefaultSigstoreSuffix = ".sigstore"
+)
+
+// NewSigstoreVerifier expects a sigstore bundle followed by the content, which
+// is the layout NewDetachedVerifier and NewDetachedDownloader produce. The bundle
+// is verified offline against the trusted root, and the content is only
+// accepted if it was signed by the identity, e.g. the release workflow of the
+// repository, please refer to sigstore.GitHubActionsIdentity.
+func NewSigstoreVerifier(root *sigstore.TrustedRoot, identity sigstore.Identity) Verifier {
+	return VerifierFunc(func(ctx context.Context, r io.Reader) io.Reader {
+		bundle, rest, err := sigstore.ReadBundle(r)
+		if err != nil {
+			return newErrorReader(err)
+		}
+
+		content, err := io.ReadAll(rest)
+		if err != nil {
+			return newErrorReader(err)
+		}
+
+		if err := root.Verify(bundle, bytes.NewReader(content), identity); err != nil {
+			return newErrorReader(err)
+		}
+
+		return bytes.NewReader(content)
+	})
+}
@@ -0,0 +1,47 @@
+package selfupdate_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"selfupdate.blockthrough.com"
+	"selfupdate.blockthrough.com/pkg/sigstore"
+)
+
+func TestSigstoreVerifier(t *testing.T) {
+	rootData, err := os.ReadFile("pkg/sigstore/testdata/scaffolding.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := sigstore.ParseTrustedRoot(rootData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bundle, err := os.ReadFile("pkg/sigstore/testdata/othername.sigstore.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identity := sigstore.Identity{Issuer: "http://oidc.local:8080", Subject: "foo!oidc.local"}
+
+	// the bundle is checked against the digest of the content, which is not the
+	// one that was signed
+	verifier := selfupdate.NewDetachedVerifier(selfupdate.NewSigstoreVerifier(root, identity), bytes.NewReader(bundle))
+	_, err = io.ReadAll(verifier.Verify(context.Background(), strings.NewReader("hello, world")))
+	if !errors.Is(err, sigstore.ErrDigestMismatch) {
+		t.Fatalf("expected digest mismatch, got %v", err)
+	}
+
+	verifier = selfupdate.NewDetachedVerifier(selfupdate.NewSigstoreVerifier(root, identity), strings.NewReader("{}"))
+	_, err = io.ReadAll(verifier.Verify(context.Background(), strings.NewReader("hello, world")))
+	if !errors.Is(err, sigstore.ErrInvalidBundle) {
+		t.Fatalf("expected invalid bundle, got %v", err)
+	}
+}
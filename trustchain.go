@@ -0,0 +1,266 @@
+package selfupdate
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"selfupdate.blockthrough.com/pkg/crypto"
+	"selfupdate.blockthrough.com/pkg/version"
+)
+
+const (
+	KeyStatementRotate = "rotate"
+	KeyStatementRevoke = "revoke"
+)
+
+var (
+	ErrTrustChainInvalidStatement = errors.New("trust chain has an invalid statement")
+	ErrTrustChainUntrustedSigner  = errors.New("trust chain statement is signed by an untrusted key")
+	ErrTrustChainOutOfOrder       = errors.New("trust chain statement is out of order")
+	ErrTrustChainForked           = errors.New("trust chain does not extend the known chain")
+	ErrTrustChainKnownKey         = errors.New("trust chain statement rotates to a known key")
+)
+
+// KeyStatement is signed by an already trusted key and either trusts a new key
+// for releases starting from Version, or revokes the key with KeyID. Seq is
+// its position in the chain, starting from 1, and Prev is the hash of the
+// previous line, so statements can't be inserted, reordered or left out.
+type KeyStatement struct {
+	Type    string `json:"type"`
+	Key     string `json:"key,omitempty"`
+	KeyID   string `json:"key_id,omitempty"`
+	Version string `json:"version,omitempty"`
+	Seq     int    `json:"seq"`
+	Prev    string `json:"prev,omitempty"`
+}
+
+// TrustChain starts from a set of root keys, usually embedded into the binary,
+// and learns new keys from statements signed by keys it already trusts. Each
+// statement is one line of the chain file in the following format:
+//
+//	<key id of the signer>:<hex of the NaCl signed statement json>
+//
+// Revoking a key revokes the keys it introduced too, except the signer of the
+// revocation, which is usually the successor of the revoked key.
+type TrustChain struct {
+	ids          []crypto.KeyID
+	keys         map[crypto.KeyID]crypto.PublicKey
+	since        map[crypto.KeyID]string
+	revoked      map[crypto.KeyID]bool
+	introducedBy map[crypto.KeyID]crypto.KeyID
+	lines        []string
+}
+
+func NewTrustChain(roots *crypto.Keyring) *TrustChain {
+	c := &TrustChain{
+		keys:         make(map[crypto.KeyID]crypto.PublicKey),
+		since:        make(map[crypto.KeyID]string),
+		revoked:      make(map[crypto.KeyID]bool),
+		introducedBy: make(map[crypto.KeyID]crypto.KeyID),
+	}
+
+	for _, key := range roots.Keys() {
+		c.ids = append(c.ids, key.ID())
+		c.keys[key.ID()] = key
+	}
+
+	return c
+}
+
+// Apply walks the statements of a chain file in order. Every statement must be
+// signed by a key which is trusted and not revoked at that point of the chain,
+// and follow the previous one. Statements which were applied before, e.g. the
+// chain learned on a previous run, must be the same, so the chain only grows.
+func (c *TrustChain) Apply(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+
+	seq := 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		seq++
+
+		if seq <= len(c.lines) {
+			if line != c.lines[seq-1] {
+				return fmt.Errorf("%w: statement %d differs", ErrTrustChainForked, seq)
+			}
+			continue
+		}
+
+		signerID, statement, err := c.open(line)
+		if err != nil {
+			return err
+		}
+
+		if statement.Seq != seq || statement.Prev != c.head() {
+			return fmt.Errorf("%w: statement %d", ErrTrustChainOutOfOrder, seq)
+		}
+
+		if err := c.apply(signerID, statement); err != nil {
+			return err
+		}
+
+		c.lines = append(c.lines, line)
+	}
+
+	return scanner.Err()
+}
+
+// Bytes returns the statements applied so far as a chain file, which can be
+// kept to be applied before the chain of the next release
+func (c *TrustChain) Bytes() []byte {
+	var b strings.Builder
+	for _, line := range c.lines {
+		b.WriteString(line + "\n")
+	}
+
+	return []byte(b.String())
+}
+
+// head returns the hash of the last statement, or empty if there is none
+func (c *TrustChain) head() string {
+	if len(c.lines) == 0 {
+		return ""
+	}
+
+	return keyStatementHash(c.lines[len(c.lines)-1])
+}
+
+func keyStatementHash(line string) string {
+	sum := sha256.Sum256([]byte(line))
+	return hex.EncodeToString(sum[:])
+}
+
+// ChainHead returns the Seq and Prev of the statement which follows the
+// statements of the chain file
+func ChainHead(r io.Reader) (seq int, prev string, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		seq++
+		prev = keyStatementHash(line)
+	}
+
+	return seq + 1, prev, scanner.Err()
+}
+
+// Keyring returns the keys which are trusted to sign the given version
+func (c *TrustChain) Keyring(ver string) *crypto.Keyring {
+	keyring := crypto.NewKeyring()
+
+	for _, id := range c.ids {
+		if c.revoked[id] {
+			continue
+		}
+
+		if since := c.since[id]; since != "" && version.Compare(since, ver) {
+			continue
+		}
+
+		keyring.Add(c.keys[id])
+	}
+
+	return keyring
+}
+
+func (c *TrustChain) open(line string) (crypto.KeyID, *KeyStatement, error) {
+	var id crypto.KeyID
+
+	signerID, signedHex, ok := strings.Cut(line, ":")
+	if !ok {
+		return id, nil, ErrTrustChainInvalidStatement
+	}
+
+	id, err := crypto.ParseKeyID(signerID)
+	if err != nil {
+		return id, nil, ErrTrustChainInvalidStatement
+	}
+
+	signer, ok := c.keys[id]
+	if !ok || c.revoked[id] {
+		return id, nil, fmt.Errorf("%w: %s", ErrTrustChainUntrustedSigner, id)
+	}
+
+	signed, err := hex.DecodeString(signedHex)
+	if err != nil || len(signed) < crypto.Overhead || !signer.Verify(signed) {
+		return id, nil, ErrTrustChainInvalidStatement
+	}
+
+	var statement KeyStatement
+	if err := json.Unmarshal(signed[crypto.Overhead:], &statement); err != nil {
+		return id, nil, ErrTrustChainInvalidStatement
+	}
+
+	return id, &statement, nil
+}
+
+func (c *TrustChain) apply(signerID crypto.KeyID, statement *KeyStatement) error {
+	switch statement.Type {
+	case KeyStatementRotate:
+		key, err := crypto.ParsePublicKey(statement.Key)
+		if err != nil {
+			return ErrTrustChainInvalidStatement
+		}
+
+		// a known key, revoked or not, keeps its place and its since version
+		id := key.ID()
+		if _, ok := c.keys[id]; ok || c.revoked[id] {
+			return fmt.Errorf("%w: %s", ErrTrustChainKnownKey, id)
+		}
+
+		c.ids = append(c.ids, id)
+		c.keys[id] = key
+		c.since[id] = statement.Version
+		c.introducedBy[id] = signerID
+	case KeyStatementRevoke:
+		id, err := crypto.ParseKeyID(statement.KeyID)
+		if err != nil {
+			return ErrTrustChainInvalidStatement
+		}
+
+		c.revoke(id, signerID)
+	default:
+		return ErrTrustChainInvalidStatement
+	}
+
+	return nil
+}
+
+// revoke revokes the key and every key it introduced, directly or not, except
+// the signer of the revocation and the keys it introduced
+func (c *TrustChain) revoke(id crypto.KeyID, signerID crypto.KeyID) {
+	c.revoked[id] = true
+
+	for _, introduced := range c.ids {
+		if introduced != signerID && c.introducedBy[introduced] == id && !c.revoked[introduced] {
+			c.revoke(introduced, signerID)
+		}
+	}
+}
+
+// SignKeyStatement signs a statement with the private key and returns a line
+// which can be appended to a chain file, Seq and Prev are usually set from
+// ChainHead of the file
+func SignKeyStatement(privateKey crypto.PrivateKey, statement KeyStatement) (string, error) {
+	data, err := json.Marshal(statement)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s:%s", privateKey.Public().ID(), hex.EncodeToString(privateKey.Sign(data))), nil
+}
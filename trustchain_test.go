@@ -0,0 +1,225 @@
+package selfupdate_test
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"selfupdate.blockthrough.com"
+	"selfupdate.blockthrough.com/pkg/crypto"
+)
+
+// chainBuilder signs statements as the next ones of a chain file
+type chainBuilder struct {
+	t     *testing.T
+	lines []string
+}
+
+func (b *chainBuilder) add(privateKey crypto.PrivateKey, statement selfupdate.KeyStatement) string {
+	b.t.Helper()
+
+	var err error
+	statement.Seq, statement.Prev, err = selfupdate.ChainHead(strings.NewReader(b.String()))
+	if err != nil {
+		b.t.Fatal(err)
+	}
+
+	line, err := selfupdate.SignKeyStatement(privateKey, statement)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+
+	b.lines = append(b.lines, line)
+	return line
+}
+
+func (b *chainBuilder) String() string {
+	return strings.Join(b.lines, "\n")
+}
+
+func generateKeys(t *testing.T) (crypto.PublicKey, crypto.PrivateKey) {
+	t.Helper()
+
+	publicKey, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return publicKey, privateKey
+}
+
+func TestTrustChain(t *testing.T) {
+	rootPublicKey, rootPrivateKey := generateKeys(t)
+	newPublicKey, newPrivateKey := generateKeys(t)
+
+	chain := &chainBuilder{t: t}
+	chain.add(rootPrivateKey, selfupdate.KeyStatement{
+		Type:    selfupdate.KeyStatementRotate,
+		Key:     newPublicKey.String(),
+		Version: "v1.2.0",
+	})
+	chain.add(newPrivateKey, selfupdate.KeyStatement{
+		Type:  selfupdate.KeyStatementRevoke,
+		KeyID: rootPublicKey.ID().String(),
+	})
+
+	trustChain := selfupdate.NewTrustChain(crypto.NewKeyring(rootPublicKey))
+	if err := trustChain.Apply(strings.NewReader(chain.String() + "\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys := trustChain.Keyring("v1.1.0").Keys(); len(keys) != 0 {
+		t.Fatal("the new key should not be trusted before v1.2.0 and the root key is revoked")
+	}
+
+	if keys := trustChain.Keyring("v1.2.0").Keys(); len(keys) != 1 || keys[0] != newPublicKey {
+		t.Fatal("only the new key should be trusted for v1.2.0")
+	}
+
+	// the root key is revoked, so it can't sign any more statements
+	otherPublicKey, _ := generateKeys(t)
+	chain.add(rootPrivateKey, selfupdate.KeyStatement{
+		Type: selfupdate.KeyStatementRotate,
+		Key:  otherPublicKey.String(),
+	})
+
+	err := trustChain.Apply(strings.NewReader(chain.String()))
+	if !errors.Is(err, selfupdate.ErrTrustChainUntrustedSigner) {
+		t.Fatalf("expected untrusted signer error, got %v", err)
+	}
+}
+
+func TestTrustChainAttacks(t *testing.T) {
+	rootPublicKey, rootPrivateKey := generateKeys(t)
+	newPublicKey, newPrivateKey := generateKeys(t)
+	attackerPublicKey, _ := generateKeys(t)
+
+	rotate := selfupdate.KeyStatement{Type: selfupdate.KeyStatementRotate, Key: newPublicKey.String()}
+	revokeRoot := selfupdate.KeyStatement{Type: selfupdate.KeyStatementRevoke, KeyID: rootPublicKey.ID().String()}
+	rotateAttacker := selfupdate.KeyStatement{Type: selfupdate.KeyStatementRotate, Key: attackerPublicKey.String()}
+
+	// the chain the client learned: the root key trusted a new key, which
+	// revoked the root key after it was compromised
+	legit := &chainBuilder{t: t}
+	legit.add(rootPrivateKey, rotate)
+	legit.add(newPrivateKey, revokeRoot)
+
+	known := selfupdate.NewTrustChain(crypto.NewKeyring(rootPublicKey))
+	if err := known.Apply(strings.NewReader(legit.String())); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		chain func() string
+		err   error
+	}{
+		{
+			"omitted revoke",
+			func() string {
+				return legit.lines[0]
+			},
+			nil,
+		},
+		{
+			"forked after the known chain",
+			func() string {
+				forked := &chainBuilder{t: t, lines: slices.Clone(legit.lines[:1])}
+				forked.add(rootPrivateKey, rotateAttacker)
+				return forked.String()
+			},
+			selfupdate.ErrTrustChainForked,
+		},
+		{
+			"inserted rotate",
+			func() string {
+				inserted := &chainBuilder{t: t, lines: slices.Clone(legit.lines[:1])}
+				inserted.add(rootPrivateKey, rotateAttacker)
+				return inserted.String() + "\n" + legit.lines[1]
+			},
+			selfupdate.ErrTrustChainForked,
+		},
+		{
+			"extended by a revoked key",
+			func() string {
+				extended := &chainBuilder{t: t, lines: slices.Clone(legit.lines)}
+				extended.add(rootPrivateKey, rotateAttacker)
+				return extended.String()
+			},
+			selfupdate.ErrTrustChainUntrustedSigner,
+		},
+	}
+
+	for _, tt := range tests {
+		chain := selfupdate.NewTrustChain(crypto.NewKeyring(rootPublicKey))
+		if err := chain.Apply(strings.NewReader(string(known.Bytes()))); err != nil {
+			t.Fatal(err)
+		}
+
+		err := chain.Apply(strings.NewReader(tt.chain()))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+		}
+
+		for _, key := range chain.Keyring("v1.0.0").Keys() {
+			if key != newPublicKey {
+				t.Errorf("%s: only the new key should be trusted, got %s", tt.name, key.ID())
+			}
+		}
+	}
+
+	// a client which never saw the chain refuses statements out of order
+	inserted := &chainBuilder{t: t, lines: slices.Clone(legit.lines[:1])}
+	inserted.add(rootPrivateKey, rotateAttacker)
+
+	chain := selfupdate.NewTrustChain(crypto.NewKeyring(rootPublicKey))
+	err := chain.Apply(strings.NewReader(inserted.String() + "\n" + legit.lines[1]))
+	if !errors.Is(err, selfupdate.ErrTrustChainOutOfOrder) {
+		t.Fatalf("expected out of order error, got %v", err)
+	}
+}
+
+func TestTrustChainCascade(t *testing.T) {
+	rootPublicKey, rootPrivateKey := generateKeys(t)
+	newPublicKey, newPrivateKey := generateKeys(t)
+	attackerPublicKey, attackerPrivateKey := generateKeys(t)
+	otherPublicKey, _ := generateKeys(t)
+
+	// the compromised root key trusted the attacker's key, which trusted
+	// another one, before the root key was revoked
+	chain := &chainBuilder{t: t}
+	chain.add(rootPrivateKey, selfupdate.KeyStatement{Type: selfupdate.KeyStatementRotate, Key: newPublicKey.String()})
+	chain.add(rootPrivateKey, selfupdate.KeyStatement{Type: selfupdate.KeyStatementRotate, Key: attackerPublicKey.String()})
+	chain.add(attackerPrivateKey, selfupdate.KeyStatement{Type: selfupdate.KeyStatementRotate, Key: otherPublicKey.String()})
+	chain.add(newPrivateKey, selfupdate.KeyStatement{Type: selfupdate.KeyStatementRevoke, KeyID: rootPublicKey.ID().String()})
+
+	trustChain := selfupdate.NewTrustChain(crypto.NewKeyring(rootPublicKey))
+	if err := trustChain.Apply(strings.NewReader(chain.String())); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys := trustChain.Keyring("v1.0.0").Keys(); len(keys) != 1 || keys[0] != newPublicKey {
+		t.Fatalf("only the new key should be trusted, got %d keys", len(keys))
+	}
+}
+
+func TestTrustChainKnownKey(t *testing.T) {
+	rootPublicKey, rootPrivateKey := generateKeys(t)
+	newPublicKey, newPrivateKey := generateKeys(t)
+
+	// the since version of a known key can't be reset
+	chain := &chainBuilder{t: t}
+	chain.add(rootPrivateKey, selfupdate.KeyStatement{Type: selfupdate.KeyStatementRotate, Key: newPublicKey.String(), Version: "v2.0.0"})
+	chain.add(newPrivateKey, selfupdate.KeyStatement{Type: selfupdate.KeyStatementRotate, Key: newPublicKey.String()})
+
+	trustChain := selfupdate.NewTrustChain(crypto.NewKeyring(rootPublicKey))
+	err := trustChain.Apply(strings.NewReader(chain.String()))
+	if !errors.Is(err, selfupdate.ErrTrustChainKnownKey) {
+		t.Fatalf("expected known key error, got %v", err)
+	}
+
+	if keys := trustChain.Keyring("v1.0.0").Keys(); len(keys) != 1 || keys[0] != rootPublicKey {
+		t.Fatal("the new key should still not be trusted before v2.0.0")
+	}
+}
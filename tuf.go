@@ -0,0 +1,136 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/google/go-github/v57/github"
+
+	"selfupdate.blockthrough.com/pkg/tuf"
+	"selfupdate.blockthrough.com/pkg/version"
+)
+
+// NewGithubTUFFetcher fetches the TUF metadata files from the assets of the
+// latest release. The release is resolved once per update, when timestamp.json
+// is fetched, so every file of an update comes from the same release and the
+// releases are not listed again for each file. Please refer to the tuf package
+// for more info.
+func NewGithubTUFFetcher(g *Github) tuf.Fetcher {
+	var mu sync.Mutex
+	var latest *github.RepositoryRelease
+
+	return tuf.FetcherFunc(func(ctx context.Context, name string) ([]byte, error) {
+		mu.Lock()
+		if name == tuf.Filename(tuf.RoleTimestamp) || latest == nil {
+			release, err := g.latestRelease(ctx)
+			if err != nil {
+				mu.Unlock()
+				return nil, err
+			}
+			latest = release
+		}
+		release := latest
+		mu.Unlock()
+
+		rc := g.downloadAsset(ctx, release, name)
+		defer rc.Close()
+
+		return io.ReadAll(rc)
+	})
+}
+
+type tufChecker struct {
+	client *tuf.Client
+}
+
+var _ Checker = (*tufChecker)(nil)
+
+// NewTUFChecker finds the new version in the signed TUF targets metadata
+// instead of the release listing, so a mirror can't roll clients back to an
+// older version, nor freeze them on the current one without being noticed.
+// The version of the asset is read from the custom version of its target.
+func NewTUFChecker(client *tuf.Client) Checker {
+	return &tufChecker{client: client}
+}
+
+func (c *tufChecker) Check(ctx context.Context, filename string, currentVersion string) (newVersion string, desc string, err error) {
+	newVersion, _, err = checkTUFAsset(ctx, c.client, currentVersion, func(version string) ([]string, error) {
+		return []string{filename}, nil
+	})
+	return newVersion, "", err
+}
+
+// checkTUFAsset is like Github.CheckAsset, but the latest version and the
+// assets come from the TUF targets metadata
+func checkTUFAsset(ctx context.Context, client *tuf.Client, currentVersion string, candidatesFn func(version string) ([]string, error)) (newVersion string, filename string, err error) {
+	targets, err := client.Update(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, target := range targets.Targets {
+		if newVersion == "" || version.Compare(target.Custom.Version, newVersion) {
+			newVersion = target.Custom.Version
+		}
+	}
+
+	// an older version is never offered, even if the metadata lists it
+	if newVersion == "" || !version.Compare(newVersion, currentVersion) {
+		return "", "", ErrNoNewVersion
+	}
+
+	candidates, err := candidatesFn(newVersion)
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, candidate := range candidates {
+		target, ok := targets.Targets[candidate]
+		if ok && target.Custom.Version == newVersion {
+			return newVersion, candidate, nil
+		}
+	}
+
+	return "", "", tuf.ErrTargetNotFound
+}
+
+type tufDownloader struct {
+	downloader Downloader
+	client     *tuf.Client
+}
+
+var _ Downloader = (*tufDownloader)(nil)
+
+// NewTUFDownloader checks every downloaded asset which is listed in the TUF
+// targets against its length and hashes. Assets which are not listed, such as
+// detached signatures, are passed through. The client must be updated first,
+// which NewTUFChecker does.
+func NewTUFDownloader(downloader Downloader, client *tuf.Client) Downloader {
+	return &tufDownloader{
+		downloader: downloader,
+		client:     client,
+	}
+}
+
+func (d *tufDownloader) Download(ctx context.Context, name string, version string) io.ReadCloser {
+	rc := d.downloader.Download(ctx, name, version)
+
+	if _, err := d.client.Target(name); errors.Is(err, tuf.ErrTargetNotFound) {
+		return rc
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return newErrorReader(err)
+	}
+
+	if err := d.client.VerifyTarget(name, data); err != nil {
+		return newErrorReader(err)
+	}
+
+	return io.NopCloser(bytes.NewReader(data))
+}
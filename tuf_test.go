@@ -0,0 +1,228 @@
+package selfupdate_test
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"selfupdate.blockthrough.com"
+	"selfupdate.blockthrough.com/pkg/crypto"
+	"selfupdate.blockthrough.com/pkg/tuf"
+)
+
+func newTUFClient(t *testing.T, targets map[string]tuf.TargetFile) *tuf.Client {
+	t.Helper()
+
+	publicKey, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	expires := time.Now().Add(time.Hour)
+
+	targetsData, err := tuf.Sign(ctx, tuf.Targets{
+		Common:  tuf.Common{Type: tuf.RoleTargets, Version: 1, Expires: expires},
+		Targets: targets,
+	}, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshotData, err := tuf.Sign(ctx, tuf.Snapshot{
+		Common: tuf.Common{Type: tuf.RoleSnapshot, Version: 1, Expires: expires},
+		Meta:   map[string]tuf.MetaFile{tuf.Filename(tuf.RoleTargets): tuf.NewMetaFile(1, targetsData)},
+	}, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timestampData, err := tuf.Sign(ctx, tuf.Timestamp{
+		Common: tuf.Common{Type: tuf.RoleTimestamp, Version: 1, Expires: expires},
+		Meta:   map[string]tuf.MetaFile{tuf.Filename(tuf.RoleSnapshot): tuf.NewMetaFile(1, snapshotData)},
+	}, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{
+		tuf.Filename(tuf.RoleTargets):   targetsData,
+		tuf.Filename(tuf.RoleSnapshot):  snapshotData,
+		tuf.Filename(tuf.RoleTimestamp): timestampData,
+	}
+
+	fetcher := tuf.FetcherFunc(func(ctx context.Context, name string) ([]byte, error) {
+		return files[name], nil
+	})
+
+	return tuf.NewClient(tuf.NewRoot(crypto.NewKeyring(publicKey), 1), fetcher, tuf.NewMemoryStore())
+}
+
+func TestTUFChecker(t *testing.T) {
+	content := []byte("binary v1.1.0")
+
+	client := newTUFClient(t, map[string]tuf.TargetFile{
+		"app-linux-amd64": tuf.NewTargetFile("v1.1.0", content),
+	})
+
+	checker := selfupdate.NewTUFChecker(client)
+
+	newVersion, _, err := checker.Check(context.Background(), "app-linux-amd64", "v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if newVersion != "v1.1.0" {
+		t.Fatalf("expected v1.1.0 but got %s", newVersion)
+	}
+
+	_, _, err = checker.Check(context.Background(), "app-linux-amd64", "v1.2.0")
+	if !errors.Is(err, selfupdate.ErrNoNewVersion) {
+		t.Fatalf("expected ErrNoNewVersion for a downgrade but got %v", err)
+	}
+
+	downloader := selfupdate.NewTUFDownloader(memoryDownloader{
+		"v1.1.0/app-linux-amd64": content,
+	}, client)
+
+	data, err := io.ReadAll(downloader.Download(context.Background(), "app-linux-amd64", "v1.1.0"))
+	if err != nil || string(data) != string(content) {
+		t.Fatalf("expected the listed asset to pass, got %v", err)
+	}
+
+	tampered := selfupdate.NewTUFDownloader(memoryDownloader{
+		"v1.1.0/app-linux-amd64": []byte("malicious v1.1.0"),
+	}, client)
+
+	_, err = io.ReadAll(tampered.Download(context.Background(), "app-linux-amd64", "v1.1.0"))
+	if !errors.Is(err, tuf.ErrTargetMismatch) {
+		t.Fatalf("expected ErrTargetMismatch but got %v", err)
+	}
+}
+
+// githubServer serves releases with assets like the GitHub API, and counts how
+// often the releases are listed
+type githubServer struct {
+	mu       sync.Mutex
+	releases []githubRelease
+	assets   []string
+	listed   int
+}
+
+type githubAsset struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type githubRelease struct {
+	TagName string        `json:"tag_name"`
+	Assets  []githubAsset `json:"assets"`
+}
+
+func (s *githubServer) publish(version string, assets map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	release := githubRelease{TagName: version}
+	for name, content := range assets {
+		release.Assets = append(release.Assets, githubAsset{ID: len(s.assets), Name: name})
+		s.assets = append(s.assets, content)
+	}
+	s.releases = append(s.releases, release)
+}
+
+func (s *githubServer) listCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.listed
+}
+
+func (s *githubServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.URL.Path == "/repos/owner/repo/releases" {
+		s.listed++
+		json.NewEncoder(w).Encode(s.releases)
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/repos/owner/repo/releases/assets/"))
+	if err != nil || id >= len(s.assets) {
+		http.NotFound(w, r)
+		return
+	}
+
+	gz := gzip.NewWriter(w)
+	fmt.Fprint(gz, s.assets[id])
+	gz.Close()
+}
+
+func TestGithubTUFFetcher(t *testing.T) {
+	server := &githubServer{}
+	server.publish("v1.0.0", map[string]string{
+		"timestamp.json": "timestamp v1.0.0",
+		"snapshot.json":  "snapshot v1.0.0",
+		"targets.json":   "targets v1.0.0",
+	})
+
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	fetcher := selfupdate.NewGithubTUFFetcher(selfupdate.NewGithubWithURL(httpServer.URL, "owner", "repo"))
+
+	ctx := context.Background()
+
+	fetch := func(name string) string {
+		t.Helper()
+
+		data, err := fetcher.Fetch(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(data)
+	}
+
+	if got := fetch("timestamp.json"); got != "timestamp v1.0.0" {
+		t.Fatalf("expected timestamp v1.0.0 but got %q", got)
+	}
+
+	// a release published in the middle of an update is not mixed into it
+	server.publish("v1.1.0", map[string]string{
+		"timestamp.json": "timestamp v1.1.0",
+		"snapshot.json":  "snapshot v1.1.0",
+		"targets.json":   "targets v1.1.0",
+	})
+
+	if got := fetch("snapshot.json"); got != "snapshot v1.0.0" {
+		t.Fatalf("expected snapshot v1.0.0 but got %q", got)
+	}
+
+	if got := fetch("targets.json"); got != "targets v1.0.0" {
+		t.Fatalf("expected targets v1.0.0 but got %q", got)
+	}
+
+	if listed := server.listCount(); listed != 1 {
+		t.Fatalf("expected the releases to be listed once per update but got %d", listed)
+	}
+
+	if got := fetch("timestamp.json"); got != "timestamp v1.1.0" {
+		t.Fatalf("expected the next update to use v1.1.0 but got %q", got)
+	}
+
+	if listed := server.listCount(); listed != 2 {
+		t.Fatalf("expected the releases to be listed again for the next update but got %d", listed)
+	}
+}
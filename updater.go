@@ -0,0 +1,551 @@
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"selfupdate.blockthrough.com/pkg/auditlog"
+	"selfupdate.blockthrough.com/pkg/executil"
+	"selfupdate.blockthrough.com/pkg/state"
+	"selfupdate.blockthrough.com/pkg/terminal"
+	"selfupdate.blockthrough.com/pkg/tuf"
+	"selfupdate.blockthrough.com/pkg/version"
+)
+
+var (
+	ErrNoCurrentVersion = errors.New("current version is not set")
+	ErrBadVersion       = errors.New("version failed its health check on this host")
+	ErrThrottled        = errors.New("checked for a new version recently")
+	ErrAutoOptions      = errors.New("options can't be combined")
+)
+
+// Updater runs the steps of Auto one by one, so an application can check for
+// and download updates while it's running, and decide itself when to restart,
+// please refer to Watch
+type Updater struct {
+	opts             *autoOptions
+	currentVersion   string
+	filename         string
+	publicKey        string
+	dir              string
+	fileExt          string
+	execPath         string
+	newFilename      string
+	previousFilename string
+	stagedFilename   string
+	bad              badVersions
+	assetTemplate    *AssetTemplate
+	ghClient         *Github
+	state            *state.Store
+	relaunched       bool
+}
+
+// Update is a new version found by Check
+type Update struct {
+	Version string
+	Asset   string
+	// Notes are the release notes in markdown, they are empty with TUF
+	Notes string
+	// path is where the update is downloaded to, the downloaded file of the
+	// updater if it's empty
+	path        string
+	downloader  Downloader
+	revocations *Revocations
+}
+
+// NewUpdater takes the same arguments and options as Auto. If the current
+// process is a relaunched new version, it's copied over the original
+// executable, like Auto does, so NewUpdater should be called at startup.
+func NewUpdater(owner string, repo string, currentVersion string, filename string, ghToken string, publicKey string, optFns ...autoOptFn) (*Updater, error) {
+	if currentVersion == "" {
+		return nil, ErrNoCurrentVersion
+	}
+
+	opts := &autoOptions{
+		assetTemplate: DefaultAssetTemplate,
+		platform:      CurrentPlatform(),
+		// the new version is the same app, which may be interactive
+		runnerOptFns: []runnerOptFn{WithRunnerTTY()},
+		exit:         exitLike,
+		background:   func(fn func()) { go fn() },
+	}
+
+	for _, optFn := range optFns {
+		optFn(opts)
+	}
+
+	// the confirmation is only asked on a terminal
+	if opts.readLine == nil && terminal.IsTerminal(os.Stdin) && terminal.IsTerminal(os.Stderr) {
+		opts.readLine = terminal.ReadLine
+	}
+
+	if opts.healthTimeout <= 0 {
+		opts.healthTimeout = DefaultHealthTimeout
+	}
+
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	if opts.confirm && !slices.Contains([]string{ConfirmYes, ConfirmNo, ConfirmSkip}, opts.confirmFallback) {
+		return nil, fmt.Errorf("%w: %q", ErrConfirmFallback, opts.confirmFallback)
+	}
+
+	// the executable is only set by tests, which keep the files of the updater
+	// in a temporary directory
+	var err error
+	currentExecPath := opts.executable
+	if currentExecPath == "" {
+		currentExecPath, err = executil.CurrentPath()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get current executable path: %w", err)
+		}
+	}
+
+	actualFilename := filepath.Base(currentExecPath)
+	actualFileExt := filepath.Ext(actualFilename)
+	dir := filepath.Dir(currentExecPath)
+
+	u := &Updater{
+		opts:             opts,
+		currentVersion:   currentVersion,
+		filename:         filename,
+		publicKey:        publicKey,
+		dir:              dir,
+		fileExt:          actualFileExt,
+		execPath:         filepath.Join(dir, filename+actualFileExt),
+		newFilename:      filepath.Join(dir, filename+"-downloaded"+actualFileExt),
+		previousFilename: filepath.Join(dir, filename+"-previous"+actualFileExt),
+		stagedFilename:   filepath.Join(dir, filename+"-staged"+actualFileExt),
+		bad:              badVersions{path: filepath.Join(dir, "."+filename+"-bad-versions.json")},
+		ghClient:         NewGithub(ghToken, owner, repo),
+	}
+
+	if opts.github != nil {
+		u.ghClient = opts.github
+	}
+
+	// if the filename is not the same as the current executable, then we are
+	// running the relaunched new version
+	if actualFilename != filename {
+		u.relaunched = true
+
+		// this is a good chance to copy the downloaded file to the original file
+		err = copyFile(u.execPath, currentExecPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("failed to copy the downloaded file over original one: %s", err.Error()))
+		}
+
+		opts.record(auditlog.Entry{
+			Event:          auditlog.EventInstall,
+			CurrentVersion: currentVersion,
+			Asset:          u.execPath,
+			Error:          errorString(err),
+		})
+	} else {
+		// this is the actual executable, this is a good time to remove the
+		// downloaded file, if there is one, that's why we don't care about
+		// the error
+		os.Remove(u.newFilename)
+		u.removeVersionFiles()
+	}
+
+	u.assetTemplate, err = NewAssetTemplate(filename, opts.assetTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse asset template: %w", err)
+	}
+
+	if (opts.throttle > 0 || opts.async || opts.confirm) && opts.statePath == "" {
+		opts.statePath, err = state.DefaultPath(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the state file: %w", err)
+		}
+	}
+
+	opts.trustChainPath = filepath.Join(dir, "."+filename+"-trust.chain")
+	opts.revocationsPath = filepath.Join(dir, "."+filename+"-revocations.json")
+
+	if opts.statePath != "" {
+		u.state = state.New(opts.statePath)
+	}
+
+	return u, nil
+}
+
+func (u *Updater) candidates(version string) ([]string, error) {
+	return u.assetTemplate.Candidates(version, u.opts.platform)
+}
+
+// Check finds the new version and its asset. It returns ErrNoNewVersion if
+// there is none, ErrBadVersion if it was rolled back on this host before,
+// ErrSkipped if the user chose to skip it, and ErrThrottled if it's not due
+// yet, please refer to WithAutoThrottle.
+func (u *Updater) Check(ctx context.Context) (*Update, error) {
+	if u.opts.throttle > 0 {
+		// a state file which can't be read doesn't hold back the check
+		s, err := u.state.Load()
+		if err == nil && !s.Due(time.Now(), u.opts.throttle) {
+			return nil, ErrThrottled
+		}
+	}
+
+	var err error
+	update := &Update{downloader: u.ghClient}
+
+	// a release without the detached signature of the asset is skipped before
+	// anything is downloaded
+	var checker AssetChecker = u.ghClient
+	if u.opts.detached != "" {
+		checker = NewDetachedAssetChecker(checker, u.opts.detached)
+	}
+
+	if u.opts.tufRoot != nil {
+		tufClient := tuf.NewClient(*u.opts.tufRoot, NewGithubTUFFetcher(u.ghClient), tuf.NewFileStore(u.opts.tufStoreDir),
+			tuf.WithClientHashes(newVerifierOptions(u.opts.verifierOptFns).hashes...))
+		update.Version, update.Asset, err = checkTUFAsset(ctx, tufClient, u.currentVersion, u.candidates)
+		update.downloader = NewTUFDownloader(u.ghClient, tufClient)
+	} else {
+		update.Version, update.Asset, update.Notes, err = checker.CheckAsset(ctx, u.currentVersion, u.candidates)
+	}
+
+	if u.opts.revocationKeys != nil && (err == nil || errors.Is(err, ErrNoNewVersion)) {
+		update.revocations, err = loadRevocations(ctx, u.ghClient, DefaultRevocationsAsset, u.opts.revocationKeys, u.opts.revocationsPath)
+		if err == nil {
+			update.Version, update.Asset, update.Notes, err = checkRevocations(ctx, checker, update.revocations, u.currentVersion, update.Version, update.Asset, update.Notes, u.candidates)
+		}
+	}
+
+	// a check without a new version is recorded without a new version, not as a failure
+	checkErr := err
+	if errors.Is(err, ErrNoNewVersion) {
+		checkErr = nil
+	}
+
+	u.opts.record(auditlog.Entry{
+		Event:          auditlog.EventCheck,
+		CurrentVersion: u.currentVersion,
+		NewVersion:     update.Version,
+		Asset:          update.Asset,
+		Error:          errorString(checkErr),
+	})
+
+	if err == nil && u.opts.healthcheck && u.bad.contains(update.Version) {
+		err = fmt.Errorf("%w: %s", ErrBadVersion, update.Version)
+	} else if err == nil && u.skipped(update.Version) {
+		err = fmt.Errorf("%w: %s", ErrSkipped, update.Version)
+	}
+
+	// a new version found in the background counts as checked once it's
+	// staged, so an interrupted download is retried on the next run
+	if u.state != nil && !(u.opts.async && err == nil) {
+		latestVersion := update.Version
+		if latestVersion == "" {
+			latestVersion = u.currentVersion
+		}
+
+		stateErr := u.state.Update(func(s *state.State) {
+			s.Checked(time.Now(), latestVersion, checkErr)
+		})
+		if stateErr != nil {
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("failed to save the update state: %s", stateErr.Error()))
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return update, nil
+}
+
+// Download downloads and verifies the asset of the update, and runs the health
+// probes on the new binary. If a probe fails, the update is rolled back and
+// an error wrapping ErrUnhealthy is returned.
+func (u *Updater) Download(ctx context.Context, update *Update) error {
+	if err := u.download(ctx, update); err != nil {
+		return err
+	}
+
+	return u.probe(ctx, update)
+}
+
+// download writes the verified new binary next to the current one
+func (u *Updater) download(ctx context.Context, update *Update) error {
+	var binding *Binding
+	if u.opts.binding {
+		binding = &Binding{
+			App:     u.filename,
+			Version: update.Version,
+		}
+
+		// the asset may be one of the fallbacks, e.g. a darwin universal binary,
+		// an unknown one would leave the platform unbound
+		platform, ok := u.assetTemplate.platformOf(update.Asset, update.Version, u.opts.platform)
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrBindingPlatform, update.Asset)
+		}
+
+		binding.OS = platform.OS
+		binding.Arch = platform.Arch
+	}
+
+	downloader := update.downloader
+
+	verifier, keyIDs, err := u.opts.verifier(ctx, downloader, u.publicKey, update.Version, binding, update.revocations)
+	if err != nil {
+		return fmt.Errorf("failed to load public keys: %w", err)
+	}
+
+	if update.revocations != nil {
+		verifier = NewRevocationVerifier(verifier, update.revocations, update.Version)
+	}
+
+	if u.opts.provenance != nil {
+		attestations := downloader.Download(ctx, update.Asset+DefaultProvenanceSuffix, update.Version)
+		defer attestations.Close()
+
+		verifier = NewProvenanceVerifier(verifier, attestations, u.opts.provenance, u.opts.policy)
+	}
+
+	if u.opts.detached != "" {
+		downloader = NewDetachedDownloader(downloader, u.opts.detached)
+	}
+
+	rc := downloader.Download(ctx, update.Asset, update.Version)
+	defer rc.Close()
+
+	// a relaunched version runs from the downloaded file, which can be
+	// unlinked, but not overwritten, while it's running
+	os.Remove(u.binary(update))
+
+	patcher := NewPatcher(u.binary(update))
+	if IsArchiveName(update.Asset) {
+		patcher = NewArchivePatcher(patcher, WithArchiveBinaryPattern(filepath.Base(u.execPath)))
+	}
+
+	downloaded := newRecordingReader(rc)
+	verified := newRecordingReader(verifier.Verify(ctx, downloaded))
+
+	err = patcher.Patch(context.Background(), verified)
+
+	u.opts.record(auditlog.Entry{
+		Event:      auditlog.EventDownload,
+		NewVersion: update.Version,
+		Asset:      update.Asset,
+		Digest:     downloaded.digest(),
+		Error:      errorString(downloaded.err),
+	})
+
+	if downloaded.err == nil {
+		u.opts.record(auditlog.Entry{
+			Event:      auditlog.EventVerify,
+			NewVersion: update.Version,
+			Asset:      update.Asset,
+			Digest:     verified.digest(),
+			KeyIDs:     keyIDs,
+			Error:      errorString(verified.err),
+		})
+	}
+
+	if err != nil && verified.err == nil {
+		u.opts.record(auditlog.Entry{
+			Event:      auditlog.EventInstall,
+			NewVersion: update.Version,
+			Asset:      u.binary(update),
+			Error:      errorString(err),
+		})
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to patch: %w", err)
+	}
+
+	return nil
+}
+
+// binary returns the path the update is downloaded to
+func (u *Updater) binary(update *Update) string {
+	if update.path != "" {
+		return update.path
+	}
+
+	return u.newFilename
+}
+
+// versionFilename returns the path a watched update is downloaded to, so a
+// ready version isn't overwritten by a newer one which may fail its probes
+func (u *Updater) versionFilename(version string) string {
+	version = strings.NewReplacer("/", "_", `\`, "_").Replace(version)
+	return filepath.Join(u.dir, u.filename+"-"+version+"-downloaded"+u.fileExt)
+}
+
+// removeVersionFiles removes the updates downloaded by Watch which were never
+// applied
+func (u *Updater) removeVersionFiles() {
+	entries, err := os.ReadDir(u.dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, u.filename+"-") && strings.HasSuffix(name, "-downloaded"+u.fileExt) {
+			os.Remove(filepath.Join(u.dir, name))
+		}
+	}
+}
+
+// probe runs the health probes on the downloaded binary, and rolls the update
+// back if one of them fails
+func (u *Updater) probe(ctx context.Context, update *Update) error {
+	if err := u.opts.probe(ctx, u.binary(update)); err != nil {
+		os.Remove(u.binary(update))
+		u.opts.rollback(u.bad, u.currentVersion, update.Version, err)
+		return err
+	}
+
+	return nil
+}
+
+// stage downloads the new version, if there is one, and stages it for the
+// next run. It runs in the background, so failures are only recorded.
+func (u *Updater) stage(ctx context.Context) {
+	update, err := u.Check(ctx)
+	if err != nil {
+		return
+	}
+
+	err = u.Download(ctx, update)
+	if err == nil {
+		err = os.Rename(u.binary(update), u.stagedFilename)
+	}
+
+	stateErr := u.state.Update(func(s *state.State) {
+		if err != nil {
+			s.Checked(time.Now(), "", err)
+			return
+		}
+
+		s.Checked(time.Now(), update.Version, nil)
+		s.Staged = update.Version
+	})
+
+	if err == nil && stateErr == nil {
+		fmt.Fprintf(os.Stderr, "updated to %s on next run\n", update.Version)
+	}
+}
+
+// staged returns the version staged by a previous run, which is moved to the
+// downloaded file to be relaunched. A staged version which isn't newer than
+// the current one, e.g. because it was installed meanwhile, is removed.
+func (u *Updater) staged() (*Update, bool) {
+	s, err := u.state.Load()
+	if err != nil || s.Staged == "" {
+		return nil, false
+	}
+
+	var update *Update
+	if fileExists(u.stagedFilename) && version.Compare(s.Staged, u.currentVersion) {
+		update = &Update{Version: s.Staged}
+		err = os.Rename(u.stagedFilename, u.newFilename)
+	} else {
+		err = os.Remove(u.stagedFilename)
+	}
+
+	if stateErr := u.state.Update(func(s *state.State) { s.Staged = "" }); stateErr != nil {
+		fmt.Fprintln(os.Stderr, fmt.Sprintf("failed to save the update state: %s", stateErr.Error()))
+	}
+
+	if update == nil || err != nil {
+		return nil, false
+	}
+
+	return update, true
+}
+
+// Apply relaunches the downloaded update, and this process exits once the new
+// version took over, please refer to WithAutoRunner and
+// WithAutoGracefulRestart. It returns an error if the new version couldn't
+// take over, e.g. it was rolled back, and this process keeps running.
+func (u *Updater) Apply(ctx context.Context, update *Update) error {
+	if u.opts.handshake || u.opts.graceful != nil {
+		// the new binary copies itself over the current one when it starts, so
+		// the current one is kept to be restored if the new one isn't healthy
+		err := copyFile(u.previousFilename, u.execPath)
+		if err != nil {
+			return fmt.Errorf("failed to back up the current version: %w", err)
+		}
+		defer os.Remove(u.previousFilename)
+	}
+
+	if u.opts.graceful != nil {
+		err := NewGracefulRunner(u.binary(update), os.Args[1:], u.opts.graceful.listeners, u.opts.graceful.shutdown, WithGracefulReadyTimeout(u.opts.healthTimeout)).Run(ctx)
+		if errors.Is(err, ErrUnhealthy) {
+			u.restore(update, err)
+			return err
+		} else if err != nil && !errors.Is(err, ErrDrain) {
+			// the new version wasn't started, so this one keeps serving
+			os.Remove(u.binary(update))
+			return fmt.Errorf("failed to restart gracefully: %w", err)
+		} else if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+
+		os.Remove(u.previousFilename)
+		u.opts.exit(nil)
+		return nil
+	}
+
+	var err error
+	if u.opts.handshake {
+		var ran bool
+		ran, err = u.runWithHandshake(update)
+		if !ran {
+			return err
+		}
+	} else {
+		err = NewProcessRunner(u.binary(update), os.Args[1:], u.opts.runnerOptFns...).Run(ctx)
+	}
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		fmt.Fprintln(os.Stderr, err.Error())
+	}
+
+	// the new version did the work, so this process ends the way it did
+	os.Remove(u.previousFilename)
+	u.opts.exit(err)
+
+	return nil
+}
+
+// runWithHandshake relaunches the new version and rolls it back if it exits
+// or doesn't confirm it's healthy within the health timeout. ran is false then,
+// so this version runs the command instead. Once the new version confirmed,
+// its error is the result of the command.
+func (u *Updater) runWithHandshake(update *Update) (ran bool, err error) {
+	h, err := startWithHandshake(u.binary(update), os.Args[1:], u.opts.healthTimeout, u.opts.runnerOptFns...)
+	if err != nil {
+		u.restore(update, err)
+		return false, err
+	}
+
+	return true, h.wait()
+}
+
+// restore puts the current version back and marks the new version bad
+func (u *Updater) restore(update *Update, err error) {
+	if restoreErr := restoreFile(u.execPath, u.previousFilename); restoreErr != nil {
+		fmt.Fprintln(os.Stderr, fmt.Sprintf("failed to restore the current version: %s", restoreErr.Error()))
+	}
+
+	os.Remove(u.binary(update))
+	u.opts.rollback(u.bad, u.currentVersion, update.Version, err)
+}
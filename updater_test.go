@@ -0,0 +1,248 @@
+package selfupdate_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"selfupdate.blockthrough.com"
+	"selfupdate.blockthrough.com/pkg/crypto"
+	"selfupdate.blockthrough.com/pkg/hash"
+	"selfupdate.blockthrough.com/pkg/sigstore"
+	"selfupdate.blockthrough.com/pkg/state"
+)
+
+// testApp is the app "app" at v1.0.0 in a temporary directory, so the files of
+// its updater don't leak between tests. Its new versions are published on a
+// fake GitHub server, and it doesn't exit when it relaunches one.
+type testApp struct {
+	dir        string
+	publicKey  crypto.PublicKey
+	privateKey crypto.PrivateKey
+	server     *githubServer
+	url        string
+	exited     bool
+	exitErr    error
+}
+
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+
+	publicKey, privateKey, err := crypto.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &githubServer{}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	app := &testApp{
+		dir:        t.TempDir(),
+		publicKey:  publicKey,
+		privateKey: privateKey,
+		server:     server,
+		url:        httpServer.URL,
+	}
+
+	// the current version, which is backed up while a new one is relaunched
+	if err := os.WriteFile(app.path("app"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return app
+}
+
+func (a *testApp) path(name string) string {
+	return filepath.Join(a.dir, name)
+}
+
+// publish releases a version whose binary is the shell script
+func (a *testApp) publish(t *testing.T, version string, script string) {
+	t.Helper()
+
+	signed, err := io.ReadAll(selfupdate.NewHashSigner(a.privateKey).Sign(context.Background(), bytes.NewReader([]byte("#!/bin/sh\n"+script+"\n"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.server.publish(version, map[string]string{
+		fmt.Sprintf("app-%s-%s.sign", runtime.GOOS, runtime.GOARCH): string(signed),
+	})
+}
+
+func (a *testApp) options(optFns ...selfupdate.AutoOptFn) []selfupdate.AutoOptFn {
+	return append([]selfupdate.AutoOptFn{
+		selfupdate.WithAutoExecutable(a.path("app")),
+		selfupdate.WithAutoStateFile(a.path("state.json")),
+		selfupdate.WithAutoGithub(selfupdate.NewGithubWithURL(a.url, "owner", "repo")),
+		selfupdate.WithAutoExit(func(err error) {
+			a.exited = true
+			a.exitErr = err
+		}),
+	}, optFns...)
+}
+
+// auto runs Auto of the app, it reports whether it relaunched a new version
+func (a *testApp) auto(optFns ...selfupdate.AutoOptFn) bool {
+	a.exited = false
+	a.exitErr = nil
+
+	selfupdate.Auto(context.Background(), "owner", "repo", "v1.0.0", "app", "", a.publicKey.String(), a.options(optFns...)...)
+
+	return a.exited
+}
+
+func (a *testApp) updater(t *testing.T, optFns ...selfupdate.AutoOptFn) *selfupdate.Updater {
+	t.Helper()
+
+	u, err := selfupdate.NewUpdater("owner", "repo", "v1.0.0", "app", "", a.publicKey.String(), a.options(optFns...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u
+}
+
+func (a *testApp) state(t *testing.T) state.State {
+	t.Helper()
+
+	s, err := state.New(a.path("state.json")).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestUpdaterBindingUnknownAsset(t *testing.T) {
+	u := newTestApp(t).updater(t, selfupdate.WithAutoBinding())
+
+	err := u.Download(context.Background(), &selfupdate.Update{Version: "v1.1.0", Asset: "other-app-plan9-mips.sign"})
+	if !errors.Is(err, selfupdate.ErrBindingPlatform) {
+		t.Fatalf("expected ErrBindingPlatform but got %v", err)
+	}
+}
+
+func TestUpdaterOptionsConflict(t *testing.T) {
+	app := newTestApp(t)
+
+	sigstoreFn := selfupdate.WithAutoSigstore(sigstore.PublicGoodTrustedRoot(), sigstore.GitHubActionsIdentity("owner/repo", "release.yml"))
+	hashesFn := selfupdate.WithAutoVerifier(selfupdate.WithVerifierHashes(hash.SHA512))
+
+	tests := []struct {
+		name   string
+		optFns []selfupdate.AutoOptFn
+		err    error
+	}{
+		{"threshold", []selfupdate.AutoOptFn{selfupdate.WithAutoThreshold(2), hashesFn}, nil},
+		{"binding", []selfupdate.AutoOptFn{selfupdate.WithAutoBinding(), selfupdate.WithAutoTrustChain("chain"), hashesFn}, nil},
+		{"threshold and binding", []selfupdate.AutoOptFn{selfupdate.WithAutoThreshold(2), selfupdate.WithAutoBinding()}, selfupdate.ErrAutoOptions},
+		{"minisign and binding", []selfupdate.AutoOptFn{selfupdate.WithAutoMinisign(), selfupdate.WithAutoBinding()}, selfupdate.ErrAutoOptions},
+		{"minisign and hashes", []selfupdate.AutoOptFn{selfupdate.WithAutoMinisign(), hashesFn}, selfupdate.ErrAutoOptions},
+		{"minisign and trust chain", []selfupdate.AutoOptFn{selfupdate.WithAutoMinisign(), selfupdate.WithAutoTrustChain("chain")}, selfupdate.ErrAutoOptions},
+		{"sigstore and threshold", []selfupdate.AutoOptFn{sigstoreFn, selfupdate.WithAutoThreshold(2)}, selfupdate.ErrAutoOptions},
+		{"sigstore and hashes", []selfupdate.AutoOptFn{sigstoreFn, hashesFn}, selfupdate.ErrAutoOptions},
+	}
+
+	for _, tt := range tests {
+		_, err := selfupdate.NewUpdater("owner", "repo", "v1.0.0", "app", "", app.publicKey.String(), app.options(tt.optFns...)...)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v but got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestAutoAsync(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake binaries are shell scripts")
+	}
+
+	app := newTestApp(t)
+	app.publish(t, "v1.1.0", `: > "$`+selfupdate.HealthEnv+`"`)
+
+	async := []selfupdate.AutoOptFn{selfupdate.WithAutoAsync(), selfupdate.WithAutoForeground(), selfupdate.WithAutoHealthHandshake()}
+
+	// the first run stages the new version for the next one
+	if app.auto(async...) {
+		t.Fatal("expected the new version to be staged, not relaunched")
+	}
+
+	if s := app.state(t); s.Staged != "v1.1.0" || s.LatestVersion != "v1.1.0" {
+		t.Fatalf("expected v1.1.0 to be staged, got %+v", s)
+	}
+
+	if _, err := os.Stat(app.path("app-staged")); err != nil {
+		t.Fatalf("new version is not staged: %v", err)
+	}
+
+	// the next run relaunches the staged version without checking again
+	listed := app.server.listCount()
+
+	if !app.auto(async...) || app.exitErr != nil {
+		t.Fatalf("expected the staged version to be relaunched, got %v", app.exitErr)
+	}
+
+	if app.server.listCount() != listed {
+		t.Fatal("expected the staged version to be relaunched without a check")
+	}
+
+	if _, err := os.Stat(app.path("app-staged")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the staged file to be moved, got %v", err)
+	}
+
+	if s := app.state(t); s.Staged != "" {
+		t.Fatalf("expected the staged version to be cleared, got %q", s.Staged)
+	}
+}
+
+func TestAutoAsyncStale(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		file    bool
+	}{
+		{"installed meanwhile", "v1.0.0", true},
+		{"older", "v0.9.0", true},
+		{"missing file", "v1.1.0", false},
+	}
+
+	for _, tt := range tests {
+		// there is no release to stage instead
+		app := newTestApp(t)
+
+		if tt.file {
+			if err := os.WriteFile(app.path("app-staged"), []byte("stale"), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err := state.New(app.path("state.json")).Update(func(s *state.State) { s.Staged = tt.version })
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if app.auto(selfupdate.WithAutoAsync(), selfupdate.WithAutoForeground()) {
+			t.Errorf("%s: expected nothing to be relaunched", tt.name)
+		}
+
+		if _, err := os.Stat(app.path("app-staged")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s: expected the staged file to be removed, got %v", tt.name, err)
+		}
+
+		if _, err := os.Stat(app.path("app-downloaded")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s: expected nothing to be downloaded, got %v", tt.name, err)
+		}
+
+		if s := app.state(t); s.Staged != "" {
+			t.Errorf("%s: expected the staged version to be cleared, got %q", tt.name, s.Staged)
+		}
+	}
+}
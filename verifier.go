@@ -1,10 +1,8 @@
 package selfupdate
 
 import (
-	"bytes"
-	"context"
 	"errors"
-	"io"
+	"time"
 
 	"selfupdate.blockthrough.com/pkg/crypto"
 	"selfupdate.blockthrough.com/pkg/hash"
@@ -12,30 +10,70 @@ import (
 
 var (
 	ErrVerificationFailed = errors.New("verification failed")
+	ErrHashNotAllowed     = errors.New("hash algorithm is not allowed")
 )
 
-func NewHashVerifier(publicKey crypto.PublicKey) Verifier {
-	return VerifierFunc(func(ctx context.Context, r io.Reader) io.Reader {
-		var signedHash [hash.HashSize + crypto.Overhead]byte
-		if _, err := io.ReadFull(r, signedHash[:]); err != nil {
-			return newErrorReader(err)
-		}
+// DefaultVerifierHashes are the digest algorithms verifiers accept by default
+var DefaultVerifierHashes = []hash.Algorithm{
+	hash.SHA256,
+	hash.SHA512,
+	hash.BLAKE2b256,
+	hash.BLAKE3,
+}
 
-		var buffer bytes.Buffer
+type verifierOptions struct {
+	now    func() time.Time
+	hashes []hash.Algorithm
+}
 
-		contentHash, err := hash.FromReader(io.TeeReader(r, &buffer))
-		if err != nil {
-			return newErrorReader(err)
-		}
+type verifierOptFn func(opts *verifierOptions)
 
-		if !publicKey.Verify(signedHash[:]) {
-			return newErrorReader(ErrVerificationFailed)
-		}
+// WithVerifierHashes replaces DefaultVerifierHashes, signatures of content
+// hashed with any other algorithm are refused
+func WithVerifierHashes(algorithms ...hash.Algorithm) verifierOptFn {
+	return func(opts *verifierOptions) {
+		opts.hashes = algorithms
+	}
+}
+
+// WithVerifierClock overrides time.Now for checking the expiry of signatures
+func WithVerifierClock(now func() time.Time) verifierOptFn {
+	return func(opts *verifierOptions) {
+		opts.now = now
+	}
+}
 
-		if !bytes.Equal(contentHash, signedHash[crypto.Overhead:]) {
-			return newErrorReader(ErrVerificationFailed)
+func newVerifierOptions(optFns []verifierOptFn) *verifierOptions {
+	opts := &verifierOptions{
+		now:    time.Now,
+		hashes: DefaultVerifierHashes,
+	}
+
+	for _, optFn := range optFns {
+		optFn(opts)
+	}
+
+	return opts
+}
+
+func (opts *verifierOptions) allows(algorithm hash.Algorithm) bool {
+	for _, allowed := range opts.hashes {
+		if allowed == algorithm {
+			return true
 		}
+	}
+
+	return false
+}
+
+func NewHashVerifier(publicKey crypto.PublicKey) Verifier {
+	return NewKeyringVerifier(crypto.NewKeyring(publicKey))
+}
 
-		return &buffer
-	})
+// NewKeyringVerifier accepts content signed by any of the keys in the keyring.
+// The legacy format, the versioned format with a key id and the bound format
+// are accepted. Bound signatures are refused once they expire, but the binding
+// itself is only checked by NewBindingVerifier.
+func NewKeyringVerifier(keyring *crypto.Keyring, optFns ...verifierOptFn) Verifier {
+	return newBoundVerifier(keyring, nil, newVerifierOptions(optFns))
 }
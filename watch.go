@@ -0,0 +1,175 @@
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// DefaultWatchJitter spreads the checks of many hosts, each interval is up to
+// 10% shorter or longer
+const DefaultWatchJitter = 0.1
+
+// the events of Watch, in the order they happen for an update
+const (
+	WatchAvailable  = "available"
+	WatchDownloaded = "downloaded"
+	WatchReady      = "ready"
+	WatchError      = "error"
+)
+
+// WatchEvent is sent by Watch. Update is nil for errors of the check.
+type WatchEvent struct {
+	Type   string
+	Update *Update
+	Err    error
+}
+
+type watchOptions struct {
+	jitter float64
+	after  func(d time.Duration) <-chan time.Time
+}
+
+type watchOptFn func(opts *watchOptions)
+
+// WithWatchJitter sets the fraction of the interval by which each interval is
+// randomly shortened or lengthened, the default is DefaultWatchJitter
+func WithWatchJitter(jitter float64) watchOptFn {
+	return func(opts *watchOptions) {
+		opts.jitter = jitter
+	}
+}
+
+// WithWatchClock overrides time.After for waiting between checks, it's mostly
+// useful for tests
+func WithWatchClock(after func(d time.Duration) <-chan time.Time) watchOptFn {
+	return func(opts *watchOptions) {
+		opts.after = after
+	}
+}
+
+// Watch checks for a new version every interval, with jitter, until ctx is
+// cancelled, and then closes the returned channel. The first check is after
+// the first interval, since Auto usually checks at startup. A new version is
+// downloaded and probed right away, and sent as WatchAvailable, WatchDownloaded
+// and WatchReady, so the application can call Apply when it suits it. A ready
+// version isn't downloaded again, and versions which failed their health check
+// are skipped. Every version is downloaded to its own file, and the file of a
+// ready version is removed once a newer one is ready. The events must be
+// received, or the checks stop.
+func (u *Updater) Watch(ctx context.Context, interval time.Duration, optFns ...watchOptFn) <-chan WatchEvent {
+	var ready *Update
+
+	return watch(ctx, interval, watchSteps{
+		check: u.Check,
+		download: func(ctx context.Context, update *Update) error {
+			update.path = u.versionFilename(update.Version)
+			return u.download(ctx, update)
+		},
+		probe: func(ctx context.Context, update *Update) error {
+			if err := u.probe(ctx, update); err != nil {
+				return err
+			}
+
+			// only the latest ready version is kept
+			if ready != nil {
+				os.Remove(u.binary(ready))
+			}
+			ready = update
+
+			return nil
+		},
+	}, optFns...)
+}
+
+// watchSteps are the steps of an update run by watch
+type watchSteps struct {
+	check    func(ctx context.Context) (*Update, error)
+	download func(ctx context.Context, update *Update) error
+	probe    func(ctx context.Context, update *Update) error
+}
+
+func watch(ctx context.Context, interval time.Duration, steps watchSteps, optFns ...watchOptFn) <-chan WatchEvent {
+	opts := &watchOptions{
+		jitter: DefaultWatchJitter,
+		after:  time.After,
+	}
+
+	for _, optFn := range optFns {
+		optFn(opts)
+	}
+
+	events := make(chan WatchEvent)
+
+	go func() {
+		defer close(events)
+
+		emit := func(event WatchEvent) bool {
+			select {
+			case events <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		var ready *Update
+
+		for {
+			delay := interval + time.Duration(float64(interval)*opts.jitter*(2*rand.Float64()-1))
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-opts.after(delay):
+			}
+
+			update, err := steps.check(ctx)
+			if errors.Is(err, ErrNoNewVersion) || errors.Is(err, ErrBadVersion) || errors.Is(err, ErrThrottled) || errors.Is(err, ErrSkipped) {
+				continue
+			} else if err != nil {
+				if !emit(WatchEvent{Type: WatchError, Err: err}) {
+					return
+				}
+				continue
+			}
+
+			if ready != nil && ready.Version == update.Version {
+				continue
+			}
+
+			if !emit(WatchEvent{Type: WatchAvailable, Update: update}) {
+				return
+			}
+
+			if err := steps.download(ctx, update); err != nil {
+				if !emit(WatchEvent{Type: WatchError, Update: update, Err: err}) {
+					return
+				}
+				continue
+			}
+
+			if !emit(WatchEvent{Type: WatchDownloaded, Update: update}) {
+				return
+			}
+
+			// a failed probe rolls the update back, so it's skipped from now on
+			if err := steps.probe(ctx, update); err != nil {
+				if !emit(WatchEvent{Type: WatchError, Update: update, Err: err}) {
+					return
+				}
+				continue
+			}
+
+			ready = update
+
+			if !emit(WatchEvent{Type: WatchReady, Update: update}) {
+				return
+			}
+		}
+	}()
+
+	return events
+}
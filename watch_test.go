@@ -0,0 +1,223 @@
+package selfupdate_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"selfupdate.blockthrough.com"
+)
+
+// fakeClock records the delays Watch waits for and fires them on tick
+type fakeClock struct {
+	delays chan time.Duration
+	ticks  chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		delays: make(chan time.Duration),
+		ticks:  make(chan time.Time),
+	}
+}
+
+func (c *fakeClock) after(d time.Duration) <-chan time.Time {
+	c.delays <- d
+	return c.ticks
+}
+
+func (c *fakeClock) tick(t *testing.T, interval time.Duration) {
+	select {
+	case d := <-c.delays:
+		if d < interval*9/10 || d > interval*11/10 {
+			t.Fatalf("expected a delay within 10%% of %s, got %s", interval, d)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch is not waiting for the next check")
+	}
+
+	c.ticks <- time.Now()
+}
+
+func TestWatch(t *testing.T) {
+	interval := time.Hour
+	checkErr := errors.New("rate limited")
+	probeErr := errors.New("unhealthy")
+
+	// the result of each check, in order
+	checks := []struct {
+		update *selfupdate.Update
+		err    error
+	}{
+		{nil, selfupdate.ErrNoNewVersion},
+		{nil, checkErr},
+		{&selfupdate.Update{Version: "v1.1.0"}, nil},
+		{&selfupdate.Update{Version: "v1.2.0"}, nil},
+		{nil, selfupdate.ErrBadVersion},
+		{&selfupdate.Update{Version: "v1.3.0"}, nil},
+		{&selfupdate.Update{Version: "v1.3.0"}, nil},
+	}
+
+	var downloaded []string
+	check := func(ctx context.Context) (*selfupdate.Update, error) {
+		c := checks[0]
+		checks = checks[1:]
+		return c.update, c.err
+	}
+	download := func(ctx context.Context, update *selfupdate.Update) error {
+		downloaded = append(downloaded, update.Version)
+		return nil
+	}
+	probe := func(ctx context.Context, update *selfupdate.Update) error {
+		if update.Version == "v1.2.0" {
+			return probeErr
+		}
+		return nil
+	}
+
+	clock := newFakeClock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := selfupdate.WatchSteps(ctx, interval, check, download, probe, selfupdate.WithWatchClock(clock.after))
+
+	expect := func(typ string, version string, err error) {
+		t.Helper()
+
+		select {
+		case event := <-events:
+			if event.Type != typ || !errors.Is(event.Err, err) {
+				t.Fatalf("expected %s event with %v, got %s with %v", typ, err, event.Type, event.Err)
+			}
+
+			if (event.Update == nil && version != "") || (event.Update != nil && event.Update.Version != version) {
+				t.Fatalf("expected %s event of %q, got %+v", typ, version, event.Update)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %s event", typ)
+		}
+	}
+
+	// no new version
+	clock.tick(t, interval)
+
+	clock.tick(t, interval)
+	expect(selfupdate.WatchError, "", checkErr)
+
+	clock.tick(t, interval)
+	expect(selfupdate.WatchAvailable, "v1.1.0", nil)
+	expect(selfupdate.WatchDownloaded, "v1.1.0", nil)
+	expect(selfupdate.WatchReady, "v1.1.0", nil)
+
+	clock.tick(t, interval)
+	expect(selfupdate.WatchAvailable, "v1.2.0", nil)
+	expect(selfupdate.WatchDownloaded, "v1.2.0", nil)
+	expect(selfupdate.WatchError, "v1.2.0", probeErr)
+
+	// the rolled back version is skipped
+	clock.tick(t, interval)
+
+	clock.tick(t, interval)
+	expect(selfupdate.WatchAvailable, "v1.3.0", nil)
+	expect(selfupdate.WatchDownloaded, "v1.3.0", nil)
+	expect(selfupdate.WatchReady, "v1.3.0", nil)
+
+	// the ready version isn't downloaded again
+	clock.tick(t, interval)
+
+	// waiting for the next check
+	<-clock.delays
+	cancel()
+
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatal("expected no more events")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch didn't stop when the context was cancelled")
+	}
+
+	if len(downloaded) != 3 {
+		t.Fatalf("expected 3 downloads, got %v", downloaded)
+	}
+}
+
+func TestWatchKeepsReadyVersion(t *testing.T) {
+	interval := time.Hour
+	probeErr := errors.New("unhealthy")
+
+	app := newTestApp(t)
+	u := app.updater(t, selfupdate.WithAutoHealthcheck(time.Second, func(ctx context.Context, path string) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if bytes.Contains(data, []byte("v1.3.0")) {
+			return probeErr
+		}
+
+		return nil
+	}))
+
+	clock := newFakeClock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := u.Watch(ctx, interval, selfupdate.WithWatchClock(clock.after))
+
+	expect := func(typ string, version string, err error) *selfupdate.Update {
+		t.Helper()
+
+		select {
+		case event := <-events:
+			if event.Type != typ || !errors.Is(event.Err, err) || event.Update == nil || event.Update.Version != version {
+				t.Fatalf("expected %s event of %q with %v, got %s with %v", typ, version, err, event.Type, event.Err)
+			}
+
+			return event.Update
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %s event", typ)
+		}
+
+		return nil
+	}
+
+	app.publish(t, "v1.2.0", `echo v1.2.0 > "`+app.path("ran")+`"`)
+	clock.tick(t, interval)
+	expect(selfupdate.WatchAvailable, "v1.2.0", nil)
+	expect(selfupdate.WatchDownloaded, "v1.2.0", nil)
+	ready := expect(selfupdate.WatchReady, "v1.2.0", nil)
+
+	// the newer version fails its probe, which must not touch the ready one
+	app.publish(t, "v1.3.0", `echo v1.3.0 > "`+app.path("ran")+`"`)
+	clock.tick(t, interval)
+	expect(selfupdate.WatchAvailable, "v1.3.0", nil)
+	expect(selfupdate.WatchDownloaded, "v1.3.0", nil)
+	expect(selfupdate.WatchError, "v1.3.0", probeErr)
+
+	<-clock.delays
+	cancel()
+
+	if err := u.Apply(context.Background(), ready); err != nil {
+		t.Fatal(err)
+	}
+
+	if !app.exited || app.exitErr != nil {
+		t.Fatalf("expected v1.2.0 to run, got exited %v with %v", app.exited, app.exitErr)
+	}
+
+	ran, err := os.ReadFile(app.path("ran"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.TrimSpace(string(ran)) != "v1.2.0" {
+		t.Fatalf("expected v1.2.0 to run, got %q", ran)
+	}
+}